@@ -0,0 +1,210 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// Clients can identify themselves with this header, which lets us rate limit
+// users behind a shared IP (e.g. university networks) separately
+const ClientTokenHeader = "X-Client-Token"
+
+// Defaults for the abuse protection, each can be overridden in the .env file
+const (
+	defaultReportsPerMinutePerIP    = 6
+	defaultReportsPerMinutePerToken = 3
+	defaultBurstWindow              = 10 * time.Minute
+	defaultBurstMaxStations         = 3
+)
+
+var (
+	reportBursts       = NewBurstDetector(defaultBurstWindow, defaultBurstMaxStations)
+	reportRateLimiters []echo.MiddlewareFunc
+	reporterSalt       string
+)
+
+// InitAbuseProtection reads the abuse protection settings from the environment.
+// It has to be called after the .env file has been loaded.
+func InitAbuseProtection() {
+	window := time.Duration(envInt("BURST_WINDOW_MINUTES", int(defaultBurstWindow/time.Minute))) * time.Minute
+	reportBursts = NewBurstDetector(window, envInt("BURST_MAX_STATIONS", defaultBurstMaxStations))
+	reporterSalt = os.Getenv("REPORTER_ID_SALT")
+	if reporterSalt == "" {
+		// Without a salt, the reporter ids of IPs could be reversed by hashing every possible address
+		slog.Error("REPORTER_ID_SALT is required to anonymize the reporters")
+		os.Exit(1)
+	}
+	reportRateLimiters = newReportRateLimiters()
+
+	initChallenge()
+}
+
+// IPExtractor reads the IP of the client from the connection. Only if the api runs behind a proxy
+// whose ranges are listed in TRUSTED_PROXIES (e.g. 10.0.0.0/8,fd00::/8), X-Forwarded-For is used,
+// otherwise anyone could pick a new IP for every request to get around the rate limits.
+func IPExtractor() (echo.IPExtractor, error) {
+	proxies := os.Getenv("TRUSTED_PROXIES")
+	if strings.TrimSpace(proxies) == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range strings.Split(proxies, ",") {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q in TRUSTED_PROXIES: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// ReportRateLimiters returns the middlewares limiting how many reports
+// a single IP and a single client token can submit per minute.
+// The limits are shared by all routes the middlewares are used for.
+func ReportRateLimiters() []echo.MiddlewareFunc {
+	return reportRateLimiters
+}
+
+func newReportRateLimiters() []echo.MiddlewareFunc {
+	ipLimiter := middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: isTrustedReporter,
+		Store:   newPerMinuteStore(envInt("REPORTS_PER_MINUTE_PER_IP", defaultReportsPerMinutePerIP)),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		DenyHandler: denyReport,
+	})
+
+	tokenLimiter := middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		// Requests without a token are already covered by the IP limiter
+		Skipper: func(c echo.Context) bool {
+			return isTrustedReporter(c) || c.Request().Header.Get(ClientTokenHeader) == ""
+		},
+		Store: newPerMinuteStore(envInt("REPORTS_PER_MINUTE_PER_TOKEN", defaultReportsPerMinutePerToken)),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.Request().Header.Get(ClientTokenHeader), nil
+		},
+		DenyHandler: denyReport,
+	})
+
+	return []echo.MiddlewareFunc{ipLimiter, tokenLimiter}
+}
+
+func newPerMinuteStore(perMinute int) middleware.RateLimiterStore {
+	return middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:      rate.Limit(float64(perMinute) / 60),
+		Burst:     perMinute,
+		ExpiresIn: 5 * time.Minute,
+	})
+}
+
+func denyReport(c echo.Context, identifier string, err error) error {
+	c.Response().Header().Set("Retry-After", "60")
+	return NewAPIError(http.StatusTooManyRequests, ErrorCodeRateLimited, "Too many reports, please try again later")
+}
+
+// reportSources returns the identities a report is attributed to, the most specific one first
+func reportSources(c echo.Context) []string {
+	sources := []string{}
+	if token := c.Request().Header.Get(ClientTokenHeader); token != "" {
+		sources = append(sources, "token:"+token)
+	}
+	return append(sources, "ip:"+c.RealIP())
+}
+
+// ReporterID anonymizes a report source, so that reporters can be banned without storing their IP
+func ReporterID(source string) string {
+	hash := sha256.Sum256([]byte(reporterSalt + source))
+	return hex.EncodeToString(hash[:16])
+}
+
+func reporterIDs(sources []string) []string {
+	ids := make([]string, 0, len(sources))
+	for _, source := range sources {
+		ids = append(ids, ReporterID(source))
+	}
+	return ids
+}
+
+type sourceReport struct {
+	stationID string
+	at        time.Time
+}
+
+// BurstDetector keeps track of which stations a source reported recently,
+// to catch scripts reporting inspectors all over the map at once.
+type BurstDetector struct {
+	mu          sync.Mutex
+	window      time.Duration
+	maxStations int
+	reports     map[string][]sourceReport
+}
+
+func NewBurstDetector(window time.Duration, maxStations int) *BurstDetector {
+	return &BurstDetector{
+		window:      window,
+		maxStations: maxStations,
+		reports:     make(map[string][]sourceReport),
+	}
+}
+
+// Record registers a report for the station and returns true if the source
+// has now reported more distinct stations within the window than allowed.
+func (d *BurstDetector) Record(source, stationID string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recent := d.prune(d.reports[source], now)
+	recent = append(recent, sourceReport{stationID: stationID, at: now})
+	d.reports[source] = recent
+
+	// Drop sources that stopped reporting, so the map does not grow forever
+	if len(d.reports) > 10000 {
+		for key, reports := range d.reports {
+			if pruned := d.prune(reports, now); len(pruned) == 0 {
+				delete(d.reports, key)
+			} else {
+				d.reports[key] = pruned
+			}
+		}
+	}
+
+	stations := make(map[string]struct{})
+	for _, report := range recent {
+		stations[report.stationID] = struct{}{}
+	}
+
+	return len(stations) > d.maxStations
+}
+
+func (d *BurstDetector) prune(reports []sourceReport, now time.Time) []sourceReport {
+	recent := reports[:0]
+	for _, report := range reports {
+		if now.Sub(report.at) < d.window {
+			recent = append(recent, report)
+		}
+	}
+	return recent
+}
+
+func envInt(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
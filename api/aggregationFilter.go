@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Period of the heatmap and statistics if no 'from' is given
+const defaultAggregationPeriod = 30 * 24 * time.Hour
+
+// parseAggregationFilter reads the period, hours, weekdays, lines and stations shared by the statistics endpoints
+func parseAggregationFilter(c echo.Context) (structs.AggregationFilter, error) {
+	var filter structs.AggregationFilter
+	var err error
+
+	if filter.To, err = parseOptionalTime(c.QueryParam("to")); err != nil {
+		return filter, ValidationFailed("Invalid 'to' time, expected RFC3339").WithDetails(map[string]string{"field": "to", "value": c.QueryParam("to")})
+	}
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+
+	if filter.From, err = parseOptionalTime(c.QueryParam("from")); err != nil {
+		return filter, ValidationFailed("Invalid 'from' time, expected RFC3339").WithDetails(map[string]string{"field": "from", "value": c.QueryParam("from")})
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-defaultAggregationPeriod)
+	}
+
+	if !filter.From.Before(filter.To) {
+		return filter, ValidationFailed("'from' has to be before 'to'")
+	}
+
+	// The reports are stored in local time
+	filter.From, filter.To = filter.From.Local(), filter.To.Local()
+
+	if filter.Hours, err = parseIntList(c.QueryParam("hours"), 0, 23); err != nil {
+		return filter, ValidationFailed("Invalid 'hours': " + err.Error()).WithDetails(map[string]string{"field": "hours", "value": c.QueryParam("hours")})
+	}
+
+	// Weekdays start with 0 on Sunday, like time.Weekday
+	if filter.Weekdays, err = parseIntList(c.QueryParam("weekdays"), 0, 6); err != nil {
+		return filter, ValidationFailed("Invalid 'weekdays': " + err.Error()).WithDetails(map[string]string{"field": "weekdays", "value": c.QueryParam("weekdays")})
+	}
+
+	if lines := c.QueryParam("lines"); lines != "" {
+		filter.Lines = strings.Split(lines, ",")
+	}
+	if stations := c.QueryParam("stations"); stations != "" {
+		filter.StationIDs = strings.Split(stations, ",")
+	}
+
+	return filter, nil
+}
+
+// parseIntList parses comma separated numbers between min and max, e.g. hours=17,18,19
+func parseIntList(value string, min, max int) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	numbers := []int{}
+	for _, part := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || number < min || number > max {
+			return nil, fmt.Errorf("expected numbers between %d and %d", min, max)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
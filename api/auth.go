@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Partner apps send their key in this header or as a bearer token
+const ApiKeyHeader = "X-API-Key"
+
+// Every role includes the permissions of the roles before it
+var roleLevels = map[string]int{
+	structs.RolePublic:   0,
+	structs.RoleReporter: 1,
+	structs.RolePartner:  2,
+	structs.RoleAdmin:    3,
+}
+
+var apiKeyQuotas = NewQuotaTracker()
+
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole checks if the role grants at least the permissions of the required role
+func HasRole(role, required string) bool {
+	level, ok := roleLevels[role]
+	return ok && level >= roleLevels[required]
+}
+
+// GenerateApiKey returns a new random key and the hash under which it is stored
+func GenerateApiKey() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+
+	key := "ff_" + hex.EncodeToString(bytes)
+	return key, HashApiKey(key), nil
+}
+
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Authenticate resolves the api key of the request to its role.
+// Requests without a key are treated as public, invalid keys are rejected.
+func Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(ApiKeyHeader)
+		if key == "" {
+			// Other schemes, e.g. Basic auth of a proxy, don't carry an api key
+			if bearer, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+				key = bearer
+			}
+		}
+
+		if key == "" {
+			c.Set("role", structs.RolePublic)
+			return next(c)
+		}
+
+		apiKey, remaining, err := lookupApiKey(c.Request().Context(), key, time.Now())
+		if apiKey.QuotaPerDay > 0 {
+			c.Response().Header().Set("X-Quota-Limit", strconv.Itoa(apiKey.QuotaPerDay))
+			c.Response().Header().Set("X-Quota-Remaining", strconv.Itoa(remaining))
+		}
+		if err != nil {
+			return err
+		}
+
+		c.Set("apiKey", apiKey)
+		c.Set("role", apiKey.Role)
+		return next(c)
+	}
+}
+
+// lookupApiKey finds the key and counts the request against its daily quota.
+// The key is also returned when the quota is exceeded, so the quota can be reported.
+func lookupApiKey(ctx context.Context, key string, now time.Time) (structs.ApiKey, int, error) {
+	apiKey, err := database.GetApiKeyByHash(ctx, HashApiKey(key))
+	if errors.Is(err, database.ErrApiKeyNotFound) {
+		return structs.ApiKey{}, 0, NewAPIError(http.StatusUnauthorized, ErrorCodeUnauthorized, "Invalid or revoked api key")
+	}
+	if err != nil {
+		return structs.ApiKey{}, 0, Unavailable("Failed to check the api key", err)
+	}
+
+	if apiKey.QuotaPerDay == 0 {
+		return apiKey, 0, nil
+	}
+
+	remaining, ok := apiKeyQuotas.Use(apiKey.ID, apiKey.QuotaPerDay, now)
+	if !ok {
+		return apiKey, 0, NewAPIError(http.StatusTooManyRequests, ErrorCodeRateLimited, "Daily quota of the api key exceeded")
+	}
+	return apiKey, remaining, nil
+}
+
+// RequireRole only lets requests through whose api key has at least the given role
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			current := RoleOf(c)
+			if current == structs.RolePublic {
+				return NewAPIError(http.StatusUnauthorized, ErrorCodeUnauthorized, "An api key is required")
+			}
+			if !HasRole(current, role) {
+				return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "The api key is missing the role "+role)
+			}
+			return next(c)
+		}
+	}
+}
+
+func RoleOf(c echo.Context) string {
+	role, ok := c.Get("role").(string)
+	if !ok {
+		return structs.RolePublic
+	}
+	return role
+}
+
+// isTrustedReporter is true for the Telegram bot and partner apps, which skip the abuse protection
+func isTrustedReporter(c echo.Context) bool {
+	return HasRole(RoleOf(c), structs.RoleReporter)
+}
+
+type quotaUsage struct {
+	day   string
+	count int
+}
+
+// QuotaTracker counts the requests of each api key per day (UTC)
+type QuotaTracker struct {
+	mu    sync.Mutex
+	usage map[string]quotaUsage
+}
+
+func NewQuotaTracker() *QuotaTracker {
+	return &QuotaTracker{usage: make(map[string]quotaUsage)}
+}
+
+// Use counts a request and returns the remaining requests and whether the quota allowed it
+func (q *QuotaTracker) Use(keyID string, quota int, now time.Time) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := now.UTC().Format(time.DateOnly)
+	usage := q.usage[keyID]
+	if usage.day != day {
+		usage = quotaUsage{day: day}
+	}
+
+	if usage.count >= quota {
+		return 0, false
+	}
+
+	usage.count++
+	q.usage[keyID] = usage
+	return quota - usage.count, true
+}
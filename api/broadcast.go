@@ -0,0 +1,433 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultBroadcastBatchSeconds = 60
+	broadcastTimeout             = 10 * time.Second
+	// Longer statuses are rejected by most Mastodon instances
+	mastodonMaxLength = 500
+	// Number of sent messages per channel that are deleted when one of their reports is hidden
+	maxSentMessages = 100
+)
+
+// Default templates of the channels, they are executed with a structs.BroadcastBatch
+const (
+	DefaultMatrixTemplate = `{{range .Sightings}}Ticket inspectors at {{.Station.Name}}{{if .Line}}, {{.Line}}{{end}}{{if .Direction.Name}} towards {{.Direction.Name}}{{end}} ({{clock .Timestamp}})
+{{end}}`
+	DefaultMastodonTemplate = `{{if eq (len .Sightings) 1}}{{with index .Sightings 0}}Ticket inspectors at {{.Station.Name}}{{if .Line}}, {{.Line}}{{end}}{{if .Direction.Name}} towards {{.Direction.Name}}{{end}} ({{clock .Timestamp}}){{end}}{{else}}{{len .Sightings}} new sightings:
+{{range .Sightings}}- {{.Station.Name}}{{if .Line}} {{.Line}}{{end}} ({{clock .Timestamp}})
+{{end}}{{end}}
+#FreiFahren #Berlin`
+	DefaultFeedTemplate = `{{range .Sightings}}Ticket inspectors at {{.Station.Name}}{{if .Line}}, {{.Line}}{{end}}{{if .Direction.Name}} towards {{.Direction.Name}}{{end}} at {{clock .Timestamp}}.
+{{end}}`
+)
+
+// Broadcasts publishes the new sightings to Matrix and Mastodon
+var Broadcasts = NewBroadcastHub()
+
+// Broadcaster publishes a batch of sightings to a channel
+type Broadcaster interface {
+	Name() string
+	Broadcast(ctx context.Context, batch structs.BroadcastBatch) error
+}
+
+// Retracter is a Broadcaster that can delete its messages mentioning a hidden report
+type Retracter interface {
+	Broadcaster
+	Retract(ctx context.Context, report structs.Report) error
+}
+
+// BroadcastHub collects the sightings of every broadcaster during its batch window,
+// so a wave of reports becomes a single message instead of flooding the channel
+type BroadcastHub struct {
+	mu       sync.Mutex
+	channels []*broadcastChannel
+}
+
+type broadcastChannel struct {
+	broadcaster Broadcaster
+	window      time.Duration
+	pending     []structs.TicketInspector
+	timer       *time.Timer
+}
+
+func NewBroadcastHub() *BroadcastHub {
+	return &BroadcastHub{}
+}
+
+// Register adds a broadcaster, a window of 0 broadcasts every sighting on its own
+func (h *BroadcastHub) Register(broadcaster Broadcaster, window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.channels = append(h.channels, &broadcastChannel{broadcaster: broadcaster, window: window})
+}
+
+// Publish adds the sighting to the batch of every broadcaster, the batch is sent when the window of its first sighting ends
+func (h *BroadcastHub) Publish(sighting structs.TicketInspector) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, channel := range h.channels {
+		if channel.window <= 0 {
+			go broadcast(channel.broadcaster, []structs.TicketInspector{sighting})
+			continue
+		}
+
+		channel.pending = append(channel.pending, sighting)
+		if channel.timer == nil {
+			channel.timer = time.AfterFunc(channel.window, func() { h.flush(channel) })
+		}
+	}
+}
+
+// Flush sends the pending batches right away and waits until they are sent
+func (h *BroadcastHub) Flush() {
+	h.mu.Lock()
+	channels := h.channels
+	h.mu.Unlock()
+
+	for _, channel := range channels {
+		h.flush(channel)
+	}
+}
+
+func (h *BroadcastHub) flush(channel *broadcastChannel) {
+	h.mu.Lock()
+	sightings := channel.pending
+	channel.pending = nil
+	if channel.timer != nil {
+		channel.timer.Stop()
+		channel.timer = nil
+	}
+	h.mu.Unlock()
+
+	if len(sightings) > 0 {
+		broadcast(channel.broadcaster, sightings)
+	}
+}
+
+// Retract drops the sightings of a hidden report from the pending batches and deletes the messages that already mention it
+func (h *BroadcastHub) Retract(report structs.Report) {
+	h.mu.Lock()
+	var retracters []Retracter
+	for _, channel := range h.channels {
+		channel.pending = slices.DeleteFunc(channel.pending, func(sighting structs.TicketInspector) bool {
+			return isSightingOf(sighting, report)
+		})
+		if len(channel.pending) == 0 && channel.timer != nil {
+			channel.timer.Stop()
+			channel.timer = nil
+		}
+		if retracter, ok := channel.broadcaster.(Retracter); ok {
+			retracters = append(retracters, retracter)
+		}
+	}
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), broadcastTimeout)
+	defer cancel()
+
+	for _, retracter := range retracters {
+		if err := retracter.Retract(ctx, report); err != nil {
+			slog.Warn("Failed to delete the messages of a hidden report", "channel", retracter.Name(), "report", report.ID, "error", err)
+		}
+	}
+}
+
+// isSightingOf checks if the sighting was published for the report,
+// the time of the report was stored in local time without a zone and rounded to microseconds
+func isSightingOf(sighting structs.TicketInspector, report structs.Report) bool {
+	if report.StationID == nil || sighting.Station.ID != *report.StationID {
+		return false
+	}
+	difference := sighting.Timestamp.Sub(localTime(report.Timestamp))
+	return difference > -time.Microsecond && difference < time.Microsecond
+}
+
+func broadcast(broadcaster Broadcaster, sightings []structs.TicketInspector) {
+	ctx, cancel := context.WithTimeout(context.Background(), broadcastTimeout)
+	defer cancel()
+
+	if err := broadcaster.Broadcast(ctx, structs.BroadcastBatch{Sightings: sightings}); err != nil {
+		slog.Warn("Failed to broadcast sightings", "channel", broadcaster.Name(), "sightings", len(sightings), "error", err)
+	}
+}
+
+// InitBroadcasts sets up the feed and registers the channels configured in the environment.
+// It has to be called after the .env file has been loaded.
+func InitBroadcasts() {
+	feedTemplate, err := ParseBroadcastTemplate(envOr("FEED_TEMPLATE", DefaultFeedTemplate))
+	if err != nil {
+		slog.Error("Invalid FEED_TEMPLATE, using the default", "error", err)
+		feedTemplate, _ = ParseBroadcastTemplate(DefaultFeedTemplate)
+	}
+	Feed = NewSightingFeed(feedTemplate, envOr("PUBLIC_URL", defaultPublicURL))
+
+	hub := NewBroadcastHub()
+
+	window := time.Duration(envInt("BROADCAST_BATCH_SECONDS", defaultBroadcastBatchSeconds)) * time.Second
+	client := &http.Client{Timeout: broadcastTimeout}
+
+	if os.Getenv("MATRIX_ACCESS_TOKEN") != "" {
+		tmpl, err := ParseBroadcastTemplate(envOr("MATRIX_TEMPLATE", DefaultMatrixTemplate))
+		if err != nil {
+			slog.Error("Matrix broadcasts are disabled, invalid MATRIX_TEMPLATE", "error", err)
+		} else {
+			hub.Register(NewMatrixBroadcaster(os.Getenv("MATRIX_HOMESERVER"), os.Getenv("MATRIX_ROOM_ID"), os.Getenv("MATRIX_ACCESS_TOKEN"), tmpl, client), window)
+		}
+	}
+
+	if os.Getenv("MASTODON_ACCESS_TOKEN") != "" {
+		tmpl, err := ParseBroadcastTemplate(envOr("MASTODON_TEMPLATE", DefaultMastodonTemplate))
+		if err != nil {
+			slog.Error("Mastodon broadcasts are disabled, invalid MASTODON_TEMPLATE", "error", err)
+		} else {
+			hub.Register(NewMastodonBroadcaster(os.Getenv("MASTODON_URL"), os.Getenv("MASTODON_ACCESS_TOKEN"), tmpl, client), window)
+		}
+	}
+
+	Broadcasts = hub
+}
+
+// ParseBroadcastTemplate parses a text/template for a structs.BroadcastBatch.
+// Besides the builtin functions it can use clock to format a time like 14:05.
+func ParseBroadcastTemplate(text string) (*template.Template, error) {
+	return template.New("broadcast").Funcs(template.FuncMap{
+		"clock": func(t time.Time) string { return t.Local().Format(windowTimeFormat) },
+	}).Parse(text)
+}
+
+func renderBroadcast(tmpl *template.Template, batch structs.BroadcastBatch) (string, error) {
+	var text strings.Builder
+	if err := tmpl.Execute(&text, batch); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// sentMessages remembers the ids of the latest messages of a channel with their sightings.
+// They are kept in memory, so messages sent before a restart can't be deleted.
+type sentMessages struct {
+	mu       sync.Mutex
+	messages []sentMessage
+}
+
+type sentMessage struct {
+	id        string
+	sightings []structs.TicketInspector
+}
+
+func (s *sentMessages) add(id string, sightings []structs.TicketInspector) {
+	if id == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, sentMessage{id: id, sightings: sightings})
+	if len(s.messages) > maxSentMessages {
+		s.messages = s.messages[len(s.messages)-maxSentMessages:]
+	}
+}
+
+// take forgets the messages mentioning the report and returns their ids
+func (s *sentMessages) take(report structs.Report) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	s.messages = slices.DeleteFunc(s.messages, func(message sentMessage) bool {
+		mentioned := slices.ContainsFunc(message.sightings, func(sighting structs.TicketInspector) bool {
+			return isSightingOf(sighting, report)
+		})
+		if mentioned {
+			ids = append(ids, message.id)
+		}
+		return mentioned
+	})
+	return ids
+}
+
+// MatrixBroadcaster sends the batches as text messages to a Matrix room
+type MatrixBroadcaster struct {
+	homeserver  string
+	roomID      string
+	accessToken string
+	template    *template.Template
+	client      *http.Client
+	sent        sentMessages
+}
+
+func NewMatrixBroadcaster(homeserver, roomID, accessToken string, tmpl *template.Template, client *http.Client) *MatrixBroadcaster {
+	return &MatrixBroadcaster{homeserver: strings.TrimRight(homeserver, "/"), roomID: roomID, accessToken: accessToken, template: tmpl, client: client}
+}
+
+func (m *MatrixBroadcaster) Name() string {
+	return "matrix"
+}
+
+func (m *MatrixBroadcaster) Broadcast(ctx context.Context, batch structs.BroadcastBatch) error {
+	text, err := renderBroadcast(m.template, batch)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"msgtype": "m.text", "body": text})
+	if err != nil {
+		return err
+	}
+
+	// The transaction id makes retries of the same message idempotent
+	transactionID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.homeserver, url.PathEscape(m.roomID), transactionID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	var sent struct {
+		EventID string `json:"event_id"`
+	}
+	if err := sendBroadcast(m.client, req, m.accessToken, &sent); err != nil {
+		return err
+	}
+	m.sent.add(sent.EventID, batch.Sightings)
+	return nil
+}
+
+// Retract redacts the messages mentioning the report
+func (m *MatrixBroadcaster) Retract(ctx context.Context, report structs.Report) error {
+	var errs []error
+	for _, eventID := range m.sent.take(report) {
+		transactionID, err := newUUID()
+		if err != nil {
+			return err
+		}
+		endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/redact/%s/%s", m.homeserver, url.PathEscape(m.roomID), url.PathEscape(eventID), transactionID)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, strings.NewReader(`{"reason":"The report was hidden"}`))
+		if err != nil {
+			return err
+		}
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		errs = append(errs, sendBroadcast(m.client, req, m.accessToken, nil))
+	}
+	return errors.Join(errs...)
+}
+
+// MastodonBroadcaster posts the batches as statuses of a Mastodon account
+type MastodonBroadcaster struct {
+	instance    string
+	accessToken string
+	template    *template.Template
+	client      *http.Client
+	sent        sentMessages
+}
+
+func NewMastodonBroadcaster(instance, accessToken string, tmpl *template.Template, client *http.Client) *MastodonBroadcaster {
+	return &MastodonBroadcaster{instance: strings.TrimRight(instance, "/"), accessToken: accessToken, template: tmpl, client: client}
+}
+
+func (m *MastodonBroadcaster) Name() string {
+	return "mastodon"
+}
+
+func (m *MastodonBroadcaster) Broadcast(ctx context.Context, batch structs.BroadcastBatch) error {
+	text, err := renderBroadcast(m.template, batch)
+	if err != nil {
+		return err
+	}
+	if runes := []rune(text); len(runes) > mastodonMaxLength {
+		text = string(runes[:mastodonMaxLength-1]) + "…"
+	}
+
+	idempotencyKey, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{"status": {text}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.instance+"/api/v1/statuses", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	var status struct {
+		ID string `json:"id"`
+	}
+	if err := sendBroadcast(m.client, req, m.accessToken, &status); err != nil {
+		return err
+	}
+	m.sent.add(status.ID, batch.Sightings)
+	return nil
+}
+
+// Retract deletes the statuses mentioning the report
+func (m *MastodonBroadcaster) Retract(ctx context.Context, report structs.Report) error {
+	var errs []error
+	for _, id := range m.sent.take(report) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, m.instance+"/api/v1/statuses/"+url.PathEscape(id), nil)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, sendBroadcast(m.client, req, m.accessToken, nil))
+	}
+	return errors.Join(errs...)
+}
+
+// sendBroadcast sends the request and decodes the answer into result, unless it is nil
+func sendBroadcast(client *http.Client, req *http.Request, accessToken string, result any) error {
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+accessToken)
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("responded with %d", response.StatusCode)
+	}
+
+	// Without an answer the id of the message is unknown, it just can't be deleted then
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	return nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
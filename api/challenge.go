@@ -0,0 +1,197 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Headers used by the client to answer a challenge when posting a report
+const (
+	ChallengeHeader         = "X-Challenge"
+	ChallengeSolutionHeader = "X-Challenge-Solution"
+)
+
+const (
+	// Only a signed challenge fetched from /challenge has to be sent back
+	ChallengeModeToken = "token"
+	// Additionally a proof of work has to be solved for the challenge
+	ChallengeModeProofOfWork = "pow"
+
+	defaultChallengeDifficulty = 18
+	challengeLifetime          = 5 * time.Minute
+)
+
+var (
+	challengeMode       string
+	challengeDifficulty = defaultChallengeDifficulty
+	challengeSecret     []byte
+
+	// Challenges that have already been used, so that one solution can't be replayed
+	usedChallenges      = make(map[string]time.Time)
+	usedChallengesMutex sync.Mutex
+)
+
+func initChallenge() {
+	challengeMode = os.Getenv("REPORT_CHALLENGE")
+	challengeDifficulty = envInt("CHALLENGE_DIFFICULTY", defaultChallengeDifficulty)
+
+	challengeSecret = []byte(os.Getenv("CHALLENGE_SECRET"))
+	if len(challengeSecret) == 0 {
+		// Without a configured secret, challenges are only valid until the next restart
+		challengeSecret = make([]byte, 32)
+		if _, err := rand.Read(challengeSecret); err != nil {
+			slog.Error("Failed to generate challenge secret", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if challengeMode != "" && challengeMode != ChallengeModeToken && challengeMode != ChallengeModeProofOfWork {
+		slog.Error("Unknown REPORT_CHALLENGE mode", "mode", challengeMode)
+		os.Exit(1)
+	}
+}
+
+// GetChallenge hands out a signed challenge that has to be sent along with the next report
+func GetChallenge(c echo.Context) error {
+	if challengeMode == "" {
+		return NotFound("Challenges are disabled")
+	}
+
+	challenge, expiresAt, err := NewChallenge(challengeSecret, time.Now())
+	if err != nil {
+		return Internal(err)
+	}
+
+	difficulty := 0
+	if challengeMode == ChallengeModeProofOfWork {
+		difficulty = challengeDifficulty
+	}
+
+	return c.JSON(http.StatusOK, structs.ChallengeResponse{
+		Challenge:  challenge,
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+	})
+}
+
+// RequireChallenge rejects reports that don't answer a valid challenge,
+// it does nothing if no challenge mode is configured or for trusted reporters.
+func RequireChallenge(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if challengeMode == "" || isTrustedReporter(c) {
+			return next(c)
+		}
+
+		challenge := c.Request().Header.Get(ChallengeHeader)
+		if err := VerifyChallenge(challengeSecret, challenge, time.Now()); err != nil {
+			return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, err.Error())
+		}
+
+		if challengeMode == ChallengeModeProofOfWork {
+			solution := c.Request().Header.Get(ChallengeSolutionHeader)
+			if !SolvesProofOfWork(challenge, solution, challengeDifficulty) {
+				return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "Invalid challenge solution")
+			}
+		}
+
+		if !markChallengeUsed(challenge, time.Now()) {
+			return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "Challenge has already been used")
+		}
+
+		return next(c)
+	}
+}
+
+// NewChallenge creates a challenge of the form nonce.expiry.signature
+func NewChallenge(secret []byte, now time.Time) (string, time.Time, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	expiresAt := now.Add(challengeLifetime)
+	payload := hex.EncodeToString(nonce) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return payload + "." + signChallenge(secret, payload), expiresAt, nil
+}
+
+// VerifyChallenge checks that the challenge was issued by us and hasn't expired yet
+func VerifyChallenge(secret []byte, challenge string, now time.Time) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("missing or malformed challenge")
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(signChallenge(secret, payload)), []byte(parts[2])) {
+		return fmt.Errorf("invalid challenge signature")
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed challenge expiry")
+	}
+	if now.After(time.Unix(expiry, 0)) {
+		return fmt.Errorf("challenge has expired")
+	}
+
+	return nil
+}
+
+// SolvesProofOfWork checks that sha256(challenge + solution) starts with at least difficulty zero bits
+func SolvesProofOfWork(challenge, solution string, difficulty int) bool {
+	if solution == "" {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(challenge + solution))
+
+	zeroBits := 0
+	for _, b := range hash {
+		zeroBits += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+
+	return zeroBits >= difficulty
+}
+
+func signChallenge(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// markChallengeUsed returns false if the challenge was already used before
+func markChallengeUsed(challenge string, now time.Time) bool {
+	usedChallengesMutex.Lock()
+	defer usedChallengesMutex.Unlock()
+
+	// Expired challenges are rejected anyway, so we don't need to remember them
+	for usedChallenge, usedAt := range usedChallenges {
+		if now.Sub(usedAt) > challengeLifetime {
+			delete(usedChallenges, usedChallenge)
+		}
+	}
+
+	if _, used := usedChallenges[challenge]; used {
+		return false
+	}
+	usedChallenges[challenge] = now
+	return true
+}
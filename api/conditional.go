@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ETagOf returns a strong ETag for the body
+func ETagOf(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// ParseHTTPDate parses the date formats of RFC 7231 that clients send in If-Modified-Since,
+// RFC3339 is accepted as well for the clients built for the earlier versions of /recent
+func ParseHTTPDate(value string) (time.Time, bool) {
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// NotModified evaluates If-None-Match and If-Modified-Since like RFC 7232.
+// If-Modified-Since is only used without If-None-Match, invalid dates are ignored.
+func NotModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && etagMatches(ifNoneMatch, etag)
+	}
+
+	ifModifiedSince, ok := ParseHTTPDate(req.Header.Get(echo.HeaderIfModifiedSince))
+	if !ok || lastModified.IsZero() {
+		return false
+	}
+	// HTTP dates have no fractions of a second
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// etagMatches compares with the weak comparison of RFC 7232, which If-None-Match uses
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func setLastModified(c echo.Context, lastModified time.Time) {
+	if !lastModified.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// conditionalBlob sends the body with its ETag and Last-Modified, or 304 if the client has it already
+func conditionalBlob(c echo.Context, contentType string, body []byte, lastModified time.Time) error {
+	etag := ETagOf(body)
+	c.Response().Header().Set("ETag", etag)
+	setLastModified(c, lastModified)
+
+	if NotModified(c.Request(), etag, lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, contentType, body)
+}
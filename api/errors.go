@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Error codes of the error envelope, clients should rely on these instead of the message
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeValidationFailed = "validation_failed"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeUnavailable      = "service_unavailable"
+	ErrorCodeInternal         = "internal_error"
+)
+
+// APIError is returned by the handlers and rendered as error envelope by HTTPErrorHandler
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	// RetryAfter is sent as Retry-After header if it is set, in seconds
+	RetryAfter int
+	// Internal is logged but never sent to the client
+	Internal error
+}
+
+func (e *APIError) Error() string {
+	if e.Internal != nil {
+		return e.Message + ": " + e.Internal.Error()
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Internal
+}
+
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+func (e *APIError) WithInternal(err error) *APIError {
+	e.Internal = err
+	return e
+}
+
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func InvalidRequest(message string) *APIError {
+	return NewAPIError(http.StatusBadRequest, ErrorCodeInvalidRequest, message)
+}
+
+// ValidationFailed is used for well formed requests with invalid values, e.g. unknown station names
+func ValidationFailed(message string) *APIError {
+	return NewAPIError(http.StatusUnprocessableEntity, ErrorCodeValidationFailed, message)
+}
+
+func NotFound(message string) *APIError {
+	return NewAPIError(http.StatusNotFound, ErrorCodeNotFound, message)
+}
+
+// Seconds clients are asked to wait when all database connections are in use
+const poolExhaustedRetryAfter = 1
+
+// Seconds clients are asked to wait while another export is running
+const exportRunningRetryAfter = 60
+
+// Unavailable is used when the database or the station data can't be accessed.
+// If every database connection was busy, the client is asked to retry shortly instead.
+func Unavailable(message string, err error) *APIError {
+	if errors.Is(err, database.ErrPoolExhausted) {
+		apiError := NewAPIError(http.StatusServiceUnavailable, ErrorCodeUnavailable, "The server is busy, please try again shortly").WithInternal(err)
+		apiError.RetryAfter = poolExhaustedRetryAfter
+		return apiError
+	}
+	if errors.Is(err, database.ErrExportRunning) {
+		apiError := NewAPIError(http.StatusServiceUnavailable, ErrorCodeUnavailable, "Another export is running, please try again later").WithInternal(err)
+		apiError.RetryAfter = exportRunningRetryAfter
+		return apiError
+	}
+	return NewAPIError(http.StatusServiceUnavailable, ErrorCodeUnavailable, message).WithInternal(err)
+}
+
+func Internal(err error) *APIError {
+	return NewAPIError(http.StatusInternalServerError, ErrorCodeInternal, "Internal server error").WithInternal(err)
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            ErrorCodeInvalidRequest,
+	http.StatusUnauthorized:          ErrorCodeUnauthorized,
+	http.StatusForbidden:             ErrorCodeForbidden,
+	http.StatusNotFound:              ErrorCodeNotFound,
+	http.StatusMethodNotAllowed:      ErrorCodeInvalidRequest,
+	http.StatusRequestEntityTooLarge: ErrorCodeInvalidRequest,
+	http.StatusUnprocessableEntity:   ErrorCodeValidationFailed,
+	http.StatusTooManyRequests:       ErrorCodeRateLimited,
+	http.StatusServiceUnavailable:    ErrorCodeUnavailable,
+}
+
+// HTTPErrorHandler renders every error returned by a handler or middleware as error envelope
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var apiError *APIError
+	var httpError *echo.HTTPError
+
+	switch {
+	case errors.As(err, &apiError):
+	case errors.As(err, &httpError):
+		// Errors of echo itself and its middlewares, e.g. unknown routes or the rate limiter
+		code, ok := statusCodes[httpError.Code]
+		if !ok {
+			code = ErrorCodeInternal
+		}
+		message, ok := httpError.Message.(string)
+		if !ok {
+			message = http.StatusText(httpError.Code)
+		}
+		apiError = NewAPIError(httpError.Code, code, message).WithInternal(httpError.Internal)
+	default:
+		apiError = Internal(err)
+	}
+
+	// Queries cancelled because the client went away are not worth an error log
+	clientGone := errors.Is(err, context.Canceled) && c.Request().Context().Err() != nil
+	if apiError.Status >= http.StatusInternalServerError && !clientGone {
+		slog.ErrorContext(c.Request().Context(), "Error handling request", "method", c.Request().Method, "path", c.Request().URL.Path, "error", apiError)
+	}
+
+	if apiError.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(apiError.RetryAfter))
+	}
+
+	response := structs.ErrorResponse{
+		Code:      apiError.Code,
+		Message:   apiError.Message,
+		Details:   apiError.Details,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiError.Status)
+	} else {
+		err = c.JSON(apiError.Status, response)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "Failed to send error response", "error", err)
+	}
+}
+
+// Deprecated marks routes that are only kept as aliases for the /v1 routes
+func Deprecated(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Deprecation", "true")
+		c.Response().Header().Set("Link", "</v1"+c.Request().URL.Path+`>; rel="successor-version"`)
+		return next(c)
+	}
+}
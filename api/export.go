@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatJSONL   = "jsonl"
+	ExportFormatParquet = "parquet"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:     "text/csv",
+	ExportFormatJSONL:   "application/jsonl",
+	ExportFormatParquet: "application/vnd.apache.parquet",
+}
+
+// Columns of the CSV export, named like the Parquet columns
+var exportColumns = []string{
+	"id", "timestamp", "message", "author", "line", "station_id", "station_name",
+	"station_latitude", "station_longitude", "station_lines", "direction_id", "direction_name",
+}
+
+// ExportWriter writes the reports in one of the export formats, Close has to be called after the last report
+type ExportWriter interface {
+	Write(row structs.ExportRow) error
+	Close() error
+}
+
+func IsValidExportFormat(format string) bool {
+	_, ok := exportContentTypes[format]
+	return ok
+}
+
+// ExportReports writes all visible reports in the filter's time range with their resolved stations.
+// Anonymized exports leave out the message and the author.
+func ExportReports(ctx context.Context, w io.Writer, format string, filter structs.AggregationFilter, anonymized bool) error {
+	stations, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return fmt.Errorf("failed to read the stations: %w", err)
+	}
+
+	writer, err := NewExportWriter(format, w)
+	if err != nil {
+		return err
+	}
+
+	err = database.StreamReports(ctx, filter, func(row structs.ExportRow) error {
+		if anonymized {
+			row.Message, row.Author = nil, nil
+		}
+
+		if row.StationID != nil {
+			if station, ok := stations[*row.StationID]; ok {
+				row.StationName = &station.Name
+				row.StationLatitude = &station.Coordinates.Latitude
+				row.StationLongitude = &station.Coordinates.Longitude
+				row.StationLines = station.Lines
+			}
+		}
+
+		return writer.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// Export streams the reports as CSV, JSON Lines or Parquet.
+// Only admins can export the messages and authors with anonymized=false.
+func Export(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if !IsValidExportFormat(format) {
+		return ValidationFailed("'format' must be csv, jsonl or parquet").WithDetails(map[string]string{"field": "format", "value": format})
+	}
+
+	var filter structs.AggregationFilter
+	var err error
+	if filter.From, err = parseOptionalTime(c.QueryParam("from")); err != nil {
+		return ValidationFailed("Invalid 'from' time, expected RFC3339").WithDetails(map[string]string{"field": "from", "value": c.QueryParam("from")})
+	}
+	if filter.To, err = parseOptionalTime(c.QueryParam("to")); err != nil {
+		return ValidationFailed("Invalid 'to' time, expected RFC3339").WithDetails(map[string]string{"field": "to", "value": c.QueryParam("to")})
+	}
+	// The reports are stored in local time
+	filter.From, filter.To = filter.From.Local(), filter.To.Local()
+
+	anonymized := true
+	if value := c.QueryParam("anonymized"); value != "" {
+		if anonymized, err = strconv.ParseBool(value); err != nil {
+			return ValidationFailed("'anonymized' must be true or false").WithDetails(map[string]string{"field": "anonymized", "value": value})
+		}
+	}
+	if !anonymized && !HasRole(RoleOf(c), structs.RoleAdmin) {
+		return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "Only admins can export the messages and authors")
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, exportContentTypes[format])
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="ticket_info.%s"`, format))
+
+	// The status is only sent with the first row, so errors before it are still returned as error envelope
+	err = ExportReports(c.Request().Context(), c.Response(), format, filter, anonymized)
+	if err != nil && c.Response().Committed {
+		slog.ErrorContext(c.Request().Context(), "Export failed after it started", "error", err)
+		return nil
+	}
+	if err != nil {
+		return Unavailable("Failed to export the reports", err)
+	}
+	return nil
+}
+
+func NewExportWriter(format string, w io.Writer) (ExportWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{writer: writer}, nil
+	case ExportFormatJSONL:
+		return &jsonlExportWriter{encoder: json.NewEncoder(w)}, nil
+	case ExportFormatParquet:
+		return &parquetExportWriter{writer: parquet.NewGenericWriter[structs.ExportRow](w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) Write(row structs.ExportRow) error {
+	return w.writer.Write([]string{
+		row.ID,
+		row.Timestamp.Format(time.RFC3339Nano),
+		valueOrEmpty(row.Message),
+		valueOrEmpty(row.Author),
+		valueOrEmpty(row.Line),
+		valueOrEmpty(row.StationID),
+		valueOrEmpty(row.StationName),
+		valueOrEmpty(row.StationLatitude),
+		valueOrEmpty(row.StationLongitude),
+		strings.Join(row.StationLines, ","),
+		valueOrEmpty(row.DirectionID),
+		valueOrEmpty(row.DirectionName),
+	})
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonlExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlExportWriter) Write(row structs.ExportRow) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonlExportWriter) Close() error {
+	return nil
+}
+
+type parquetExportWriter struct {
+	writer *parquet.GenericWriter[structs.ExportRow]
+}
+
+func (w *parquetExportWriter) Write(row structs.ExportRow) error {
+	_, err := w.writer.Write([]structs.ExportRow{row})
+	return err
+}
+
+func (w *parquetExportWriter) Close() error {
+	return w.writer.Close()
+}
+
+func valueOrEmpty[T any](value *T) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(*value)
+}
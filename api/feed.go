@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MIMEAtom = "application/atom+xml"
+	// Number of the latest sightings in the feed
+	feedSize  = 50
+	feedTitle = "FreiFahren sightings"
+	// The address the api is reached at if PUBLIC_URL isn't set
+	defaultPublicURL = "http://localhost:8080"
+)
+
+// Feed renders the latest sightings for /feed.xml
+var Feed = NewSightingFeed(template.Must(ParseBroadcastTemplate(DefaultFeedTemplate)), defaultPublicURL)
+
+// SightingFeed renders the latest visible reports as entries of an Atom feed,
+// so hidden reports are left out as soon as they are hidden
+type SightingFeed struct {
+	template *template.Template
+	// self is the url of the feed, its host makes the ids of the entries unique
+	self string
+	host string
+}
+
+// NewSightingFeed returns a feed served below publicURL, e.g. https://api.freifahren.org
+func NewSightingFeed(tmpl *template.Template, publicURL string) *SightingFeed {
+	publicURL = strings.TrimRight(publicURL, "/")
+	host := publicURL
+	if parsed, err := url.Parse(publicURL); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	return &SightingFeed{template: tmpl, self: publicURL + "/v1/feed.xml", host: host}
+}
+
+// Atom returns the feed document of the sightings, they have to be ordered newest first
+func (f *SightingFeed) Atom(sightings []structs.TicketInspector, now time.Time) (structs.AtomFeed, error) {
+	feed := structs.AtomFeed{
+		ID:      f.self,
+		Title:   feedTitle,
+		Updated: now.Format(time.RFC3339),
+		Links:   []structs.AtomLink{{Href: f.self, Rel: "self"}},
+		Entries: []structs.AtomEntry{},
+	}
+
+	for _, sighting := range sightings {
+		sighting.Timestamp = localTime(sighting.Timestamp)
+		text, err := renderBroadcast(f.template, structs.BroadcastBatch{Sightings: []structs.TicketInspector{sighting}})
+		if err != nil {
+			return structs.AtomFeed{}, err
+		}
+
+		feed.Entries = append(feed.Entries, structs.AtomEntry{
+			// Tag URIs stay the same on every request, feed readers use them to recognize the entries they have seen
+			ID:      fmt.Sprintf("tag:%s,%s:sighting/%s/%d", f.host, sighting.Timestamp.Format(openDataDateFormat), sighting.Station.ID, sighting.Timestamp.UnixMicro()),
+			Title:   "Ticket inspectors at " + sighting.Station.Name,
+			Updated: sighting.Timestamp.Format(time.RFC3339),
+			Author:  structs.AtomAuthor{Name: "FreiFahren"},
+			Content: structs.AtomContent{Type: "text", Text: text},
+		})
+	}
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	}
+	return feed, nil
+}
+
+// GetFeed returns the latest visible sightings as Atom feed
+func GetFeed(c echo.Context) error {
+	ticketInfoList, err := Reports.GetLatestSightings(c.Request().Context(), feedSize)
+	if err != nil {
+		return Unavailable("Failed to get the latest sightings", err)
+	}
+
+	sightings, err := constructTicketInspectors(ticketInfoList)
+	if err != nil {
+		return err
+	}
+
+	atom, err := Feed.Atom(sightings, time.Now())
+	if err != nil {
+		return Internal(err)
+	}
+
+	encoded, err := xml.MarshalIndent(atom, "", "  ")
+	if err != nil {
+		return Internal(err)
+	}
+
+	return c.Blob(http.StatusOK, MIMEAtom+"; charset=utf-8", append([]byte(xml.Header), encoded...))
+}
+
+// localTime reads the wall clock of a TIMESTAMP column, the reports are stored in local time without a zone
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
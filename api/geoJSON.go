@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEApplicationGeoJSON = "application/geo+json"
+
+// wantsGeoJSON is true for ?format=geojson or Accept: application/geo+json
+func wantsGeoJSON(c echo.Context) bool {
+	// Caches have to keep the JSON and GeoJSON responses apart
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	return isGeoJSONRequest(c)
+}
+
+// isGeoJSONRequest is wantsGeoJSON without the Vary header, for choosing the response before the handler runs
+func isGeoJSONRequest(c echo.Context) bool {
+	if c.QueryParam("format") == "geojson" {
+		return true
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), MIMEApplicationGeoJSON)
+}
+
+func geoJSONResponse(c echo.Context, collection structs.FeatureCollection) error {
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return Internal(err)
+	}
+	return c.Blob(http.StatusOK, MIMEApplicationGeoJSON, data)
+}
+
+func newFeatureCollection() structs.FeatureCollection {
+	return structs.FeatureCollection{Type: "FeatureCollection", Features: []structs.Feature{}}
+}
+
+func point(coordinates structs.Coordinates) structs.Geometry {
+	return structs.Geometry{Type: "Point", Coordinates: []float64{coordinates.Longitude, coordinates.Latitude}}
+}
+
+// StationFeatures returns a point for every station, sorted by id
+func StationFeatures(stations map[string]structs.StationListEntry) []structs.Feature {
+	ids := make([]string, 0, len(stations))
+	for id := range stations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	features := make([]structs.Feature, 0, len(ids))
+	for _, id := range ids {
+		station := stations[id]
+		features = append(features, structs.Feature{
+			Type:     "Feature",
+			ID:       id,
+			Geometry: point(structs.Coordinates{Latitude: station.Coordinates.Latitude, Longitude: station.Coordinates.Longitude}),
+			Properties: map[string]interface{}{
+				"kind":  "station",
+				"name":  station.Name,
+				"lines": station.Lines,
+			},
+		})
+	}
+	return features
+}
+
+// LineFeatures returns a line string through the ordered stations of every line, sorted by name.
+// Stations without coordinates are left out.
+func LineFeatures(lines map[string][]string, stations map[string]structs.StationListEntry) []structs.Feature {
+	names := make([]string, 0, len(lines))
+	for name := range lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	features := make([]structs.Feature, 0, len(names))
+	for _, name := range names {
+		coordinates := [][]float64{}
+		for _, id := range lines[name] {
+			if station, ok := stations[id]; ok {
+				coordinates = append(coordinates, []float64{station.Coordinates.Longitude, station.Coordinates.Latitude})
+			}
+		}
+
+		features = append(features, structs.Feature{
+			Type:     "Feature",
+			ID:       name,
+			Geometry: structs.Geometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]interface{}{
+				"kind":     "line",
+				"name":     name,
+				"stations": lines[name],
+			},
+		})
+	}
+	return features
+}
+
+// SightingFeatures returns a point at the station of every sighting
+func SightingFeatures(ticketInspectors []structs.TicketInspector) []structs.Feature {
+	features := make([]structs.Feature, 0, len(ticketInspectors))
+	for _, ticketInspector := range ticketInspectors {
+		var direction interface{}
+		if ticketInspector.Direction.ID != "" {
+			direction = map[string]string{"id": ticketInspector.Direction.ID, "name": ticketInspector.Direction.Name}
+		}
+
+		features = append(features, structs.Feature{
+			Type:     "Feature",
+			ID:       ticketInspector.Station.ID,
+			Geometry: point(ticketInspector.Station.Coordinates),
+			Properties: map[string]interface{}{
+				"kind":       "sighting",
+				"station":    map[string]string{"id": ticketInspector.Station.ID, "name": ticketInspector.Station.Name},
+				"timestamp":  ticketInspector.Timestamp,
+				"line":       ticketInspector.Line,
+				"direction":  direction,
+				"isHistoric": ticketInspector.IsHistoric,
+			},
+		})
+	}
+	return features
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"log"
 	"net/http"
 
 	"encoding/json"
@@ -13,16 +12,17 @@ import (
 )
 
 func GetAllStationsAndLines(c echo.Context) error {
-	var StationsAndLinesList types.AllStationsAndLinesList
-	StationsAndLinesList, err := ReadStationsAndLinesList("data/StationsAndLinesList.json")
-
 	// only get the lines
 	isLineList := c.QueryParam("lines")
 
+	if wantsGeoJSON(c) {
+		return getStationsAndLinesGeoJSON(c, isLineList == "true", c.QueryParam("stations") == "true")
+	}
+
 	if isLineList == "true" {
 		linesList, err := ReadLinesList("data/LinesList.json")
 		if err != nil {
-			log.Fatalf("Error reading lines: %v", err)
+			return Unavailable("Failed to read the lines", err)
 		}
 
 		return c.JSONPretty(http.StatusOK, linesList, "  ")
@@ -32,18 +32,43 @@ func GetAllStationsAndLines(c echo.Context) error {
 	if isStationList == "true" {
 		stationsList, err := ReadStationsList("data/StationsList.json")
 		if err != nil {
-			log.Fatalf("Error reading lines: %v", err)
+			return Unavailable("Failed to read the stations", err)
 		}
 
 		return c.JSONPretty(http.StatusOK, stationsList, "  ")
 	}
+
+	StationsAndLinesList, err := ReadStationsAndLinesList("data/StationsAndLinesList.json")
 	if err != nil {
-		log.Fatalf("Error reading lines: %v", err)
+		return Unavailable("Failed to read the stations and lines", err)
 	}
 
 	return c.JSONPretty(http.StatusOK, StationsAndLinesList, "  ")
 }
 
+// getStationsAndLinesGeoJSON returns the stations as points and the lines as line strings,
+// or only one of them like the lines and stations parameters do for JSON
+func getStationsAndLinesGeoJSON(c echo.Context, onlyLines, onlyStations bool) error {
+	stationsList, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return Unavailable("Failed to read the stations", err)
+	}
+
+	collection := newFeatureCollection()
+	if !onlyLines {
+		collection.Features = append(collection.Features, StationFeatures(stationsList)...)
+	}
+	if !onlyStations || onlyLines {
+		linesList, err := ReadLinesList("data/LinesList.json")
+		if err != nil {
+			return Unavailable("Failed to read the lines", err)
+		}
+		collection.Features = append(collection.Features, LineFeatures(linesList, stationsList)...)
+	}
+
+	return geoJSONResponse(c, collection)
+}
+
 func ReadStationsAndLinesList(filepath string) (types.AllStationsAndLinesList, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -59,7 +84,7 @@ func ReadStationsAndLinesList(filepath string) (types.AllStationsAndLinesList, e
 	var AllStationsAndLinesList types.AllStationsAndLinesList
 	err = json.Unmarshal(byteValue, &AllStationsAndLinesList)
 	if err != nil {
-		log.Fatalf("Error reading lines: %v", err)
+		return types.AllStationsAndLinesList{}, err
 	}
 
 	return AllStationsAndLinesList, nil
@@ -80,7 +105,7 @@ func ReadLinesList(filepath string) (map[string][]string, error) {
 	var linesList map[string][]string
 	err = json.Unmarshal(byteValue, &linesList)
 	if err != nil {
-		log.Fatalf("Error reading lines: %v", err)
+		return map[string][]string{}, err
 	}
 
 	return linesList, nil
@@ -101,7 +126,7 @@ func ReadStationsList(filepath string) (map[string]types.StationListEntry, error
 	var linesList map[string]types.StationListEntry
 	err = json.Unmarshal(byteValue, &linesList)
 	if err != nil {
-		log.Fatalf("Error reading lines: %v", err)
+		return map[string]types.StationListEntry{}, err
 	}
 
 	return linesList, nil
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// GetHeatmap counts the reports per station and line over a period, weighted for a heatmap layer
+func GetHeatmap(c echo.Context) error {
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+
+	stationCounts, err := database.CountReports(c.Request().Context(), database.GroupByStation, filter)
+	if err != nil {
+		return Unavailable("Failed to count the reports per station", err)
+	}
+
+	lineCounts, err := database.CountReports(c.Request().Context(), database.GroupByLine, filter)
+	if err != nil {
+		return Unavailable("Failed to count the reports per line", err)
+	}
+
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return Unavailable("Failed to read the stations", err)
+	}
+
+	return c.JSON(http.StatusOK, BuildHeatmap(filter, stationCounts, lineCounts, stations))
+}
+
+// BuildHeatmap places the counts on the stations and weights them relative to the largest count
+func BuildHeatmap(filter structs.AggregationFilter, stationCounts, lineCounts []structs.ReportCount, stations map[string]structs.Station) structs.HeatmapResponse {
+	response := structs.HeatmapResponse{
+		From:     filter.From,
+		To:       filter.To,
+		Stations: []structs.HeatmapStation{},
+		Lines:    []structs.HeatmapLine{},
+	}
+
+	// The counts are sorted, so the first one is the largest
+	for _, count := range stationCounts {
+		station, ok := stations[count.Key]
+		if !ok {
+			// Reports of stations that were removed from the station list can't be placed on the map
+			continue
+		}
+		station.ID = count.Key
+		response.Stations = append(response.Stations, structs.HeatmapStation{
+			Station: station,
+			Count:   count.Count,
+			Weight:  float64(count.Count) / float64(stationCounts[0].Count),
+		})
+	}
+
+	for _, count := range lineCounts {
+		response.Lines = append(response.Lines, structs.HeatmapLine{
+			Line:   count.Key,
+			Count:  count.Count,
+			Weight: float64(count.Count) / float64(lineCounts[0].Count),
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Period of the history if no 'from' is given
+const defaultHistoryPeriod = 24 * time.Hour
+
+// GetHistory returns the sightings of a time range, oldest first, for scrubbing through a timeline
+func GetHistory(c echo.Context) error {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return ValidationFailed(err.Error())
+	}
+
+	var filter structs.AggregationFilter
+	if filter.To, err = parseOptionalTime(c.QueryParam("to")); err != nil {
+		return ValidationFailed("Invalid 'to' time, expected RFC3339").WithDetails(map[string]string{"field": "to", "value": c.QueryParam("to")})
+	}
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	if filter.From, err = parseOptionalTime(c.QueryParam("from")); err != nil {
+		return ValidationFailed("Invalid 'from' time, expected RFC3339").WithDetails(map[string]string{"field": "from", "value": c.QueryParam("from")})
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-defaultHistoryPeriod)
+	}
+	if !filter.From.Before(filter.To) {
+		return ValidationFailed("'from' has to be before 'to'")
+	}
+	if lines := c.QueryParam("lines"); lines != "" {
+		filter.Lines = strings.Split(lines, ",")
+	}
+	if stations := c.QueryParam("stations"); stations != "" {
+		filter.StationIDs = strings.Split(stations, ",")
+	}
+
+	// The reports are stored in local time
+	filter.From, filter.To = filter.From.Local(), filter.To.Local()
+
+	// Fetch one more than requested to know if there is another page
+	filter.Limit = limit + 1
+	ticketInfoList, err := database.ListSightings(c.Request().Context(), filter, offset)
+	if err != nil {
+		return Unavailable("Failed to get the sightings", err)
+	}
+
+	response := structs.HistoryResponse{From: filter.From, To: filter.To}
+	if len(ticketInfoList) > limit {
+		ticketInfoList = ticketInfoList[:limit]
+		nextOffset := offset + limit
+		response.NextOffset = &nextOffset
+	}
+
+	if response.Sightings, err = constructTicketInspectors(ticketInfoList); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -2,8 +2,8 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -47,18 +47,22 @@ func FindStationId(name string, stations map[string]Station) (string, bool) {
 
 func GetStationId(c echo.Context) error {
 	name := c.QueryParam("name")
-	fmt.Printf("receiving name: %s\n", name)
+	slog.DebugContext(c.Request().Context(), "Looking up station id", "name", name)
+
+	if name == "" {
+		return ValidationFailed("The query parameter 'name' is required").WithDetails(map[string]string{"field": "name"})
+	}
 
 	stations, err := ReadFromFile("data/StationsList.json")
 	if err != nil {
-		return err
+		return Unavailable("Failed to read the stations", err)
 	}
 
 	id, found := FindStationId(name, stations)
 	if found {
-		fmt.Printf("returned id: %s\n", id)
+		slog.DebugContext(c.Request().Context(), "Found station id", "name", name, "id", id)
 		return c.JSON(http.StatusOK, id)
 	}
 
-	return echo.ErrNotFound
+	return NotFound("No station found with the name " + name)
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
@@ -12,68 +14,99 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Reports stores the reports of /newInspector and answers /recent, main swaps it for a MemoryStore with REPORTS_STORE=memory
+var Reports database.TicketInfoStore = database.PostgresStore{}
+
 func GetRecentTicketInspectorInfo(c echo.Context) error {
-	// Check if the data has been modified since the provided time
-	modifiedSince, err := CheckIfModifiedSince(c)
+	geoJSON := wantsGeoJSON(c)
+
+	// Replay the map at a time in the past instead of now
+	at, err := parseReplayTime(c.QueryParam("at"))
 	if err != nil {
-		fmt.Printf("Error checking if the data has been modified: %v\n", err)
-		return c.JSON(http.StatusInternalServerError, err.Error())
-	}
-	if modifiedSince {
-		// Return 304 Not Modified if the data hasn't been modified since the provided time
-		return c.NoContent(http.StatusNotModified)
+		return err
 	}
 
-	// Proceed with fetching and processing the data if it was modified
-	// or if the If-Modified-Since header was not provided
-	ticketInfoList, err := database.GetLatestStationCoordinates()
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+	var lastModified time.Time
+	if at.IsZero() {
+		lastModified, err = Reports.GetLatestUpdateTime(c.Request().Context())
+		if err != nil {
+			return Unavailable("Failed to get the latest update time", err)
+		}
+		// The historic data filling up the map is chosen by the hour, so the map changes with every hour as well
+		now := time.Now()
+		if hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()); hour.After(lastModified) {
+			lastModified = hour
+		}
+
+		// Without If-None-Match the sightings don't have to be queried if the client is up to date
+		if c.Request().Header.Get("If-None-Match") == "" && NotModified(c.Request(), "", lastModified) {
+			setLastModified(c, lastModified)
+			return c.NoContent(http.StatusNotModified)
+		}
 	}
 
-	ticketInfoList, err = FetchAndAddHistoricData(ticketInfoList)
+	filteredTicketInspectorList, err := RecentTicketInspectors(c.Request().Context(), at)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	ticketInspectorList := []structs.TicketInspector{}
-	for _, ticketInfo := range ticketInfoList {
-		ticketInspector, err := constructTicketInspectorInfo(ticketInfo)
+	if geoJSON {
+		collection := newFeatureCollection()
+		collection.Features = SightingFeatures(filteredTicketInspectorList)
+		body, err := json.Marshal(collection)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err.Error())
+			return Internal(err)
 		}
-		ticketInspectorList = append(ticketInspectorList, ticketInspector)
+		return conditionalBlob(c, MIMEApplicationGeoJSON, body, lastModified)
 	}
 
-	filteredTicketInspectorList := RemoveDuplicateStations(ticketInspectorList)
-
-	return c.JSONPretty(http.StatusOK, filteredTicketInspectorList, "  ")
+	body, err := json.MarshalIndent(filteredTicketInspectorList, "", "  ")
+	if err != nil {
+		return Internal(err)
+	}
+	return conditionalBlob(c, echo.MIMEApplicationJSON, append(body, '\n'), lastModified)
 }
 
-func CheckIfModifiedSince(c echo.Context) (bool, error) {
-	databaseLastModified, err := database.GetLatestUpdateTime()
+// RecentTicketInspectors returns the ticket inspectors of the 15 minutes before the given time,
+// filled up with historic data and with only the latest sighting per station.
+// The zero time returns the live ticket inspectors, of the last 15 minutes by the clock of the database.
+func RecentTicketInspectors(ctx context.Context, at time.Time) ([]structs.TicketInspector, error) {
+	var ticketInfoList []structs.TicketInfo
+	var err error
+	if at.IsZero() {
+		ticketInfoList, err = Reports.GetLatestStationCoordinates(ctx)
+		at = time.Now()
+	} else {
+		ticketInfoList, err = Reports.GetStationCoordinatesAt(ctx, at)
+	}
 	if err != nil {
-		return false, err
+		return nil, Unavailable("Failed to get the recent ticket inspectors", err)
 	}
 
-	ifModifiedSince := c.Request().Header.Get("If-Modified-Since")
-
-	// If the header is empty, proceed with fetching the data
-	if ifModifiedSince == "" {
-		return false, nil
+	ticketInfoList, err = FetchAndAddHistoricData(ctx, ticketInfoList, at)
+	if err != nil {
+		return nil, Unavailable("Failed to get the historic ticket inspectors", err)
 	}
 
-	// Use time.RFC3339 to parse ISO 8601 format
-	requestedModificationTime, err := time.Parse(time.RFC3339, ifModifiedSince)
+	ticketInspectorList, err := constructTicketInspectors(ticketInfoList)
 	if err != nil {
-		return false, fmt.Errorf("error parsing If-Modified-Since header: %v", err)
+		return nil, err
 	}
 
-	// Check if the database last modified time is after the requested modification time
-	if !databaseLastModified.After(requestedModificationTime) {
-		return true, nil
+	return RemoveDuplicateStations(ticketInspectorList), nil
+}
+
+// parseReplayTime parses the 'at' parameter, an empty value is returned as zero time.
+// The reports are stored in local time, so the time is converted to it.
+func parseReplayTime(value string) (time.Time, error) {
+	at, err := parseOptionalTime(value)
+	if err != nil {
+		return time.Time{}, ValidationFailed("Invalid 'at' time, expected RFC3339").WithDetails(map[string]string{"field": "at", "value": value})
 	}
-	return false, nil
+	if at.After(time.Now()) {
+		return time.Time{}, ValidationFailed("'at' must not be in the future").WithDetails(map[string]string{"field": "at", "value": value})
+	}
+	return at.Local(), nil
 }
 
 func IdToCoordinates(id string) (float64, float64, error) {
@@ -116,47 +149,57 @@ func RemoveDuplicateStations(ticketInspectorList []structs.TicketInspector) []st
 	return filteredTicketInspectorList
 }
 
-func FetchAndAddHistoricData(ticketInfoList []structs.TicketInfo) ([]structs.TicketInfo, error) {
+func FetchAndAddHistoricData(ctx context.Context, ticketInfoList []structs.TicketInfo, at time.Time) ([]structs.TicketInfo, error) {
 	if len(ticketInfoList) < 10 {
-		historicDataList, err := database.GetHistoricStations(time.Now())
+		historicDataList, err := Reports.GetHistoricStations(ctx, at)
 		if err != nil {
 			return nil, err
 		}
+		historicFallbacks.Inc()
 
 		for _, ticketInfo := range historicDataList {
 			if len(ticketInfoList) >= 10 {
 				break
 			}
 			ticketInfoList = append(ticketInfoList, ticketInfo)
+			historicSightings.Inc()
 		}
 	}
 	return ticketInfoList, nil
 }
 
-func constructTicketInspectorInfo(ticketInfo structs.TicketInfo) (structs.TicketInspector, error) {
+// constructTicketInspectors adds the names and coordinates of the stations to the reports
+func constructTicketInspectors(ticketInfoList []structs.TicketInfo) ([]structs.TicketInspector, error) {
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return nil, Unavailable("Failed to read the stations", err)
+	}
+
+	ticketInspectorList := []structs.TicketInspector{}
+	for _, ticketInfo := range ticketInfoList {
+		ticketInspector, err := constructTicketInspectorInfo(ticketInfo, stations)
+		if err != nil {
+			return nil, Internal(err)
+		}
+		ticketInspectorList = append(ticketInspectorList, ticketInspector)
+	}
+	return ticketInspectorList, nil
+}
+
+func constructTicketInspectorInfo(ticketInfo structs.TicketInfo, stations map[string]structs.Station) (structs.TicketInspector, error) {
 	cleanedStationId := strings.ReplaceAll(ticketInfo.Station_ID, "\n", "")
 	cleanedDirectionId := strings.ReplaceAll(ticketInfo.Direction_ID.String, "\n", "")
 	cleanedLine := strings.ReplaceAll(ticketInfo.Line.String, "\n", "")
 
-	stationLat, stationLon, err := IdToCoordinates(cleanedStationId)
-	if err != nil {
-		return structs.TicketInspector{}, err
-	}
-
-	stationName, err := IdToStationName(cleanedStationId)
-	if err != nil {
-		return structs.TicketInspector{}, err
+	station, ok := stations[cleanedStationId]
+	if !ok {
+		return structs.TicketInspector{}, fmt.Errorf("station ID %s not found", cleanedStationId)
 	}
 
-	directionName, directionLat, directionLon := "", float64(0), float64(0)
+	direction := structs.Station{}
 	if ticketInfo.Direction_ID.Valid {
-		directionName, err = IdToStationName(cleanedDirectionId)
-		if err != nil {
-			return structs.TicketInspector{}, err
-		}
-		directionLat, directionLon, err = IdToCoordinates(cleanedDirectionId)
-		if err != nil {
-			return structs.TicketInspector{}, err
+		if direction, ok = stations[cleanedDirectionId]; !ok {
+			return structs.TicketInspector{}, fmt.Errorf("station ID %s not found", cleanedDirectionId)
 		}
 	}
 
@@ -164,13 +207,13 @@ func constructTicketInspectorInfo(ticketInfo structs.TicketInfo) (structs.Ticket
 		Timestamp: ticketInfo.Timestamp,
 		Station: structs.Station{
 			ID:          cleanedStationId,
-			Name:        stationName,
-			Coordinates: structs.Coordinates{Latitude: stationLat, Longitude: stationLon},
+			Name:        station.Name,
+			Coordinates: station.Coordinates,
 		},
 		Direction: structs.Station{
 			ID:          cleanedDirectionId,
-			Name:        directionName,
-			Coordinates: structs.Coordinates{Latitude: directionLat, Longitude: directionLon},
+			Name:        direction.Name,
+			Coordinates: direction.Coordinates,
 		},
 		Line:       cleanedLine,
 		IsHistoric: ticketInfo.IsHistoric,
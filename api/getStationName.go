@@ -25,11 +25,19 @@ func IdToStationName(id string) (string, error) {
 func GetStationName(c echo.Context) error {
 	id := c.QueryParam("id")
 
-	id, err := IdToStationName(id)
+	if id == "" {
+		return ValidationFailed("The query parameter 'id' is required").WithDetails(map[string]string{"field": "id"})
+	}
 
+	stations, err := ReadFromFile("data/StationsList.json")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return Unavailable("Failed to read the stations", err)
+	}
+
+	station, ok := stations[id]
+	if !ok {
+		return NotFound("No station found with the id " + id)
 	}
 
-	return c.JSON(http.StatusOK, id)
+	return c.JSON(http.StatusOK, station.Name)
 }
@@ -0,0 +1,664 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPredictionLimit = 20
+
+	// Limits of a single query, so nested queries can't make the server resolve huge trees
+	maxGraphQLDepth  = 6
+	maxGraphQLFields = 200
+	// The cost counts every field once for each item of the lists around it, assuming graphQLListSize items per list
+	maxGraphQLCost  = 50000
+	graphQLListSize = 10
+	// Passed to middleware.BodyLimit
+	MaxGraphQLBodySize = "64K"
+)
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// stationData is loaded once per GraphQL request, so the resolvers don't read the files for every field
+type stationData struct {
+	stations map[string]structs.Station
+	entries  map[string]structs.StationListEntry
+	lines    map[string][]string
+}
+
+type stationDataKey struct{}
+
+type prediction struct {
+	Station structs.Station
+	Rank    int
+}
+
+var graphQLSchema = buildGraphQLSchema()
+
+// GraphQL executes queries over stations, lines, sightings and predictions.
+// Subscriptions are streamed as server-sent events and require the Accept: text/event-stream header.
+func GraphQL(c echo.Context) error {
+	var req graphQLRequest
+	if c.Request().Method == http.MethodGet {
+		req.Query = c.QueryParam("query")
+		req.OperationName = c.QueryParam("operationName")
+		if variables := c.QueryParam("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return InvalidRequest("The variables are not valid JSON").WithInternal(err)
+			}
+		}
+	} else if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	if req.Query == "" {
+		return ValidationFailed("The 'query' is required")
+	}
+
+	data, err := loadStationData()
+	if err != nil {
+		return Unavailable("Failed to read the stations", err)
+	}
+	ctx := context.WithValue(c.Request().Context(), stationDataKey{}, data)
+
+	params := graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	}
+
+	// Syntax errors are reported by graphql.Do
+	document, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err == nil {
+		if err := checkQueryLimits(document); err != nil {
+			return err
+		}
+	}
+
+	if !isSubscription(document, req.OperationName) {
+		return c.JSON(http.StatusOK, graphql.Do(params))
+	}
+
+	if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		return ValidationFailed("Subscriptions require the header Accept: text/event-stream")
+	}
+
+	return streamSubscription(c, params)
+}
+
+// streamSubscription sends every result as "next" event until the client disconnects
+func streamSubscription(c echo.Context, params graphql.Params) error {
+	ctx, cancel := context.WithCancel(params.Context)
+	defer cancel()
+	params.Context = ctx
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	results := graphql.Subscribe(params)
+	defer func() {
+		// The subscription stops once the context is cancelled, drain it so it doesn't block
+		cancel()
+		for range results {
+		}
+	}()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case result, ok := <-results:
+			if !ok {
+				fmt.Fprint(response, "event: complete\ndata:\n\n")
+				response.Flush()
+				return nil
+			}
+
+			payload, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(response, "event: next\ndata: %s\n\n", payload)
+			response.Flush()
+		}
+	}
+}
+
+// checkQueryLimits rejects queries nested deeper than maxGraphQLDepth, selecting more than maxGraphQLFields fields
+// or costing more than maxGraphQLCost, fragments are counted wherever they are spread
+func checkQueryLimits(document *ast.Document) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	fields, cost := 0, 0
+	spreading := map[string]bool{}
+	// items is how often the fields of the selection set are resolved
+	var walk func(selectionSet *ast.SelectionSet, parent graphql.Type, depth, items int) error
+	walk = func(selectionSet *ast.SelectionSet, parent graphql.Type, depth, items int) error {
+		if selectionSet == nil {
+			return nil
+		}
+
+		for _, selection := range selectionSet.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				fields++
+				if depth > maxGraphQLDepth {
+					return ValidationFailed(fmt.Sprintf("The query is nested deeper than %d levels", maxGraphQLDepth))
+				}
+				if fields > maxGraphQLFields {
+					return ValidationFailed(fmt.Sprintf("The query selects more than %d fields", maxGraphQLFields))
+				}
+
+				fieldType, isList := fieldTypeOf(parent, selection.Name.Value)
+				fieldItems := items
+				if isList {
+					fieldItems *= graphQLListSize
+				}
+				cost += fieldItems
+				if cost > maxGraphQLCost {
+					return ValidationFailed(fmt.Sprintf("The query costs more than %d, every item of a list is counted with its fields", maxGraphQLCost))
+				}
+
+				if err := walk(selection.SelectionSet, fieldType, depth+1, fieldItems); err != nil {
+					return err
+				}
+			case *ast.InlineFragment:
+				if err := walk(selection.SelectionSet, typeCondition(selection.TypeCondition, parent), depth, items); err != nil {
+					return err
+				}
+			case *ast.FragmentSpread:
+				// Unknown and cyclic fragments are reported by graphql.Do
+				name := selection.Name.Value
+				fragment, ok := fragments[name]
+				if !ok || spreading[name] {
+					continue
+				}
+				spreading[name] = true
+				err := walk(fragment.SelectionSet, typeCondition(fragment.TypeCondition, parent), depth, items)
+				delete(spreading, name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, definition := range document.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			if err := walk(operation.SelectionSet, operationType(operation), 1, 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// operationType returns the root type of the operation, or nil if the schema doesn't support it
+func operationType(operation *ast.OperationDefinition) graphql.Type {
+	switch operation.Operation {
+	case ast.OperationTypeQuery:
+		return graphQLSchema.QueryType()
+	case ast.OperationTypeSubscription:
+		if subscription := graphQLSchema.SubscriptionType(); subscription != nil {
+			return subscription
+		}
+	}
+	return nil
+}
+
+// typeCondition returns the type a fragment applies to, fragments without a condition keep the parent type
+func typeCondition(condition *ast.Named, parent graphql.Type) graphql.Type {
+	if condition == nil {
+		return parent
+	}
+	return graphQLSchema.Type(condition.Name.Value)
+}
+
+// fieldTypeOf returns the named type of a field and whether it is a list,
+// unknown fields return nil and are reported by graphql.Do
+func fieldTypeOf(parent graphql.Type, name string) (graphql.Type, bool) {
+	object, ok := parent.(interface {
+		Fields() graphql.FieldDefinitionMap
+	})
+	if !ok {
+		return nil, false
+	}
+	field, ok := object.Fields()[name]
+	if !ok {
+		return nil, false
+	}
+
+	fieldType, isList := field.Type, false
+	for {
+		switch wrapped := fieldType.(type) {
+		case *graphql.NonNull:
+			fieldType = wrapped.OfType
+		case *graphql.List:
+			isList = true
+			fieldType = wrapped.OfType
+		default:
+			return fieldType, isList
+		}
+	}
+}
+
+func isSubscription(document *ast.Document, operationName string) bool {
+	if document == nil {
+		return false
+	}
+
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			return operation.Operation == ast.OperationTypeSubscription
+		}
+	}
+	return false
+}
+
+func loadStationData() (*stationData, error) {
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &stationData{stations: stations, entries: entries, lines: lines}, nil
+}
+
+func stationDataFrom(ctx context.Context) *stationData {
+	return ctx.Value(stationDataKey{}).(*stationData)
+}
+
+func (d *stationData) station(id string) (structs.Station, bool) {
+	station, ok := d.stations[id]
+	station.ID = id
+	return station, ok
+}
+
+func (d *stationData) lineNames() []string {
+	names := make([]string, 0, len(d.lines))
+	for name := range d.lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchesSighting applies the filters shared by the sightings query and subscription
+func matchesSighting(sighting structs.TicketInspector, args map[string]interface{}) bool {
+	if lines := stringList(args["lines"]); len(lines) > 0 && !slices.Contains(lines, sighting.Line) {
+		return false
+	}
+	if stations := stringList(args["stations"]); len(stations) > 0 && !slices.Contains(stations, sighting.Station.ID) {
+		return false
+	}
+	return true
+}
+
+func stringList(value interface{}) []string {
+	values, _ := value.([]interface{})
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if text, ok := value.(string); ok {
+			list = append(list, text)
+		}
+	}
+	return list
+}
+
+func buildGraphQLSchema() graphql.Schema {
+	coordinatesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Coordinates",
+		Fields: graphql.Fields{
+			"latitude":  &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"longitude": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	// Stations and lines reference each other, so their fields are defined once both exist
+	stationType := graphql.NewObject(graphql.ObjectConfig{Name: "Station", Fields: graphql.Fields{}})
+	lineType := graphql.NewObject(graphql.ObjectConfig{Name: "Line", Fields: graphql.Fields{}})
+
+	stationType.AddFieldConfig("id", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.ID),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(structs.Station).ID, nil
+		},
+	})
+	stationType.AddFieldConfig("name", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(structs.Station).Name, nil
+		},
+	})
+	stationType.AddFieldConfig("coordinates", &graphql.Field{
+		Type: graphql.NewNonNull(coordinatesType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(structs.Station).Coordinates, nil
+		},
+	})
+	stationType.AddFieldConfig("lines", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(lineType))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			entry := stationDataFrom(p.Context).entries[p.Source.(structs.Station).ID]
+			return entry.Lines, nil
+		},
+	})
+
+	lineType.AddFieldConfig("name", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.ID),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(string), nil
+		},
+	})
+	lineType.AddFieldConfig("stations", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stationType))),
+		Description: "The stations of the line in the order they are served",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			data := stationDataFrom(p.Context)
+			stations := []structs.Station{}
+			for _, id := range data.lines[p.Source.(string)] {
+				if station, ok := data.station(id); ok {
+					stations = append(stations, station)
+				}
+			}
+			return stations, nil
+		},
+	})
+
+	sightingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Sighting",
+		Fields: graphql.Fields{
+			"timestamp": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(structs.TicketInspector).Timestamp, nil
+				},
+			},
+			"station": &graphql.Field{
+				Type: graphql.NewNonNull(stationType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(structs.TicketInspector).Station, nil
+				},
+			},
+			"direction": &graphql.Field{
+				Type: stationType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					direction := p.Source.(structs.TicketInspector).Direction
+					if direction.ID == "" {
+						return nil, nil
+					}
+					return direction, nil
+				},
+			},
+			"line": &graphql.Field{
+				Type: lineType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					line := p.Source.(structs.TicketInspector).Line
+					if line == "" {
+						return nil, nil
+					}
+					return line, nil
+				},
+			},
+			"isHistoric": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(structs.TicketInspector).IsHistoric, nil
+				},
+			},
+		},
+	})
+
+	predictionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Prediction",
+		Description: "A station where inspectors are usually seen at this hour and weekday",
+		Fields: graphql.Fields{
+			"station": &graphql.Field{
+				Type: graphql.NewNonNull(stationType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(prediction).Station, nil
+				},
+			},
+			"rank": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "1 for the station with the most sightings",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(prediction).Rank, nil
+				},
+			},
+		},
+	})
+
+	sightingFilters := graphql.FieldConfigArgument{
+		"lines":    &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"stations": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.ID))},
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"station": &graphql.Field{
+				Type:        stationType,
+				Description: "Find a station by its id or by its name, case and whitespace insensitive",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.ID},
+					"name": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data := stationDataFrom(p.Context)
+					id, _ := p.Args["id"].(string)
+					if name, ok := p.Args["name"].(string); ok {
+						id, _ = FindStationId(name, data.stations)
+					}
+					if station, ok := data.station(id); ok {
+						return station, nil
+					}
+					return nil, nil
+				},
+			},
+			"stations": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stationType))),
+				Args: graphql.FieldConfigArgument{
+					"line": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only stations served by the line"},
+					"name": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only stations whose name contains this"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data := stationDataFrom(p.Context)
+					line, _ := p.Args["line"].(string)
+					name, _ := p.Args["name"].(string)
+
+					stations := []structs.Station{}
+					for id, entry := range data.entries {
+						if line != "" && !slices.Contains(entry.Lines, line) {
+							continue
+						}
+						if name != "" && !strings.Contains(strings.ToLower(entry.Name), strings.ToLower(name)) {
+							continue
+						}
+						station, _ := data.station(id)
+						stations = append(stations, station)
+					}
+
+					sort.Slice(stations, func(i, j int) bool { return stations[i].Name < stations[j].Name })
+					return stations, nil
+				},
+			},
+			"line": &graphql.Field{
+				Type: lineType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name := p.Args["name"].(string)
+					if _, ok := stationDataFrom(p.Context).lines[name]; !ok {
+						return nil, nil
+					}
+					return name, nil
+				},
+			},
+			"lines": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(lineType))),
+				Args: graphql.FieldConfigArgument{
+					"names": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					names := stringList(p.Args["names"])
+					lines := []string{}
+					for _, name := range stationDataFrom(p.Context).lineNames() {
+						if len(names) == 0 || slices.Contains(names, name) {
+							lines = append(lines, name)
+						}
+					}
+					return lines, nil
+				},
+			},
+			"sightings": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sightingType))),
+				Description: "The same sightings as /recent, optionally filtered",
+				Args: graphql.FieldConfigArgument{
+					"lines":           sightingFilters["lines"],
+					"stations":        sightingFilters["stations"],
+					"includeHistoric": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: true},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ticketInspectors, err := RecentTicketInspectors(p.Context, time.Time{})
+					if err != nil {
+						return nil, err
+					}
+
+					includeHistoric := p.Args["includeHistoric"].(bool)
+					sightings := []structs.TicketInspector{}
+					for _, sighting := range ticketInspectors {
+						if (includeHistoric || !sighting.IsHistoric) && matchesSighting(sighting, p.Args) {
+							sightings = append(sightings, sighting)
+						}
+					}
+					return sightings, nil
+				},
+			},
+			"predictions": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(predictionType))),
+				Description: "The stations with the most sightings at the hour and weekday of the given time",
+				Args: graphql.FieldConfigArgument{
+					"at":    &graphql.ArgumentConfig{Type: graphql.DateTime, Description: "Defaults to now"},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPredictionLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					at, ok := p.Args["at"].(time.Time)
+					if !ok {
+						at = time.Now()
+					}
+
+					historicStations, err := Reports.GetHistoricStations(p.Context, at)
+					if err != nil {
+						return nil, err
+					}
+
+					data := stationDataFrom(p.Context)
+					predictions := []prediction{}
+					for _, ticketInfo := range historicStations {
+						if len(predictions) >= p.Args["limit"].(int) {
+							break
+						}
+						if station, ok := data.station(strings.TrimSpace(ticketInfo.Station_ID)); ok {
+							predictions = append(predictions, prediction{Station: station, Rank: len(predictions) + 1})
+						}
+					}
+					return predictions, nil
+				},
+			},
+		},
+	})
+
+	subscriptionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"sightings": &graphql.Field{
+				Type:        graphql.NewNonNull(sightingType),
+				Description: "Every new sighting as soon as it is reported",
+				Args:        sightingFilters,
+				Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+					sightings, unsubscribe := Sightings.Subscribe()
+					results := make(chan interface{})
+
+					go func() {
+						defer close(results)
+						defer unsubscribe()
+						for {
+							select {
+							case <-p.Context.Done():
+								return
+							case sighting := <-sightings:
+								if !matchesSighting(sighting, p.Args) {
+									continue
+								}
+								select {
+								case results <- sighting:
+								case <-p.Context.Done():
+									return
+								}
+							}
+						}
+					}()
+
+					return results, nil
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:        queryType,
+		Subscription: subscriptionType,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	return schema
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/FreiFahren/backend/proto"
+	structs "github.com/FreiFahren/backend/structs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Default port of the gRPC service, it can be changed with GRPC_PORT
+const defaultGRPCPort = "9090"
+
+type grpcRoleKey struct{}
+
+// FreiFahrenServer implements the gRPC service for internal consumers like the Telegram bot
+type FreiFahrenServer struct {
+	pb.UnimplementedFreiFahrenServer
+}
+
+// NewGRPCServer returns a gRPC server with the FreiFahren service, authenticated with the api keys of the http api
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(authenticateUnary),
+		grpc.StreamInterceptor(authenticateStream),
+	)
+	pb.RegisterFreiFahrenServer(server, &FreiFahrenServer{})
+	return server
+}
+
+func GRPCPort() string {
+	if port := strings.TrimSpace(os.Getenv("GRPC_PORT")); port != "" {
+		return port
+	}
+	return defaultGRPCPort
+}
+
+func (s *FreiFahrenServer) ReportInspector(ctx context.Context, req *pb.InspectorRequest) (*pb.ReportInspectorResponse, error) {
+	role := grpcRole(ctx)
+	if role == structs.RolePublic {
+		return nil, status.Error(codes.Unauthenticated, "An api key is required")
+	}
+	if !HasRole(role, structs.RoleReporter) {
+		return nil, status.Error(codes.PermissionDenied, "The api key is missing the role "+structs.RoleReporter)
+	}
+
+	if req.GetLine() == "" && req.GetStation() == "" && req.GetDirection() == "" {
+		return nil, status.Error(codes.InvalidArgument, "At least one of 'line', 'station', or 'direction' must be provided")
+	}
+
+	// Only trusted reporters can use the service, so the reports are not attributed to a source
+	data, err := processRequestData(ctx, structs.InspectorRequest{
+		Line:          req.GetLine(),
+		StationName:   req.GetStation(),
+		DirectionName: req.GetDirection(),
+	}, nil)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &pb.ReportInspectorResponse{
+		Line:      data.Line,
+		Station:   toProtoStation(data.Station, nil),
+		Direction: toProtoStation(data.Direction, nil),
+	}, nil
+}
+
+func (s *FreiFahrenServer) GetStation(ctx context.Context, req *pb.GetStationRequest) (*pb.Station, error) {
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return nil, grpcError(Unavailable("Failed to read the stations", err))
+	}
+
+	entries, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return nil, grpcError(Unavailable("Failed to read the stations", err))
+	}
+
+	id := req.GetId()
+	if name := req.GetName(); name != "" {
+		var found bool
+		if id, found = FindStationId(name, stations); !found {
+			return nil, status.Error(codes.NotFound, "No station found with the name "+name)
+		}
+	}
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "Either 'id' or 'name' is required")
+	}
+
+	station, ok := stations[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "No station found with the id "+id)
+	}
+	station.ID = id
+
+	return toProtoStation(station, entries[id].Lines), nil
+}
+
+func (s *FreiFahrenServer) ListStations(ctx context.Context, req *pb.ListStationsRequest) (*pb.ListStationsResponse, error) {
+	entries, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return nil, grpcError(Unavailable("Failed to read the stations", err))
+	}
+
+	ids := make([]string, 0, len(entries))
+	if line := req.GetLine(); line != "" {
+		lines, err := ReadLinesList("data/LinesList.json")
+		if err != nil {
+			return nil, grpcError(Unavailable("Failed to read the lines", err))
+		}
+		lineStations, ok := lines[line]
+		if !ok {
+			return nil, status.Error(codes.NotFound, "No line found with the name "+line)
+		}
+		ids = append(ids, lineStations...)
+	} else {
+		for id := range entries {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	response := &pb.ListStationsResponse{Stations: make([]*pb.Station, 0, len(ids))}
+	for _, id := range ids {
+		entry := entries[id]
+		station := structs.Station{
+			ID:          id,
+			Name:        entry.Name,
+			Coordinates: structs.Coordinates{Latitude: entry.Coordinates.Latitude, Longitude: entry.Coordinates.Longitude},
+		}
+		response.Stations = append(response.Stations, toProtoStation(station, entry.Lines))
+	}
+	return response, nil
+}
+
+func (s *FreiFahrenServer) ListRecentSightings(ctx context.Context, req *pb.ListRecentSightingsRequest) (*pb.ListRecentSightingsResponse, error) {
+	sightings, err := RecentTicketInspectors(ctx, time.Time{})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &pb.ListRecentSightingsResponse{Sightings: make([]*pb.TicketInspector, 0, len(sightings))}
+	for _, sighting := range sightings {
+		response.Sightings = append(response.Sightings, toProtoTicketInspector(sighting))
+	}
+	return response, nil
+}
+
+func (s *FreiFahrenServer) StreamSightings(req *pb.StreamSightingsRequest, stream pb.FreiFahren_StreamSightingsServer) error {
+	sightings, unsubscribe := Sightings.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case sighting := <-sightings:
+			if len(req.GetLines()) > 0 && !slices.Contains(req.GetLines(), sighting.Line) {
+				continue
+			}
+			if len(req.GetStationIds()) > 0 && !slices.Contains(req.GetStationIds(), sighting.Station.ID) {
+				continue
+			}
+			if err := stream.Send(toProtoTicketInspector(sighting)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toProtoStation(station structs.Station, lines []string) *pb.Station {
+	return &pb.Station{
+		Id:          station.ID,
+		Name:        station.Name,
+		Coordinates: &pb.Coordinates{Latitude: station.Coordinates.Latitude, Longitude: station.Coordinates.Longitude},
+		Lines:       lines,
+	}
+}
+
+func toProtoTicketInspector(ticketInspector structs.TicketInspector) *pb.TicketInspector {
+	return &pb.TicketInspector{
+		Timestamp:  timestamppb.New(ticketInspector.Timestamp),
+		Station:    toProtoStation(ticketInspector.Station, nil),
+		Direction:  toProtoStation(ticketInspector.Direction, nil),
+		Line:       ticketInspector.Line,
+		IsHistoric: ticketInspector.IsHistoric,
+	}
+}
+
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+}
+
+// grpcError converts the errors of the http handlers to gRPC status errors, like HTTPErrorHandler does for http
+func grpcError(err error) error {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		apiError = Internal(err)
+	}
+
+	if apiError.Status >= http.StatusInternalServerError {
+		slog.Error("Error handling gRPC call", "error", apiError)
+	}
+
+	code, ok := grpcCodes[apiError.Status]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, apiError.Message)
+}
+
+// authenticateGRPC resolves the api key in the x-api-key or authorization metadata to its role,
+// calls without a key are treated as public
+func authenticateGRPC(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	key := ""
+	if values := md.Get(strings.ToLower(ApiKeyHeader)); len(values) > 0 {
+		key = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		if bearer, ok := strings.CutPrefix(values[0], "Bearer "); ok {
+			key = bearer
+		}
+	}
+
+	if key == "" {
+		return context.WithValue(ctx, grpcRoleKey{}, structs.RolePublic), nil
+	}
+
+	apiKey, _, err := lookupApiKey(ctx, key, time.Now())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return context.WithValue(ctx, grpcRoleKey{}, apiKey.Role), nil
+}
+
+func authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticateGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticateGRPC(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream passes the context with the role on to the stream handlers
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcRole(ctx context.Context) string {
+	role, ok := ctx.Value(grpcRoleKey{}).(string)
+	if !ok {
+		return structs.RolePublic
+	}
+	return role
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// GetHealth is the liveness check, it only fails if the station data can't be loaded,
+// so a database outage doesn't get the server restarted
+func GetHealth(c echo.Context) error {
+	return healthResponse(c, map[string]error{"stations": checkStationData()})
+}
+
+// GetReadiness is the readiness check, the server only gets traffic while the database and the station data are available
+func GetReadiness(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]error{"stations": checkStationData()}
+	// Without a database the reports are kept in memory
+	if _, inMemory := Reports.(*database.MemoryStore); !inMemory {
+		checks["database"] = database.Ping(ctx)
+	}
+	return healthResponse(c, checks)
+}
+
+func healthResponse(c echo.Context, checks map[string]error) error {
+	response := structs.HealthResponse{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+
+	for name, err := range checks {
+		response.Checks[name] = "ok"
+		if err != nil {
+			response.Checks[name] = err.Error()
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	return c.JSON(status, response)
+}
+
+func checkStationData() error {
+	stations, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return err
+	}
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return err
+	}
+	if len(stations) == 0 || len(lines) == 0 {
+		return errors.New("no stations or lines")
+	}
+	return nil
+}
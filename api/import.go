@@ -0,0 +1,304 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+// Longest station name in words, e.g. Freie Universität (Thielplatz)
+const maxStationNameWords = 4
+
+// Words that mark the following station as the direction of a message, e.g. "U8 Richtung Wittenau"
+var directionWords = map[string]bool{"richtung": true, "ri": true, "nach": true, "direction": true, "->": true}
+
+// Timestamp formats of the CSV files, times without a zone are local like the stored reports
+var importTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// Importer turns Telegram exports and CSV files into reports
+type Importer struct {
+	stations map[string]structs.Station
+	lines    map[string][]string
+	// Archives repeat the same names, so the results of FindStationId are kept
+	resolved map[string]string
+}
+
+func NewImporter(stations map[string]structs.Station, lines map[string][]string) *Importer {
+	return &Importer{stations: stations, lines: lines, resolved: map[string]string{}}
+}
+
+type telegramExport struct {
+	ID       int64             `json:"id"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+type telegramMessage struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	Date         string          `json:"date"`
+	DateUnixtime string          `json:"date_unixtime"`
+	FromID       string          `json:"from_id"`
+	Text         json.RawMessage `json:"text"`
+}
+
+// ParseTelegramExport reads the result.json of a Telegram chat export.
+// The station, direction and line are searched in the text, messages without a station are rejected.
+func (i *Importer) ParseTelegramExport(file string, r io.Reader) ([]structs.ImportRecord, []structs.ImportReject, error) {
+	var export telegramExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, fmt.Errorf("failed to read the Telegram export: %w", err)
+	}
+
+	var records []structs.ImportRecord
+	var rejects []structs.ImportReject
+	for _, message := range export.Messages {
+		text := telegramText(message.Text)
+		// Service messages, e.g. someone joined, and pictures without caption are no sightings
+		if message.Type != "message" || strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		reject := func(reason string) {
+			rejects = append(rejects, structs.ImportReject{File: file, Reference: "message " + strconv.FormatInt(message.ID, 10), Reason: reason, Raw: text})
+		}
+
+		timestamp, err := telegramTime(message)
+		if err != nil {
+			reject("invalid date")
+			continue
+		}
+
+		record := i.matchMessage(text)
+		if record.StationID == nil {
+			reject("no station found")
+			continue
+		}
+
+		record.SourceHash = sourceHash(fmt.Sprintf("telegram:%d:%d", export.ID, message.ID))
+		record.Timestamp = timestamp
+		record.Message = &text
+		// Users are exported as user123456, channels as channel123456
+		if id, err := strconv.ParseInt(strings.TrimPrefix(message.FromID, "user"), 10, 64); err == nil {
+			record.Author = &id
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rejects, nil
+}
+
+// ParseCSV reads a CSV file with a header of the columns timestamp, station, line, direction, message and author.
+// Only timestamp and station are required, stations can be given by name or id.
+func (i *Importer) ParseCSV(file string, r io.Reader) ([]structs.ImportRecord, []structs.ImportReject, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for index, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	for _, required := range []string{"timestamp", "station"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("the CSV file has no %s column", required)
+		}
+	}
+
+	var records []structs.ImportRecord
+	var rejects []structs.ImportReject
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the CSV file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		record, reason := i.csvRecord(row, columns)
+		if reason != "" {
+			rejects = append(rejects, structs.ImportReject{File: file, Reference: "line " + strconv.Itoa(line), Reason: reason, Raw: strings.Join(row, ",")})
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, rejects, nil
+}
+
+// csvRecord returns the reason if the row can't be imported
+func (i *Importer) csvRecord(row []string, columns map[string]int) (structs.ImportRecord, string) {
+	field := func(name string) string {
+		index, ok := columns[name]
+		if !ok || index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[index])
+	}
+
+	record := structs.ImportRecord{SourceHash: sourceHash("csv:" + strings.Join(row, "\x1f"))}
+
+	var err error
+	if record.Timestamp, err = parseImportTime(field("timestamp")); err != nil {
+		return record, "invalid timestamp"
+	}
+
+	stationID, ok := i.resolveStation(field("station"))
+	if !ok {
+		return record, "unknown station"
+	}
+	record.StationID, record.StationName = i.station(stationID)
+
+	if direction := field("direction"); direction != "" {
+		directionID, ok := i.resolveStation(direction)
+		if !ok {
+			return record, "unknown direction"
+		}
+		record.DirectionID, record.DirectionName = i.station(directionID)
+	}
+
+	if line := strings.ToUpper(field("line")); line != "" {
+		if _, ok := i.lines[line]; !ok {
+			return record, "unknown line"
+		}
+		record.Line = &line
+	}
+
+	if message := field("message"); message != "" {
+		record.Message = &message
+	}
+
+	if author := field("author"); author != "" {
+		id, err := strconv.ParseInt(author, 10, 64)
+		if err != nil {
+			return record, "invalid author"
+		}
+		record.Author = &id
+	}
+
+	return record, ""
+}
+
+// matchMessage finds the line, station and direction in the text of a message, the longest station names first
+func (i *Importer) matchMessage(text string) structs.ImportRecord {
+	var record structs.ImportRecord
+
+	words := strings.Fields(text)
+	for index := 0; index < len(words); index++ {
+		word := strings.Trim(words[index], ",.!?:;\"'")
+
+		if line := strings.ToUpper(word); record.Line == nil {
+			if _, ok := i.lines[line]; ok {
+				record.Line = &line
+				continue
+			}
+		}
+
+		for length := min(maxStationNameWords, len(words)-index); length > 0; length-- {
+			name := strings.Trim(strings.Join(words[index:index+length], " "), ",.!?:;\"'")
+			stationID, ok := i.resolveStation(name)
+			if !ok {
+				continue
+			}
+
+			isDirection := index > 0 && directionWords[strings.ToLower(strings.Trim(words[index-1], ".:"))]
+			if isDirection && record.DirectionID == nil {
+				record.DirectionID, record.DirectionName = i.station(stationID)
+			} else if !isDirection && record.StationID == nil {
+				record.StationID, record.StationName = i.station(stationID)
+			}
+			index += length - 1
+			break
+		}
+	}
+
+	return record
+}
+
+// resolveStation accepts the id or the name of a station
+func (i *Importer) resolveStation(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if _, ok := i.stations[name]; ok {
+		return name, true
+	}
+
+	id, ok := i.resolved[name]
+	if !ok {
+		id, _ = FindStationId(name, i.stations)
+		i.resolved[name] = id
+	}
+	return id, id != ""
+}
+
+func (i *Importer) station(id string) (*string, *string) {
+	name := i.stations[id].Name
+	return &id, &name
+}
+
+// telegramText joins the text of a message, formatted texts are exported as a list of strings and entities
+func telegramText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+
+	var builder strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &text); err == nil {
+			builder.WriteString(text)
+		} else if err := json.Unmarshal(part, &entity); err == nil {
+			builder.WriteString(entity.Text)
+		}
+	}
+	return builder.String()
+}
+
+// telegramTime prefers the unix time, the date is in the time zone of whoever exported the chat
+func telegramTime(message telegramMessage) (time.Time, error) {
+	if message.DateUnixtime != "" {
+		seconds, err := strconv.ParseInt(message.DateUnixtime, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).Local(), nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", message.Date, time.Local)
+}
+
+func parseImportTime(value string) (time.Time, error) {
+	for _, format := range importTimeFormats {
+		if t, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return t.Local(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func sourceHash(source string) string {
+	hash := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(hash[:])
+}
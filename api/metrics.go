@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsRegistry contains all metrics served at /metrics
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "freifahren_http_request_duration_seconds",
+		Help:    "Duration of the HTTP requests by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	reportsInserted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "freifahren_reports_inserted_total",
+		Help: "Reports saved by /newInspector, quarantined ones are hidden until they are reviewed.",
+	}, []string{"quarantined"})
+
+	stationResolutionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "freifahren_station_resolution_failures_total",
+		Help: "Station or direction names of reports that didn't match a station.",
+	}, []string{"field"})
+
+	historicFallbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "freifahren_historic_fallback_total",
+		Help: "Requests of /recent that were filled up with historic sightings.",
+	})
+
+	historicSightings = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "freifahren_historic_sightings_added_total",
+		Help: "Historic sightings added to the responses of /recent.",
+	})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestDuration,
+		reportsInserted,
+		stationResolutionFailures,
+		historicFallbacks,
+		historicSightings,
+		poolCollector{},
+	)
+}
+
+// RecordMetrics measures the duration of every request by its route
+func RecordMetrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		// The error handler runs after the middlewares, so the status is taken from the error
+		status := c.Response().Status
+		if err != nil {
+			status = errorStatus(err)
+		}
+
+		// Unknown paths share a label, so scanners can't create a series per path
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requestDuration.WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func errorStatus(err error) int {
+	var apiError *APIError
+	var httpError *echo.HTTPError
+	switch {
+	case errors.As(err, &apiError):
+		return apiError.Status
+	case errors.As(err, &httpError):
+		return httpError.Code
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetMetrics serves the metrics in the Prometheus text format
+func GetMetrics(c echo.Context) error {
+	promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc("freifahren_db_pool_acquired_connections", "Connections currently in use.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc("freifahren_db_pool_idle_connections", "Idle connections in the pool.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc("freifahren_db_pool_total_connections", "All connections of the pool.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc("freifahren_db_pool_max_connections", "Maximum size of the pool.", nil, nil)
+	poolAcquires      = prometheus.NewDesc("freifahren_db_pool_acquires_total", "Connections acquired from the pool.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc("freifahren_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	poolAcquireWait   = prometheus.NewDesc("freifahren_db_pool_acquire_duration_seconds_total", "Time spent acquiring connections.", nil, nil)
+)
+
+// poolCollector reads the statistics of the database pool when the metrics are scraped
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns, poolAcquires, poolEmptyAcquires, poolAcquireWait} {
+		ch <- desc
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := database.PoolStats()
+	if stats == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stats.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stats.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stats.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stats.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stats.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stats.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWait, prometheus.CounterValue, stats.AcquireDuration().Seconds())
+}
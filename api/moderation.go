@@ -0,0 +1,252 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// moderatorName is the name of the admin api key, it is written to the moderation log
+func moderatorName(c echo.Context) string {
+	return apiKeyOf(c).Name
+}
+
+// ListReports returns all reports, including hidden and quarantined ones, matching the query parameters
+func ListReports(c echo.Context) error {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return ValidationFailed(err.Error())
+	}
+
+	filter := structs.ReportFilter{
+		Query:      c.QueryParam("q"),
+		Line:       c.QueryParam("line"),
+		StationID:  c.QueryParam("station"),
+		ReporterID: c.QueryParam("reporter"),
+		Status:     c.QueryParam("status"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+
+	switch filter.Status {
+	case "", structs.ReportStatusVisible, structs.ReportStatusHidden, structs.ReportStatusQuarantined:
+	default:
+		return ValidationFailed("Unknown status: " + filter.Status)
+	}
+
+	if filter.From, err = parseOptionalTime(c.QueryParam("from")); err != nil {
+		return ValidationFailed("Invalid 'from' time, expected RFC3339")
+	}
+	if filter.To, err = parseOptionalTime(c.QueryParam("to")); err != nil {
+		return ValidationFailed("Invalid 'to' time, expected RFC3339")
+	}
+
+	reports, err := database.ListReports(c.Request().Context(), filter)
+	if err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	return c.JSON(http.StatusOK, reports)
+}
+
+func GetReport(c echo.Context) error {
+	report, err := database.GetReport(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return moderationError(err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// EditReport corrects the line, station and direction of a report, the names are resolved like in PostInspector
+func EditReport(c echo.Context) error {
+	var req structs.InspectorRequest
+	if err := c.Bind(&req); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	var linePtr, stationNamePtr, stationIDPtr, directionNamePtr, directionIDPtr *string
+
+	if req.Line != "" {
+		linePtr = &req.Line
+	}
+
+	if req.StationName != "" {
+		stationID, found := FindStationId(req.StationName, stations)
+		if !found {
+			return ValidationFailed("Station not found").WithDetails(map[string]string{"field": "station", "value": req.StationName})
+		}
+		stationNamePtr, stationIDPtr = &req.StationName, &stationID
+	}
+
+	if req.DirectionName != "" {
+		directionID, found := FindStationId(req.DirectionName, stations)
+		if !found {
+			return ValidationFailed("Direction not found").WithDetails(map[string]string{"field": "direction", "value": req.DirectionName})
+		}
+		directionNamePtr, directionIDPtr = &req.DirectionName, &directionID
+	}
+
+	id := c.Param("id")
+	err = database.UpdateReport(c.Request().Context(), moderatorName(c), id, linePtr, stationNamePtr, stationIDPtr, directionNamePtr, directionIDPtr)
+	if err != nil {
+		return moderationError(err)
+	}
+	RecentResponses.Invalidate()
+
+	return GetReport(c)
+}
+
+// HideReport soft deletes a report, it is kept in the database but no longer shown
+func HideReport(c echo.Context) error {
+	var req structs.HideReportRequest
+	if err := c.Bind(&req); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	if err := database.HideReport(c.Request().Context(), moderatorName(c), c.Param("id"), req.Reason); err != nil {
+		return moderationError(err)
+	}
+	RecentResponses.Invalidate()
+
+	report, err := database.GetReport(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return moderationError(err)
+	}
+
+	// The feed leaves the report out by itself, the messages of Matrix and Mastodon have to be deleted
+	go Broadcasts.Retract(report)
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func RestoreReport(c echo.Context) error {
+	if err := database.RestoreReport(c.Request().Context(), moderatorName(c), c.Param("id")); err != nil {
+		return moderationError(err)
+	}
+	RecentResponses.Invalidate()
+
+	return GetReport(c)
+}
+
+// ApproveReport releases a report from the quarantine
+func ApproveReport(c echo.Context) error {
+	if err := database.ApproveReport(c.Request().Context(), moderatorName(c), c.Param("id")); err != nil {
+		return moderationError(err)
+	}
+	RecentResponses.Invalidate()
+
+	return GetReport(c)
+}
+
+func ListBannedReporters(c echo.Context) error {
+	bannedReporters, err := database.ListBannedReporters(c.Request().Context())
+	if err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	return c.JSON(http.StatusOK, bannedReporters)
+}
+
+// BanReporter bans a reporter identity, either given directly or as the reporter of a report
+func BanReporter(c echo.Context) error {
+	var req structs.BanReporterRequest
+	if err := c.Bind(&req); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	if req.ReporterID == "" && req.ReportID != "" {
+		report, err := database.GetReport(c.Request().Context(), req.ReportID)
+		if err != nil {
+			return moderationError(err)
+		}
+		if report.ReporterID == nil {
+			return ValidationFailed("The report has no known reporter")
+		}
+		req.ReporterID = *report.ReporterID
+	}
+
+	if req.ReporterID == "" {
+		return ValidationFailed("Either 'reporterId' or 'reportId' must be provided")
+	}
+
+	if err := database.BanReporter(c.Request().Context(), moderatorName(c), req.ReporterID, req.Reason); err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func UnbanReporter(c echo.Context) error {
+	if err := database.UnbanReporter(c.Request().Context(), moderatorName(c), c.Param("reporterId")); err != nil {
+		return moderationError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetModerationLog returns every moderation action, newest first
+func GetModerationLog(c echo.Context) error {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return ValidationFailed(err.Error())
+	}
+
+	entries, err := database.ListModerationLog(c.Request().Context(), limit, offset)
+	if err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
+func moderationError(err error) error {
+	if errors.Is(err, database.ErrReportNotFound) || errors.Is(err, database.ErrReporterNotBanned) {
+		return NotFound(err.Error())
+	}
+	return Unavailable("Failed to access the database", err)
+}
+
+func parsePagination(c echo.Context) (int, int, error) {
+	limit, offset := defaultPageSize, 0
+
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, 0, errors.New("'limit' must be a positive number")
+		}
+		limit = min(parsed, maxPageSize)
+	}
+
+	if value := c.QueryParam("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("'offset' must not be negative")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/labstack/echo/v4"
+)
+
+// The token returned when subscribing has to be sent in this header to unsubscribe
+const SubscriptionTokenHeader = "X-Subscription-Token"
+
+const (
+	// Sightings are only shown for 15 minutes, so older notifications are dropped by the push service
+	pushTTLSeconds      = 15 * 60
+	notificationTimeout = 10 * time.Second
+	windowTimeFormat    = "15:04"
+)
+
+// ErrSubscriptionExpired is returned when the push service doesn't know the subscription anymore
+var ErrSubscriptionExpired = errors.New("push subscription expired")
+
+// Notifications delivers new sightings to the matching push subscriptions
+var Notifications = NewNotifier(VAPIDConfig{}, NewPublicClient(notificationTimeout))
+
+// VAPIDConfig identifies the server to the Web Push services, the keys are generated with `go run main.go vapid`
+type VAPIDConfig struct {
+	PublicKey  string
+	PrivateKey string
+	// Contact of the operator, e.g. mailto:admin@example.com
+	Subject string
+}
+
+type Notifier struct {
+	vapid  VAPIDConfig
+	client *http.Client
+}
+
+func NewNotifier(vapid VAPIDConfig, client *http.Client) *Notifier {
+	return &Notifier{vapid: vapid, client: client}
+}
+
+// InitNotifications reads the VAPID keys from the environment, without them only webhooks can be subscribed.
+// It has to be called after the .env file has been loaded.
+func InitNotifications() {
+	Notifications = NewNotifier(VAPIDConfig{
+		PublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
+		PrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+		Subject:    os.Getenv("VAPID_SUBJECT"),
+	}, NewPublicClient(notificationTimeout))
+}
+
+func (n *Notifier) WebPushEnabled() bool {
+	return n.vapid.PublicKey != "" && n.vapid.PrivateKey != ""
+}
+
+// Notify sends the sighting to the matching subscriptions in the background, so the report isn't delayed
+func (n *Notifier) Notify(sighting structs.TicketInspector) {
+	go func() {
+		subscriptions, err := database.ListPushSubscriptionsFor(context.Background(), sighting.Station.ID, sighting.Line)
+		if err != nil {
+			slog.Error("Failed to get the push subscriptions", "error", err)
+			return
+		}
+
+		notification := NewPushNotification(sighting)
+		for _, subscription := range subscriptions {
+			if !SubscriptionMatches(subscription, sighting) {
+				continue
+			}
+
+			err := n.Deliver(subscription, notification)
+			if errors.Is(err, ErrSubscriptionExpired) {
+				if err := database.RemoveExpiredPushSubscription(context.Background(), subscription.ID); err != nil {
+					slog.Error("Failed to remove expired push subscription", "subscription", subscription.ID, "error", err)
+				}
+				continue
+			}
+			if err != nil {
+				slog.Warn("Failed to notify push subscription", "subscription", subscription.ID, "error", err)
+			}
+		}
+	}()
+}
+
+// Deliver sends a notification to a single subscription
+func (n *Notifier) Deliver(subscription structs.PushSubscription, notification structs.PushNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	var response *http.Response
+	switch subscription.Channel {
+	case structs.PushChannelWebPush:
+		if !n.WebPushEnabled() {
+			return errors.New("web push is not configured")
+		}
+		response, err = webpush.SendNotification(payload, &webpush.Subscription{
+			Endpoint: subscription.Endpoint,
+			Keys:     webpush.Keys{Auth: subscription.Keys.Auth, P256dh: subscription.Keys.P256dh},
+		}, &webpush.Options{
+			HTTPClient:      n.client,
+			Subscriber:      n.vapid.Subject,
+			VAPIDPublicKey:  n.vapid.PublicKey,
+			VAPIDPrivateKey: n.vapid.PrivateKey,
+			TTL:             pushTTLSeconds,
+			Urgency:         webpush.UrgencyHigh,
+		})
+	case structs.PushChannelWebhook:
+		response, err = n.client.Post(subscription.Endpoint, echo.MIMEApplicationJSON, bytes.NewReader(payload))
+	default:
+		return fmt.Errorf("unknown channel %q", subscription.Channel)
+	}
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Push services answer 404 or 410 for unsubscribed browsers, webhooks unsubscribe with 410 Gone
+	if response.StatusCode == http.StatusGone || (response.StatusCode == http.StatusNotFound && subscription.Channel == structs.PushChannelWebPush) {
+		return ErrSubscriptionExpired
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %d", subscription.Endpoint, response.StatusCode)
+	}
+	return nil
+}
+
+func NewPushNotification(sighting structs.TicketInspector) structs.PushNotification {
+	body := sighting.Timestamp.Local().Format(windowTimeFormat)
+	if sighting.Line != "" {
+		body = sighting.Line + " at " + body
+	}
+	if sighting.Direction.Name != "" {
+		body += ", towards " + sighting.Direction.Name
+	}
+
+	return structs.PushNotification{
+		Title:    "Ticket inspectors at " + sighting.Station.Name,
+		Body:     body,
+		Sighting: sighting,
+	}
+}
+
+// SubscriptionMatches checks the watched stations, lines, weekdays and time of the day of the sighting.
+// Watching both stations and lines only matches sightings at one of the stations on one of the lines.
+func SubscriptionMatches(subscription structs.PushSubscription, sighting structs.TicketInspector) bool {
+	if len(subscription.Stations) > 0 && !slices.Contains(subscription.Stations, sighting.Station.ID) {
+		return false
+	}
+	if len(subscription.Lines) > 0 && !slices.Contains(subscription.Lines, sighting.Line) {
+		return false
+	}
+
+	at := sighting.Timestamp.Local()
+	if len(subscription.Weekdays) > 0 && !slices.Contains(subscription.Weekdays, int(at.Weekday())) {
+		return false
+	}
+
+	if subscription.From == "" || subscription.To == "" {
+		return true
+	}
+	from, errFrom := time.Parse(windowTimeFormat, subscription.From)
+	to, errTo := time.Parse(windowTimeFormat, subscription.To)
+	if errFrom != nil || errTo != nil {
+		return false
+	}
+
+	minute := at.Hour()*60 + at.Minute()
+	fromMinute, toMinute := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	if fromMinute <= toMinute {
+		return minute >= fromMinute && minute <= toMinute
+	}
+	// The window spans midnight, e.g. 22:00 to 02:00
+	return minute >= fromMinute || minute <= toMinute
+}
+
+// GetVAPIDPublicKey returns the key browsers need for subscribing to Web Push
+func GetVAPIDPublicKey(c echo.Context) error {
+	if !Notifications.WebPushEnabled() {
+		return NotFound("Web Push is not configured")
+	}
+	return c.JSON(http.StatusOK, structs.VAPIDKeyResponse{PublicKey: Notifications.vapid.PublicKey})
+}
+
+// CreatePushSubscription registers a Web Push subscription or a webhook for the watched stations and lines.
+// Only partners can subscribe webhooks, everyone else uses Web Push.
+func CreatePushSubscription(c echo.Context) error {
+	var subscription structs.PushSubscription
+	if err := c.Bind(&subscription); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	if subscription.Channel == structs.PushChannelWebhook && !HasRole(RoleOf(c), structs.RolePartner) {
+		return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "Only partners can subscribe webhooks")
+	}
+
+	if err := validatePushSubscription(c.Request().Context(), subscription); err != nil {
+		return err
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return Internal(err)
+	}
+	token := hex.EncodeToString(bytes)
+
+	created, err := database.InsertPushSubscription(c.Request().Context(), subscription, HashApiKey(token))
+	if err != nil {
+		return Unavailable("Failed to save the subscription", err)
+	}
+
+	return c.JSON(http.StatusCreated, structs.PushSubscriptionResponse{PushSubscription: created, Token: token})
+}
+
+// DeletePushSubscription unsubscribes, it needs the token returned when subscribing
+func DeletePushSubscription(c echo.Context) error {
+	token := c.Request().Header.Get(SubscriptionTokenHeader)
+	if token == "" {
+		return NewAPIError(http.StatusUnauthorized, ErrorCodeUnauthorized, "The "+SubscriptionTokenHeader+" header is required")
+	}
+
+	err := database.DeletePushSubscription(c.Request().Context(), c.Param("id"), HashApiKey(token))
+	if errors.Is(err, database.ErrPushSubscriptionNotFound) {
+		return NotFound("No subscription found with this id and token")
+	}
+	if err != nil {
+		return Unavailable("Failed to delete the subscription", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func validatePushSubscription(ctx context.Context, subscription structs.PushSubscription) error {
+	field := func(name, value, message string) error {
+		return ValidationFailed(message).WithDetails(map[string]string{"field": name, "value": value})
+	}
+
+	switch subscription.Channel {
+	case structs.PushChannelWebPush:
+		if !Notifications.WebPushEnabled() {
+			return field("channel", subscription.Channel, "Web Push is not configured on this server")
+		}
+		if !isPushKey(subscription.Keys.P256dh, 65) || !isPushKey(subscription.Keys.Auth, 16) {
+			return ValidationFailed("'keys' must contain the p256dh and auth keys of the subscription")
+		}
+	case structs.PushChannelWebhook:
+	default:
+		return field("channel", subscription.Channel, "'channel' must be webpush or webhook")
+	}
+
+	endpoint, err := url.Parse(subscription.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Hostname() == "" {
+		return field("endpoint", subscription.Endpoint, "'endpoint' must be an https url")
+	}
+
+	if len(subscription.Stations) == 0 && len(subscription.Lines) == 0 {
+		return ValidationFailed("At least one station or line has to be watched")
+	}
+
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return Unavailable("Failed to read the stations", err)
+	}
+	for _, id := range subscription.Stations {
+		if _, ok := stations[id]; !ok {
+			return field("stations", id, "Unknown station id "+id)
+		}
+	}
+
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return Unavailable("Failed to read the lines", err)
+	}
+	for _, line := range subscription.Lines {
+		if _, ok := lines[line]; !ok {
+			return field("lines", line, "Unknown line "+line)
+		}
+	}
+
+	if (subscription.From == "") != (subscription.To == "") {
+		return ValidationFailed("'from' and 'to' have to be given together")
+	}
+	for name, value := range map[string]string{"from": subscription.From, "to": subscription.To} {
+		if _, err := time.Parse(windowTimeFormat, value); value != "" && err != nil {
+			return field(name, value, "'"+name+"' must be a time of the day like 07:30")
+		}
+	}
+
+	for _, weekday := range subscription.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return field("weekdays", fmt.Sprint(weekday), "Weekdays must be between 0 (Sunday) and 6")
+		}
+	}
+
+	// The server must not be used to reach the internal network, the client checks the address again when connecting
+	if err := checkPublicHost(ctx, endpoint.Hostname()); err != nil {
+		return field("endpoint", subscription.Endpoint, "'endpoint' must be a public address")
+	}
+
+	return nil
+}
+
+// isPushKey checks the length of a base64url key, browsers encode them without padding
+func isPushKey(key string, length int) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+	return err == nil && len(decoded) == length
+}
+
+// NewPublicClient returns a client that refuses to connect to loopback, private and link-local addresses,
+// the address is checked after the host is resolved, so DNS can't point it at the internal network
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to the non-public address %s", address)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be the only address the dialer sees
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// checkPublicHost resolves the host and fails if any of its addresses isn't public
+func checkPublicHost(ctx context.Context, host string) error {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return fmt.Errorf("%s resolves to the non-public address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
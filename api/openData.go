@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+const (
+	openDataDateFormat = "2006-01-02"
+	// The snapshot of a day is written a bit after midnight, so late reports of the day are included
+	openDataDelay = 15 * time.Minute
+)
+
+var openDataColumns = []string{"hour", "station_id", "station_name", "station_latitude", "station_longitude", "line", "count"}
+
+// StartOpenDataSnapshots writes the snapshot of the previous day to OPEN_DATA_DIR every night,
+// nothing is published if OPEN_DATA_DIR isn't set
+func StartOpenDataSnapshots() {
+	dir := os.Getenv("OPEN_DATA_DIR")
+	if dir == "" {
+		return
+	}
+
+	go func() {
+		for {
+			yesterday := time.Now().AddDate(0, 0, -1)
+			if _, err := os.Stat(filepath.Join(dir, yesterday.Format(openDataDateFormat))); os.IsNotExist(err) {
+				if _, err := WriteOpenDataSnapshot(context.Background(), dir, yesterday); err != nil {
+					slog.Error("Failed to write the open data snapshot", "error", err)
+				}
+			}
+
+			now := time.Now()
+			nextRun := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local).Add(openDataDelay)
+			time.Sleep(nextRun.Sub(now))
+		}
+	}()
+}
+
+// WriteOpenDataSnapshot writes the reports per hour, station and line of a day to dir/<date>
+func WriteOpenDataSnapshot(ctx context.Context, dir string, day time.Time) (structs.OpenDataManifest, error) {
+	stations, err := ReadStationsList("data/StationsList.json")
+	if err != nil {
+		return structs.OpenDataManifest{}, fmt.Errorf("failed to read the stations: %w", err)
+	}
+
+	// The statistics are refreshed first, they could be up to STATS_REFRESH_MINUTES old
+	if err := database.RefreshStatsViews(ctx); err != nil {
+		return structs.OpenDataManifest{}, err
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	counts, err := database.StatsHourlyCounts(ctx, structs.AggregationFilter{From: start, To: end})
+	if err != nil {
+		return structs.OpenDataManifest{}, err
+	}
+
+	return WriteOpenDataFiles(dir, start, OpenDataRows(counts, stations), time.Now())
+}
+
+// OpenDataRows adds the name and coordinates from the station list to the counts
+func OpenDataRows(counts []structs.HourlyCount, stations map[string]structs.StationListEntry) []structs.OpenDataRow {
+	rows := make([]structs.OpenDataRow, 0, len(counts))
+	for _, count := range counts {
+		row := structs.OpenDataRow{Hour: count.Hour, StationID: count.StationID, Line: count.Line, Count: count.Count}
+		if station, ok := stations[count.StationID]; ok {
+			row.StationName = station.Name
+			row.StationLatitude = &station.Coordinates.Latitude
+			row.StationLongitude = &station.Coordinates.Longitude
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteOpenDataFiles writes the rows as CSV and JSON with a manifest and a SHA256SUMS file.
+// The files are written to a temporary directory first, so a snapshot is either complete or missing.
+func WriteOpenDataFiles(dir string, day time.Time, rows []structs.OpenDataRow, generatedAt time.Time) (structs.OpenDataManifest, error) {
+	date := day.Format(openDataDateFormat)
+	manifest := structs.OpenDataManifest{Date: date, GeneratedAt: generatedAt, Rows: len(rows)}
+	for _, row := range rows {
+		manifest.Reports += row.Count
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return manifest, err
+	}
+	tmp, err := os.MkdirTemp(dir, "."+date+"-")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := []struct {
+		name   string
+		format string
+		write  func(io.Writer) error
+	}{
+		{"counts.csv", "csv", func(w io.Writer) error { return writeOpenDataCSV(w, rows) }},
+		{"counts.json", "json", func(w io.Writer) error { return json.NewEncoder(w).Encode(rows) }},
+	}
+
+	sums := ""
+	for _, file := range files {
+		written, err := writeOpenDataFile(filepath.Join(tmp, file.name), file.write)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+		written.Name, written.Format = file.name, file.format
+		manifest.Files = append(manifest.Files, written)
+		// Same format as sha256sum, so the files can be checked with sha256sum -c SHA256SUMS
+		sums += written.SHA256 + "  " + file.name + "\n"
+	}
+
+	_, err = writeOpenDataFile(filepath.Join(tmp, "manifest.json"), func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(manifest)
+	})
+	if err != nil {
+		return manifest, fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "SHA256SUMS"), []byte(sums), 0o644); err != nil {
+		return manifest, err
+	}
+
+	// Snapshots are written again after imports or moderation changed the day
+	target := filepath.Join(dir, date)
+	if err := os.RemoveAll(target); err != nil {
+		return manifest, err
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return manifest, err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return manifest, err
+	}
+
+	slog.Info("Wrote the open data snapshot", "date", date, "reports", manifest.Reports)
+	return manifest, nil
+}
+
+// writeOpenDataFile returns the size and checksum of the written file
+func writeOpenDataFile(path string, write func(io.Writer) error) (structs.OpenDataFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return structs.OpenDataFile{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{writer: io.MultiWriter(file, hash)}
+	if err := write(counter); err != nil {
+		return structs.OpenDataFile{}, err
+	}
+	if err := file.Close(); err != nil {
+		return structs.OpenDataFile{}, err
+	}
+
+	return structs.OpenDataFile{Size: counter.written, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func writeOpenDataCSV(w io.Writer, rows []structs.OpenDataRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(openDataColumns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		writer.Write([]string{
+			row.Hour.Format(time.RFC3339),
+			row.StationID,
+			row.StationName,
+			valueOrEmpty(row.StationLatitude),
+			valueOrEmpty(row.StationLongitude),
+			row.Line,
+			strconv.Itoa(row.Count),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,598 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// The OpenAPI types only cover the parts of the specification we use
+
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Servers    []OpenAPIServer                 `json:"servers"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+type Operation struct {
+	Summary     string              `json:"summary"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	Security    []map[string][]any  `json:"security,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+var (
+	openAPISpec     OpenAPI
+	openAPISpecOnce sync.Once
+)
+
+// GetOpenAPISpec serves the OpenAPI document describing the /v1 api
+func GetOpenAPISpec(c echo.Context) error {
+	return c.JSONPretty(http.StatusOK, OpenAPISpec(), "  ")
+}
+
+// OpenAPISpec returns the OpenAPI document, the schemas are derived from the structs returned by the handlers
+func OpenAPISpec() OpenAPI {
+	openAPISpecOnce.Do(func() {
+		openAPISpec = buildOpenAPISpec()
+	})
+	return openAPISpec
+}
+
+func buildOpenAPISpec() OpenAPI {
+	schemas := newSchemaGenerator()
+
+	errorResponses := func(statuses ...int) map[string]Response {
+		responses := map[string]Response{}
+		for _, status := range statuses {
+			responses[strconv.Itoa(status)] = jsonResponse(http.StatusText(status), schemas.of(structs.ErrorResponse{}))
+		}
+		return responses
+	}
+	withResponses := func(responses map[string]Response, status int, response Response) map[string]Response {
+		responses[strconv.Itoa(status)] = response
+		return responses
+	}
+	adminSecurity := []map[string][]any{{"apiKey": {}}}
+	formatParameter := Parameter{Name: "format", In: "query", Description: "geojson returns a FeatureCollection, like Accept: application/geo+json", Schema: &Schema{Type: "string", Enum: []string{"geojson"}}}
+	withGeoJSON := func(response Response) Response {
+		response.Content[MIMEApplicationGeoJSON] = MediaType{Schema: schemas.of(structs.FeatureCollection{})}
+		return response
+	}
+	withHeaders := func(response Response, headers map[string]Header) Response {
+		response.Headers = headers
+		return response
+	}
+	aggregationParameters := []Parameter{
+		queryParameter("from", "Start of the period in RFC3339, defaults to 30 days before 'to'", false),
+		queryParameter("to", "End of the period in RFC3339, defaults to now", false),
+		queryParameter("hours", "Comma separated hours of the day, 0 to 23", false),
+		queryParameter("weekdays", "Comma separated weekdays, 0 (Sunday) to 6", false),
+		queryParameter("lines", "Comma separated lines", false),
+		queryParameter("stations", "Comma separated station ids", false),
+	}
+	limitParameter := queryParameter("limit", "Maximum number of results, defaults to 10", false)
+	webhookIDParameter := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}}
+	reportIDParameter := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}}
+
+	paths := map[string]map[string]Operation{
+		"/id": {
+			"get": {
+				Summary:    "Get the id of a station by its name, case and whitespace insensitive",
+				Parameters: []Parameter{queryParameter("name", "Name of the station", true)},
+				Responses:  withResponses(errorResponses(404, 422, 503), 200, jsonResponse("Id of the station", schemas.of(""))),
+			},
+		},
+		"/station": {
+			"get": {
+				Summary:    "Get the name of a station by its id",
+				Parameters: []Parameter{queryParameter("id", "Id of the station", true)},
+				Responses:  withResponses(errorResponses(404, 422, 503), 200, jsonResponse("Name of the station", schemas.of(""))),
+			},
+		},
+		"/recent": {
+			"get": {
+				Summary: "Get the ticket inspectors of the last 15 minutes, filled up with historic data",
+				Parameters: []Parameter{
+					{Name: "If-Modified-Since", In: "header", Description: "Only return the data if it changed since then, an HTTP date like the Last-Modified header", Schema: &Schema{Type: "string"}},
+					{Name: "If-None-Match", In: "header", Description: "Only return the data if its ETag changed, If-Modified-Since is ignored then", Schema: &Schema{Type: "string"}},
+					queryParameter("at", "Replay the ticket inspectors at this time in the past in RFC3339, If-Modified-Since is ignored then", false),
+					formatParameter,
+				},
+				Responses: withResponses(
+					withResponses(errorResponses(422, 503), 304, Response{Description: "Not modified since If-Modified-Since or If-None-Match"}),
+					200, withHeaders(withGeoJSON(jsonResponse("Recent ticket inspectors", schemas.of([]structs.TicketInspector{}))), map[string]Header{
+						"ETag":          {Description: "Send it as If-None-Match to only get changed data", Required: true, Schema: &Schema{Type: "string"}},
+						"Last-Modified": {Description: "Time the ticket inspectors last changed, at least the start of the current hour, not sent when replaying with 'at'", Schema: &Schema{Type: "string"}},
+						"Cache-Control": {Description: "How long the response may be cached", Required: true, Schema: &Schema{Type: "string"}},
+						"Vary":          {Description: "The body depends on Accept and Accept-Encoding", Required: true, Schema: &Schema{Type: "string"}},
+					}),
+				),
+			},
+		},
+		"/history": {
+			"get": {
+				Summary: "Get the sightings of a time range, oldest first",
+				Parameters: []Parameter{
+					queryParameter("from", "Start of the range in RFC3339, defaults to 24 hours before 'to'", false),
+					queryParameter("to", "End of the range in RFC3339, defaults to now", false),
+					queryParameter("lines", "Comma separated lines", false),
+					queryParameter("stations", "Comma separated station ids", false),
+					queryParameter("limit", "Maximum number of sightings, defaults to 50", false),
+					queryParameter("offset", "Number of sightings to skip, use nextOffset of the previous page", false),
+				},
+				Responses: withResponses(errorResponses(422, 503), 200, jsonResponse("Sightings of the range", schemas.of(structs.HistoryResponse{}))),
+			},
+		},
+		"/list": {
+			"get": {
+				Summary: "Get all stations and lines",
+				Parameters: []Parameter{
+					queryParameter("lines", "If true, only return the lines with their stations", false),
+					queryParameter("stations", "If true, only return the stations", false),
+					formatParameter,
+				},
+				Responses: withResponses(errorResponses(503), 200, withGeoJSON(jsonResponse("Stations and lines", &Schema{OneOf: []*Schema{
+					schemas.of(structs.AllStationsAndLinesList{}),
+					schemas.of(map[string][]string{}),
+					schemas.of(map[string]structs.StationListEntry{}),
+				}}))),
+			},
+		},
+		"/stats/heatmap": {
+			"get": {
+				Summary:    "Count the reports per station and line over a period, weighted for a heatmap",
+				Parameters: aggregationParameters,
+				Responses:  withResponses(errorResponses(422, 503), 200, jsonResponse("Report counts", schemas.of(structs.HeatmapResponse{}))),
+			},
+		},
+		"/stats/stations": {
+			"get": {
+				Summary:    "Get the stations with the most reports",
+				Parameters: append(slices.Clone(aggregationParameters), limitParameter),
+				Responses:  withResponses(errorResponses(422, 503), 200, jsonResponse("Stations with their report counts", schemas.of(structs.TopStationsResponse{}))),
+			},
+		},
+		"/stats/lines": {
+			"get": {
+				Summary:    "Get the lines with the most reports",
+				Parameters: append(slices.Clone(aggregationParameters), limitParameter),
+				Responses:  withResponses(errorResponses(422, 503), 200, jsonResponse("Lines with their report counts", schemas.of(structs.TopLinesResponse{}))),
+			},
+		},
+		"/stats/lines/{line}": {
+			"get": {
+				Summary:    "Get the reports of a line per station, weekday and hour",
+				Parameters: append([]Parameter{{Name: "line", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, aggregationParameters...),
+				Responses:  withResponses(errorResponses(404, 422, 503), 200, jsonResponse("Statistics of the line", schemas.of(structs.LineStatsResponse{}))),
+			},
+		},
+		"/stats/matrix": {
+			"get": {
+				Summary:    "Get the number of reports per weekday and hour of the day",
+				Parameters: aggregationParameters,
+				Responses:  withResponses(errorResponses(422, 503), 200, jsonResponse("Report counts indexed by weekday and hour", schemas.of(structs.StatsMatrixResponse{}))),
+			},
+		},
+		"/stats/trends": {
+			"get": {
+				Summary:    "Get the number of reports per week and the change to the previous week",
+				Parameters: append(slices.Clone(aggregationParameters), queryParameter("weeks", "Number of weeks up to 'to', defaults to 12", false)),
+				Responses:  withResponses(errorResponses(422, 503), 200, jsonResponse("Weekly report counts", schemas.of(structs.StatsTrendsResponse{}))),
+			},
+		},
+		"/tiles/{z}/{x}/{y}.mvt": {
+			"get": {
+				Summary: "Get a Mapbox Vector Tile with the layers stations, lines and sightings",
+				Parameters: []Parameter{
+					{Name: "z", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+					{Name: "x", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+					{Name: "y", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+				},
+				Responses: withResponses(errorResponses(404, 422, 503), 200, Response{Description: "Vector tile", Content: map[string]MediaType{
+					MIMEVectorTile: {Schema: &Schema{Type: "string", Format: "binary"}},
+				}}),
+			},
+		},
+		"/feed.xml": {
+			"get": {
+				Summary: "Get the latest sightings as Atom feed",
+				Responses: withResponses(errorResponses(503), 200, Response{Description: "Atom feed", Content: map[string]MediaType{
+					MIMEAtom: {Schema: &Schema{Type: "string"}},
+				}}),
+			},
+		},
+		"/push/vapidPublicKey": {
+			"get": {
+				Summary:   "Get the VAPID public key for subscribing to Web Push",
+				Responses: withResponses(errorResponses(404), 200, jsonResponse("VAPID public key", schemas.of(structs.VAPIDKeyResponse{}))),
+			},
+		},
+		"/subscriptions": {
+			"post": {
+				Summary:     "Get Web Push or webhook notifications for new sightings at the watched stations and lines",
+				RequestBody: jsonRequestBody(schemas.of(structs.PushSubscription{})),
+				Responses:   withResponses(errorResponses(400, 403, 422, 503), 201, jsonResponse("The subscription with the token to delete it", schemas.of(structs.PushSubscriptionResponse{}))),
+			},
+		},
+		"/subscriptions/{id}": {
+			"delete": {
+				Summary: "Unsubscribe from the notifications",
+				Parameters: []Parameter{
+					{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}},
+					{Name: SubscriptionTokenHeader, In: "header", Required: true, Description: "The token returned when subscribing", Schema: &Schema{Type: "string"}},
+				},
+				Responses: withResponses(errorResponses(401, 404, 503), 204, Response{Description: "Unsubscribed"}),
+			},
+		},
+		"/challenge": {
+			"get": {
+				Summary:   "Get a challenge that has to be answered when posting a new ticket inspector",
+				Responses: withResponses(errorResponses(404), 200, jsonResponse("Challenge", schemas.of(structs.ChallengeResponse{}))),
+			},
+		},
+		"/newInspector": {
+			"post": {
+				Summary:     "Report a new ticket inspector",
+				RequestBody: jsonRequestBody(schemas.of(structs.InspectorRequest{})),
+				Responses:   withResponses(errorResponses(400, 403, 422, 429, 503), 200, jsonResponse("The saved report", schemas.of(structs.ResponseData{}))),
+			},
+		},
+		"/graphql": {
+			"get": {
+				Summary: "Query with GraphQL like the POST, with the query in the URL, e.g. for subscriptions with EventSource",
+				Parameters: []Parameter{
+					queryParameter("query", "GraphQL query", true),
+					queryParameter("variables", "Variables of the query as JSON", false),
+					queryParameter("operationName", "Operation to run if the query has several", false),
+				},
+				Responses: withResponses(errorResponses(400, 422, 503), 200, Response{Description: "GraphQL result", Content: map[string]MediaType{
+					"application/json":  {Schema: &Schema{Type: "object"}},
+					"text/event-stream": {Schema: &Schema{Type: "string"}},
+				}}),
+			},
+			"post": {
+				Summary:     "Query stations, lines, sightings and predictions with GraphQL, subscriptions are streamed as server-sent events",
+				RequestBody: jsonRequestBody(&Schema{Type: "object", Properties: map[string]*Schema{"query": {Type: "string"}, "variables": {Type: "object"}, "operationName": {Type: "string"}}, Required: []string{"query"}}),
+				Responses: withResponses(errorResponses(400, 413, 422, 503), 200, Response{Description: "GraphQL result", Content: map[string]MediaType{
+					"application/json":  {Schema: &Schema{Type: "object"}},
+					"text/event-stream": {Schema: &Schema{Type: "string"}},
+				}}),
+			},
+		},
+		"/webhooks": {
+			"get": {
+				Summary:   "List the webhooks of the api key, without their secrets",
+				Security:  adminSecurity,
+				Responses: withResponses(errorResponses(401, 403, 503), 200, jsonResponse("Webhooks", schemas.of([]structs.Webhook{}))),
+			},
+			"post": {
+				Summary:     "Register a webhook for new sightings, the response contains the secret signing the payloads",
+				Security:    adminSecurity,
+				RequestBody: jsonRequestBody(schemas.of(structs.Webhook{})),
+				Responses:   withResponses(errorResponses(400, 401, 403, 422, 503), 201, jsonResponse("The webhook with its secret", schemas.of(structs.Webhook{}))),
+			},
+		},
+		"/webhooks/{id}": {
+			"delete": {
+				Summary:    "Delete a webhook with its delivery log",
+				Security:   adminSecurity,
+				Parameters: []Parameter{webhookIDParameter},
+				Responses:  withResponses(errorResponses(401, 403, 404, 503), 204, Response{Description: "Deleted"}),
+			},
+		},
+		"/webhooks/{id}/deliveries": {
+			"get": {
+				Summary:  "The delivery attempts of a webhook, newest first",
+				Security: adminSecurity,
+				Parameters: []Parameter{
+					webhookIDParameter,
+					{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+					{Name: "offset", In: "query", Schema: &Schema{Type: "integer"}},
+				},
+				Responses: withResponses(errorResponses(401, 403, 404, 422, 503), 200, jsonResponse("Delivery attempts", schemas.of([]structs.WebhookDelivery{}))),
+			},
+		},
+		"/export": {
+			"get": {
+				Summary:  "Export the reports for research, requires a partner api key",
+				Security: adminSecurity,
+				Parameters: []Parameter{
+					{Name: "format", In: "query", Description: "Defaults to csv", Schema: &Schema{Type: "string", Enum: []string{ExportFormatCSV, ExportFormatJSONL, ExportFormatParquet}}},
+					{Name: "from", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+					{Name: "to", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+					{Name: "anonymized", In: "query", Description: "Only admins can export the messages and authors with false", Schema: &Schema{Type: "boolean"}},
+				},
+				Responses: withResponses(errorResponses(401, 403, 422, 503), 200, Response{Description: "The reports with their stations", Content: map[string]MediaType{
+					exportContentTypes[ExportFormatCSV]:     {Schema: &Schema{Type: "string"}},
+					exportContentTypes[ExportFormatJSONL]:   {Schema: schemas.of(structs.ExportRow{})},
+					exportContentTypes[ExportFormatParquet]: {Schema: &Schema{Type: "string", Format: "binary"}},
+				}}),
+			},
+		},
+		"/openapi.json": {
+			"get": {
+				Summary:   "This document",
+				Responses: map[string]Response{"200": {Description: "OpenAPI document", Content: map[string]MediaType{"application/json": {Schema: &Schema{Type: "object"}}}}},
+			},
+		},
+		"/admin/reports": {
+			"get": {
+				Summary:  "List and search reports, including hidden and quarantined ones",
+				Security: adminSecurity,
+				Parameters: []Parameter{
+					queryParameter("q", "Search in message, station and direction", false),
+					queryParameter("line", "Line of the report", false),
+					queryParameter("station", "Station id of the report", false),
+					queryParameter("reporter", "Reporter id of the report", false),
+					{Name: "status", In: "query", Schema: &Schema{Type: "string", Enum: []string{structs.ReportStatusVisible, structs.ReportStatusHidden, structs.ReportStatusQuarantined}}},
+					{Name: "from", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+					{Name: "to", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+					{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+					{Name: "offset", In: "query", Schema: &Schema{Type: "integer"}},
+				},
+				Responses: withResponses(errorResponses(401, 403, 422, 503), 200, jsonResponse("Reports", schemas.of([]structs.Report{}))),
+			},
+		},
+		"/admin/reports/{id}": {
+			"get": {
+				Summary:    "Get a report",
+				Security:   adminSecurity,
+				Parameters: []Parameter{reportIDParameter},
+				Responses:  withResponses(errorResponses(401, 403, 404, 503), 200, jsonResponse("Report", schemas.of(structs.Report{}))),
+			},
+			"put": {
+				Summary:     "Correct the line, station and direction of a report",
+				Security:    adminSecurity,
+				Parameters:  []Parameter{reportIDParameter},
+				RequestBody: jsonRequestBody(schemas.of(structs.InspectorRequest{})),
+				Responses:   withResponses(errorResponses(400, 401, 403, 404, 422, 503), 200, jsonResponse("Report", schemas.of(structs.Report{}))),
+			},
+		},
+		"/admin/reports/{id}/hide": {
+			"post": {
+				Summary:     "Hide a report",
+				Security:    adminSecurity,
+				Parameters:  []Parameter{reportIDParameter},
+				RequestBody: jsonRequestBody(schemas.of(structs.HideReportRequest{})),
+				Responses:   withResponses(errorResponses(400, 401, 403, 404, 503), 200, jsonResponse("Report", schemas.of(structs.Report{}))),
+			},
+		},
+		"/admin/reports/{id}/restore": {
+			"post": {
+				Summary:    "Show a hidden report again",
+				Security:   adminSecurity,
+				Parameters: []Parameter{reportIDParameter},
+				Responses:  withResponses(errorResponses(401, 403, 404, 503), 200, jsonResponse("Report", schemas.of(structs.Report{}))),
+			},
+		},
+		"/admin/reports/{id}/approve": {
+			"post": {
+				Summary:    "Release a quarantined report",
+				Security:   adminSecurity,
+				Parameters: []Parameter{reportIDParameter},
+				Responses:  withResponses(errorResponses(401, 403, 404, 503), 200, jsonResponse("Report", schemas.of(structs.Report{}))),
+			},
+		},
+		"/admin/bans": {
+			"get": {
+				Summary:   "List banned reporters",
+				Security:  adminSecurity,
+				Responses: withResponses(errorResponses(401, 403, 503), 200, jsonResponse("Banned reporters", schemas.of([]structs.BannedReporter{}))),
+			},
+			"post": {
+				Summary:     "Ban a reporter",
+				Security:    adminSecurity,
+				RequestBody: jsonRequestBody(schemas.of(structs.BanReporterRequest{})),
+				Responses:   withResponses(errorResponses(400, 401, 403, 404, 422, 503), 204, Response{Description: "Banned"}),
+			},
+		},
+		"/admin/bans/{reporterId}": {
+			"delete": {
+				Summary:    "Lift the ban of a reporter",
+				Security:   adminSecurity,
+				Parameters: []Parameter{{Name: "reporterId", In: "path", Required: true, Schema: &Schema{Type: "string"}}},
+				Responses:  withResponses(errorResponses(401, 403, 404, 503), 204, Response{Description: "Unbanned"}),
+			},
+		},
+		"/admin/log": {
+			"get": {
+				Summary:  "Get the moderation log",
+				Security: adminSecurity,
+				Parameters: []Parameter{
+					{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+					{Name: "offset", In: "query", Schema: &Schema{Type: "integer"}},
+				},
+				Responses: withResponses(errorResponses(401, 403, 422, 503), 200, jsonResponse("Moderation log", schemas.of([]structs.ModerationLogEntry{}))),
+			},
+		},
+	}
+
+	return OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "FreiFahren API",
+			Description: "Live map of ticket inspectors in the Berlin public transport network",
+			Version:     "1",
+		},
+		Servers: []OpenAPIServer{{URL: "/v1"}},
+		Paths:   paths,
+		Components: Components{
+			Schemas: schemas.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				"apiKey": {Type: "apiKey", In: "header", Name: ApiKeyHeader},
+			},
+		},
+	}
+}
+
+func queryParameter(name, description string, required bool) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Required: required, Schema: &Schema{Type: "string"}}
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return Response{Description: description, Content: map[string]MediaType{"application/json": {Schema: schema}}}
+}
+
+func jsonRequestBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: schema}}}
+}
+
+// schemaGenerator derives schemas from Go types, structs are added as named components
+type schemaGenerator struct {
+	components map[string]*Schema
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{components: map[string]*Schema{}}
+}
+
+func (g *schemaGenerator) of(value interface{}) *Schema {
+	return g.schemaFor(reflect.TypeOf(value))
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) *Schema {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &Schema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(sql.NullString{}):
+		return &Schema{Type: "string", Nullable: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schemaFor(t.Elem())
+		if schema.Ref != "" {
+			// $ref can't have siblings in OpenAPI 3.0
+			return &Schema{OneOf: []*Schema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		// interface{}, anything is allowed, including null
+		return &Schema{Nullable: true}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+	if _, exists := g.components[t.Name()]; exists {
+		return ref
+	}
+
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	// Register before the fields, in case the struct references itself
+	g.components[t.Name()] = schema
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return ref
+}
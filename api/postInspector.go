@@ -1,12 +1,14 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/FreiFahren/backend/database"
 	. "github.com/FreiFahren/backend/structs"
 	"github.com/labstack/echo/v4"
 )
@@ -14,26 +16,41 @@ import (
 func PostInspector(c echo.Context) error {
 	var req InspectorRequest
 	if err := c.Bind(&req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		return InvalidRequest("Invalid request body").WithInternal(err)
 	}
 
 	// Check if all parameters are empty
 	if req.Line == "" && req.StationName == "" && req.DirectionName == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "At least one of 'line', 'station', or 'direction' must be provided")
+		return ValidationFailed("At least one of 'line', 'station', or 'direction' must be provided")
 	}
 
-	data, err := processRequestData(req)
+	sources := reportSources(c)
+
+	// Reports of trusted reporters are not attributed to a source, they are never quarantined or banned
+	if isTrustedReporter(c) {
+		sources = nil
+	} else {
+		banned, err := Reports.IsReporterBanned(c.Request().Context(), reporterIDs(sources))
+		if err != nil {
+			return Unavailable("Failed to check the reporter", err)
+		}
+		if banned {
+			return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "You have been banned from reporting")
+		}
+	}
+
+	data, err := processRequestData(c.Request().Context(), req, sources)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, data)
 }
 
-func processRequestData(req InspectorRequest) (*ResponseData, error) {
+func processRequestData(ctx context.Context, req InspectorRequest, sources []string) (*ResponseData, error) {
 	stations, err := ReadFromFile("data/StationsList.json")
 	if err != nil {
-		return nil, err
+		return nil, Unavailable("Failed to read the stations", err)
 	}
 
 	data := &ResponseData{}
@@ -54,7 +71,8 @@ func processRequestData(req InspectorRequest) (*ResponseData, error) {
 			stationIDPtr = &stationID
 			data.Station = Station{Name: req.StationName, ID: stationID}
 		} else {
-			return nil, fmt.Errorf("Station not found")
+			stationResolutionFailures.WithLabelValues("station").Inc()
+			return nil, ValidationFailed("Station not found").WithDetails(map[string]string{"field": "station", "value": req.StationName})
 		}
 	}
 
@@ -64,16 +82,37 @@ func processRequestData(req InspectorRequest) (*ResponseData, error) {
 			directionIDPtr = &directionID
 			data.Direction = Station{Name: req.DirectionName, ID: directionID}
 		} else {
-			return nil, fmt.Errorf("direction not found")
+			stationResolutionFailures.WithLabelValues("direction").Inc()
+			return nil, ValidationFailed("Direction not found").WithDetails(map[string]string{"field": "direction", "value": req.DirectionName})
 		}
 	}
 
 	now := time.Now()
 
-	log.Printf("Inserted ticket info: %v", data)
+	// Reports of sources that report many different stations in a short time
+	// are stored but kept out of /recent until they have been reviewed.
+	quarantined := false
+	if stationIDPtr != nil {
+		for _, source := range sources {
+			if reportBursts.Record(source, *stationIDPtr, now) {
+				quarantined = true
+			}
+		}
+	}
+	var reporterIDPtr *string
+	if len(sources) > 0 {
+		reporterID := ReporterID(sources[0])
+		reporterIDPtr = &reporterID
+	}
+	if quarantined {
+		slog.WarnContext(ctx, "Quarantining ticket info", "reporter_id", *reporterIDPtr, "line", data.Line, "station", data.Station.ID, "direction", data.Direction.ID)
+	}
+
+	slog.InfoContext(ctx, "Inserting ticket info", "line", data.Line, "station", data.Station.ID, "direction", data.Direction.ID)
 
 	// Directly pass the pointers for all parameters.
-	if err := database.InsertTicketInfo(
+	if err := Reports.InsertTicketInfo(
+		ctx,
 		&now,
 		nil,
 		nil,
@@ -82,8 +121,22 @@ func processRequestData(req InspectorRequest) (*ResponseData, error) {
 		stationIDPtr,
 		directionNamePtr,
 		directionIDPtr,
+		reporterIDPtr,
+		quarantined,
 	); err != nil {
-		return nil, fmt.Errorf("failed to insert ticket info into database: %v", err)
+		return nil, Unavailable("Failed to save the report", fmt.Errorf("failed to insert ticket info into database: %w", err))
+	}
+
+	reportsInserted.WithLabelValues(strconv.FormatBool(quarantined)).Inc()
+
+	// Let the live subscribers and push subscriptions know, quarantined reports stay hidden until they are reviewed
+	if !quarantined && stationIDPtr != nil {
+		publishSighting(TicketInfo{
+			Timestamp:    now,
+			Station_ID:   *stationIDPtr,
+			Line:         sql.NullString{String: req.Line, Valid: linePtr != nil},
+			Direction_ID: sql.NullString{String: data.Direction.ID, Valid: directionIDPtr != nil},
+		})
 	}
 
 	return data, nil
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Sightings are added and expire all the time, so /recent is only cached briefly and dropped on every new report
+	recentMaxAge = 15 * time.Second
+	// The stations and lines only change with a deploy
+	listMaxAge = time.Hour
+	// Every combination of query parameters is a separate entry, so their number is limited
+	maxCachedResponses = 256
+)
+
+// RecentResponses caches /recent, it is invalidated when reports are added or moderated
+var RecentResponses = NewResponseCache(recentMaxAge, "at")
+
+// ListResponses caches /list
+var ListResponses = NewResponseCache(listMaxAge, "lines", "stations")
+
+// ResponseCache keeps the successful GET responses of a route by the query parameters its handler reads
+// and the media type, together with their gzip and brotli encoding and a strong ETag.
+// When it is full, the least recently used response is dropped.
+type ResponseCache struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	params []string
+	// The values of entries are elements of recent, which holds the keys, the most recently used first
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+type cacheEntry struct {
+	key      string
+	response *cachedResponse
+}
+
+type cachedResponse struct {
+	contentType  string
+	etag         string
+	lastModified time.Time
+	expires      time.Time
+	// Body by content encoding, "" is the uncompressed body
+	bodies map[string][]byte
+}
+
+// NewResponseCache returns a cache for a route whose handler reads the given query parameters,
+// other parameters don't lead to separate entries
+func NewResponseCache(maxAge time.Duration, params ...string) *ResponseCache {
+	return &ResponseCache{maxAge: maxAge, params: params, entries: make(map[string]*list.Element), recent: list.New()}
+}
+
+// Invalidate drops all cached responses
+func (rc *ResponseCache) Invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries = make(map[string]*list.Element)
+	rc.recent.Init()
+}
+
+// Middleware answers from the cache or caches the response of the handler
+func (rc *ResponseCache) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet {
+			return next(c)
+		}
+
+		key := rc.cacheKey(c)
+		if entry := rc.get(key); entry != nil {
+			c.Response().Header().Set("X-Cache", "HIT")
+			return rc.serve(c, entry)
+		}
+
+		entry, err := rc.record(c, next)
+		if err != nil || entry == nil {
+			return err
+		}
+		rc.put(key, entry)
+
+		c.Response().Header().Set("X-Cache", "MISS")
+		return rc.serve(c, entry)
+	}
+}
+
+// cacheKey contains everything the handler chooses the response by: the path, the values of its query parameters
+// and the media type, so unknown parameters and different spellings of the Accept header share an entry
+func (rc *ResponseCache) cacheKey(c echo.Context) string {
+	values := url.Values{}
+	for _, param := range rc.params {
+		if value := c.QueryParam(param); value != "" {
+			values.Set(param, value)
+		}
+	}
+
+	mediaType := echo.MIMEApplicationJSON
+	if isGeoJSONRequest(c) {
+		mediaType = MIMEApplicationGeoJSON
+	}
+	return c.Path() + "?" + values.Encode() + "\n" + mediaType
+}
+
+func (rc *ResponseCache) get(key string) *cachedResponse {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(cacheEntry)
+	if time.Now().After(entry.response.expires) {
+		return nil
+	}
+	rc.recent.MoveToFront(element)
+	return entry.response
+}
+
+func (rc *ResponseCache) put(key string, response *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if element, ok := rc.entries[key]; ok {
+		element.Value = cacheEntry{key: key, response: response}
+		rc.recent.MoveToFront(element)
+		return
+	}
+
+	rc.entries[key] = rc.recent.PushFront(cacheEntry{key: key, response: response})
+	if rc.recent.Len() > maxCachedResponses {
+		oldest := rc.recent.Back()
+		rc.recent.Remove(oldest)
+		delete(rc.entries, oldest.Value.(cacheEntry).key)
+	}
+}
+
+// record runs the handler with a buffered response, only 200 responses are returned for caching
+func (rc *ResponseCache) record(c echo.Context, next echo.HandlerFunc) (*cachedResponse, error) {
+	response := c.Response()
+	writer := response.Writer
+	recorder := &responseRecorder{header: writer.Header(), status: http.StatusOK}
+	response.Writer = recorder
+
+	// The cache evaluates the conditional headers itself, so the handler has to return the full response
+	req := c.Request()
+	conditional := req.Header.Clone()
+	req.Header.Del("If-None-Match")
+	req.Header.Del(echo.HeaderIfModifiedSince)
+
+	err := next(c)
+	response.Writer = writer
+	req.Header = conditional
+
+	if err != nil || recorder.status != http.StatusOK {
+		// Pass on what the handler already wrote, e.g. a 304 or an error it handled itself
+		if recorder.wroteHeader {
+			writer.WriteHeader(recorder.status)
+			writer.Write(recorder.body.Bytes())
+		}
+		return nil, err
+	}
+
+	entry, err := newCachedResponse(writer.Header().Get(echo.HeaderContentType), recorder.body.Bytes(), time.Now().Add(rc.maxAge))
+	if err != nil {
+		return nil, Internal(err)
+	}
+	entry.lastModified, _ = ParseHTTPDate(writer.Header().Get(echo.HeaderLastModified))
+	// The handler's response was buffered, so it is sent again by serve
+	response.Committed = false
+	response.Size = 0
+	return entry, nil
+}
+
+func newCachedResponse(contentType string, body []byte, expires time.Time) (*cachedResponse, error) {
+	var gzipped bytes.Buffer
+	gzipWriter, err := gzip.NewWriterLevel(&gzipped, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	gzipWriter.Write(body)
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	var brotlied bytes.Buffer
+	brotliWriter := brotli.NewWriterLevel(&brotlied, brotli.BestCompression)
+	brotliWriter.Write(body)
+	if err := brotliWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	// The ETag is a hash of the uncompressed body, the encodings get their own variants
+	return &cachedResponse{
+		contentType: contentType,
+		etag:        strings.Trim(ETagOf(body), `"`),
+		expires:     expires,
+		bodies:      map[string][]byte{"": body, "gzip": gzipped.Bytes(), "br": brotlied.Bytes()},
+	}, nil
+}
+
+// serve sends the entry in the best encoding the client accepts, or 304 if the client has it already
+func (rc *ResponseCache) serve(c echo.Context, entry *cachedResponse) error {
+	encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+	etag := `"` + entry.etag + `"`
+	if encoding != "" {
+		// Strong ETags must differ between the encodings of a body
+		etag = `"` + entry.etag + "-" + encoding + `"`
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	// The cache key contains the media type chosen by the Accept header
+	header.Set(echo.HeaderVary, echo.HeaderAccept+", "+echo.HeaderAcceptEncoding)
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", max(0, int(time.Until(entry.expires).Round(time.Second).Seconds()))))
+	setLastModified(c, entry.lastModified)
+
+	if NotModified(c.Request(), etag, entry.lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if encoding != "" {
+		header.Set(echo.HeaderContentEncoding, encoding)
+	}
+	return c.Blob(http.StatusOK, entry.contentType, entry.bodies[encoding])
+}
+
+// negotiateEncoding prefers brotli over gzip, encodings with q=0 are refused
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = quality > 0
+	}
+
+	for _, encoding := range []string{"br", "gzip"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// responseRecorder buffers the response of a handler, headers are set on the real response
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.wroteHeader = true
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(p)
+}
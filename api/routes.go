@@ -0,0 +1,87 @@
+package api
+
+import (
+	"slices"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RegisterRoutes adds all routes of the api to the group, the middlewares are applied to every route
+func RegisterRoutes(group *echo.Group, middlewares ...echo.MiddlewareFunc) {
+	// Return the id for given name
+	group.GET("/id", GetStationId, middlewares...)
+
+	// Return the last known inspectors 15 mins ago, or 15 mins before ?at= in the past
+	group.GET("/recent", GetRecentTicketInspectorInfo, slices.Concat(middlewares, []echo.MiddlewareFunc{RecentResponses.Middleware})...)
+
+	// Return the sightings of a time range, for scrubbing through a timeline
+	group.GET("/history", GetHistory, middlewares...)
+
+	// Return the name for given id
+	group.GET("/station", GetStationName, middlewares...)
+
+	// Return all stations with their id (used for suggestions on the frontend)
+	group.GET("/list", GetAllStationsAndLines, slices.Concat(middlewares, []echo.MiddlewareFunc{ListResponses.Middleware})...)
+
+	// Return the number of reports per station and line, weighted for a heatmap
+	group.GET("/stats/heatmap", GetHeatmap, middlewares...)
+
+	// Statistics of the reports, refreshed every STATS_REFRESH_MINUTES
+	group.GET("/stats/stations", GetTopStations, middlewares...)
+	group.GET("/stats/lines", GetTopLines, middlewares...)
+	group.GET("/stats/lines/:line", GetLineStats, middlewares...)
+	group.GET("/stats/matrix", GetStatsMatrix, middlewares...)
+	group.GET("/stats/trends", GetStatsTrends, middlewares...)
+
+	// Return a vector tile with the stations, lines and recent sightings, e.g. /tiles/12/2200/1343.mvt
+	group.GET("/tiles/:z/:x/:y", GetTile, middlewares...)
+
+	// Return the OpenAPI document describing the api
+	group.GET("/openapi.json", GetOpenAPISpec, middlewares...)
+
+	// Query stations, lines, sightings and predictions, and subscribe to new sightings
+	graphQLMiddlewares := slices.Concat(middlewares, []echo.MiddlewareFunc{middleware.BodyLimit(MaxGraphQLBodySize)})
+	group.GET("/graphql", GraphQL, graphQLMiddlewares...)
+	group.POST("/graphql", GraphQL, graphQLMiddlewares...)
+
+	// Atom feed of the latest sightings, feed readers keep the url they subscribed to,
+	// so the feed without version isn't deprecated
+	group.GET("/feed.xml", GetFeed)
+
+	// Subscribe to notifications for new sightings at watched stations and lines
+	group.GET("/push/vapidPublicKey", GetVAPIDPublicKey, middlewares...)
+	group.POST("/subscriptions", CreatePushSubscription, middlewares...)
+	group.DELETE("/subscriptions/:id", DeletePushSubscription, middlewares...)
+
+	// Return a challenge that has to be answered when posting a new ticket inspector
+	group.GET("/challenge", GetChallenge, middlewares...)
+
+	// Post a new ticket inspector
+	reportMiddlewares := slices.Concat(middlewares, ReportRateLimiters(), []echo.MiddlewareFunc{RequireChallenge})
+	group.POST("/newInspector", PostInspector, reportMiddlewares...)
+
+	// Webhooks of partner integrations, only accessible with a partner api key
+	partnerMiddlewares := slices.Concat(middlewares, []echo.MiddlewareFunc{RequireRole(structs.RolePartner)})
+	group.POST("/webhooks", CreateWebhook, partnerMiddlewares...)
+	group.GET("/webhooks", ListWebhooks, partnerMiddlewares...)
+	group.DELETE("/webhooks/:id", DeleteWebhook, partnerMiddlewares...)
+	group.GET("/webhooks/:id/deliveries", GetWebhookDeliveries, partnerMiddlewares...)
+
+	// Export the reports for research, only accessible with a partner api key
+	group.GET("/export", Export, partnerMiddlewares...)
+
+	// Moderation of reports, only accessible with an admin api key
+	adminMiddlewares := slices.Concat(middlewares, []echo.MiddlewareFunc{RequireRole(structs.RoleAdmin)})
+	group.GET("/admin/reports", ListReports, adminMiddlewares...)
+	group.GET("/admin/reports/:id", GetReport, adminMiddlewares...)
+	group.PUT("/admin/reports/:id", EditReport, adminMiddlewares...)
+	group.POST("/admin/reports/:id/hide", HideReport, adminMiddlewares...)
+	group.POST("/admin/reports/:id/restore", RestoreReport, adminMiddlewares...)
+	group.POST("/admin/reports/:id/approve", ApproveReport, adminMiddlewares...)
+	group.GET("/admin/bans", ListBannedReporters, adminMiddlewares...)
+	group.POST("/admin/bans", BanReporter, adminMiddlewares...)
+	group.DELETE("/admin/bans/:reporterId", UnbanReporter, adminMiddlewares...)
+	group.GET("/admin/log", GetModerationLog, adminMiddlewares...)
+}
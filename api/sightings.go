@@ -0,0 +1,69 @@
+package api
+
+import (
+	"log/slog"
+	"sync"
+
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+// Sightings fans out every new report to the live subscribers, e.g. GraphQL subscriptions
+var Sightings = NewSightingBroker()
+
+type SightingBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan structs.TicketInspector]struct{}
+}
+
+func NewSightingBroker() *SightingBroker {
+	return &SightingBroker{subscribers: make(map[chan structs.TicketInspector]struct{})}
+}
+
+// Subscribe returns a channel receiving all new sightings and a function to unsubscribe again
+func (b *SightingBroker) Subscribe() (<-chan structs.TicketInspector, func()) {
+	subscriber := make(chan structs.TicketInspector, 16)
+
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, subscriber)
+			b.mu.Unlock()
+			close(subscriber)
+		})
+	}
+
+	return subscriber, unsubscribe
+}
+
+// Publish sends the sighting to every subscriber, slow subscribers miss it instead of blocking the report
+func (b *SightingBroker) Publish(sighting structs.TicketInspector) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- sighting:
+		default:
+		}
+	}
+}
+
+// publishSighting is called for every new report, it notifies the live subscribers, the push subscriptions, the webhooks and the broadcasters
+func publishSighting(ticketInfo structs.TicketInfo) {
+	RecentResponses.Invalidate()
+
+	sightings, err := constructTicketInspectors([]structs.TicketInfo{ticketInfo})
+	if err != nil {
+		slog.Error("Failed to publish sighting", "error", err)
+		return
+	}
+	Sightings.Publish(sightings[0])
+	Notifications.Notify(sightings[0])
+	Webhooks.Dispatch(sightings[0])
+	Broadcasts.Publish(sightings[0])
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultStatsLimit = 10
+	maxStatsLimit     = 100
+
+	defaultTrendWeeks = 12
+	maxTrendWeeks     = 104
+
+	defaultStatsRefreshMinutes = 60
+)
+
+// StartStatsRefresh refreshes the materialized views of the statistics every STATS_REFRESH_MINUTES
+func StartStatsRefresh() {
+	interval := time.Duration(envInt("STATS_REFRESH_MINUTES", defaultStatsRefreshMinutes)) * time.Minute
+
+	go func() {
+		for {
+			if err := database.RefreshStatsViews(context.Background()); err != nil {
+				slog.Error("Failed to refresh the statistics", "error", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// GetTopStations returns the stations with the most reports
+func GetTopStations(c echo.Context) error {
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+	if filter.Limit, err = parseStatsLimit(c); err != nil {
+		return err
+	}
+
+	counts, err := database.StatsCounts(c.Request().Context(), database.GroupByStation, filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	stations, err := stationCounts(counts)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, structs.TopStationsResponse{From: filter.From, To: filter.To, Stations: stations})
+}
+
+// GetTopLines returns the lines with the most reports
+func GetTopLines(c echo.Context) error {
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+	if filter.Limit, err = parseStatsLimit(c); err != nil {
+		return err
+	}
+
+	counts, err := database.StatsCounts(c.Request().Context(), database.GroupByLine, filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	lines := make([]structs.LineCount, 0, len(counts))
+	for _, count := range counts {
+		lines = append(lines, structs.LineCount{Line: count.Key, Count: count.Count})
+	}
+
+	return c.JSON(http.StatusOK, structs.TopLinesResponse{From: filter.From, To: filter.To, Lines: lines})
+}
+
+// GetStatsMatrix returns the number of reports per weekday and hour of the day
+func GetStatsMatrix(c echo.Context) error {
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+
+	matrix, err := database.StatsMatrix(c.Request().Context(), filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	return c.JSON(http.StatusOK, structs.StatsMatrixResponse{From: filter.From, To: filter.To, Counts: matrixRows(matrix)})
+}
+
+// GetStatsTrends returns the number of reports of the last weeks and the change to the week before
+func GetStatsTrends(c echo.Context) error {
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+
+	weeks := defaultTrendWeeks
+	if value := c.QueryParam("weeks"); value != "" {
+		weeks, err = strconv.Atoi(value)
+		if err != nil || weeks <= 0 || weeks > maxTrendWeeks {
+			return ValidationFailed(fmt.Sprintf("'weeks' must be between 1 and %d", maxTrendWeeks)).WithDetails(map[string]string{"field": "weeks", "value": value})
+		}
+	}
+
+	// The week before the first one is needed for its change
+	lastWeek := WeekStart(filter.To)
+	firstWeek := lastWeek.AddDate(0, 0, -7*(weeks-1))
+	filter.From = firstWeek.AddDate(0, 0, -7)
+
+	counts, err := database.StatsWeeklyCounts(c.Request().Context(), filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	return c.JSON(http.StatusOK, structs.StatsTrendsResponse{Weeks: WeeklyTrends(counts, firstWeek, weeks)})
+}
+
+// GetLineStats returns the reports of a line per station, weekday and hour
+func GetLineStats(c echo.Context) error {
+	line := c.Param("line")
+
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return Unavailable("Failed to read the lines", err)
+	}
+	if _, ok := lines[line]; !ok {
+		return NotFound("No line found with the name " + line)
+	}
+
+	filter, err := parseAggregationFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.Lines = []string{line}
+
+	counts, err := database.StatsCounts(c.Request().Context(), database.GroupByStation, filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	matrix, err := database.StatsMatrix(c.Request().Context(), filter)
+	if err != nil {
+		return Unavailable("Failed to get the statistics", err)
+	}
+
+	stations, err := stationCounts(counts)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, LineStats(line, filter, stations, matrix))
+}
+
+// LineStats sums up the reports of the line from its counts per weekday and hour
+func LineStats(line string, filter structs.AggregationFilter, stations []structs.StationCount, matrix [7][24]int) structs.LineStatsResponse {
+	response := structs.LineStatsResponse{
+		Line:     line,
+		From:     filter.From,
+		To:       filter.To,
+		Stations: stations,
+		Counts:   matrixRows(matrix),
+	}
+	for _, row := range matrix {
+		for _, count := range row {
+			response.Count += count
+		}
+	}
+	return response
+}
+
+// WeekStart returns the monday the week of t starts with, like date_trunc('week', t) in Postgres.
+// The reports are stored in local time, so the weeks start at local midnight.
+func WeekStart(t time.Time) time.Time {
+	t = t.Local()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.Local)
+}
+
+// WeeklyTrends lists the counts of the weeks from firstWeek on, weeks without reports are counted as 0
+func WeeklyTrends(counts map[time.Time]int, firstWeek time.Time, weeks int) []structs.WeeklyTrend {
+	trends := make([]structs.WeeklyTrend, 0, weeks)
+	previous := counts[firstWeek.AddDate(0, 0, -7)]
+
+	for i := 0; i < weeks; i++ {
+		week := firstWeek.AddDate(0, 0, 7*i)
+		trend := structs.WeeklyTrend{WeekStart: week, Count: counts[week]}
+		if previous > 0 {
+			change := float64(trend.Count-previous) / float64(previous)
+			trend.Change = &change
+		}
+		trends = append(trends, trend)
+		previous = trend.Count
+	}
+
+	return trends
+}
+
+func stationCounts(counts []structs.ReportCount) ([]structs.StationCount, error) {
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return nil, Unavailable("Failed to read the stations", err)
+	}
+
+	stationCounts := make([]structs.StationCount, 0, len(counts))
+	for _, count := range counts {
+		// Stations that were removed from the station list keep their id
+		station := stations[count.Key]
+		station.ID = count.Key
+		stationCounts = append(stationCounts, structs.StationCount{Station: station, Count: count.Count})
+	}
+	return stationCounts, nil
+}
+
+func matrixRows(matrix [7][24]int) [][]int {
+	rows := make([][]int, len(matrix))
+	for weekday := range matrix {
+		rows[weekday] = matrix[weekday][:]
+	}
+	return rows
+}
+
+func parseStatsLimit(c echo.Context) (int, error) {
+	value := c.QueryParam("limit")
+	if value == "" {
+		return defaultStatsLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, ValidationFailed("'limit' must be a positive number").WithDetails(map[string]string{"field": "limit", "value": value})
+	}
+	return min(limit, maxStatsLimit), nil
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	// Long polling, Telegram answers getUpdates as soon as there is a message or after this timeout
+	telegramPollTimeout = 30 * time.Second
+	telegramRetryDelay  = 5 * time.Second
+)
+
+const telegramHelp = `Commands:
+/recent [line] - inspectors of the last 15 minutes, e.g. /recent U8
+/station <name> - lines and recent inspectors of a station, e.g. /station Hermannplatz
+/risk <from> <to> - how likely inspectors are on the way, e.g. /risk Alexanderplatz Kottbusser Tor`
+
+type TelegramBotConfig struct {
+	// Base url of the Bot API, changed to a local stub in tests
+	APIURL string
+	Token  string
+	// Reply to reports in the chat with the station they were resolved to
+	ReplyToReports bool
+	Client         *http.Client
+	// Sightings returns the sightings at the time like /recent, RecentTicketInspectors by default
+	Sightings func(ctx context.Context, at time.Time) ([]structs.TicketInspector, error)
+}
+
+// TelegramBot answers commands and reports in Telegram chats
+type TelegramBot struct {
+	config   TelegramBotConfig
+	stations map[string]structs.Station
+	lines    map[string][]string
+	importer *Importer
+	offset   int64
+}
+
+type telegramUpdate struct {
+	UpdateID int64               `json:"update_id"`
+	Message  *telegramBotMessage `json:"message"`
+}
+
+type telegramBotMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+func NewTelegramBot(config TelegramBotConfig) (*TelegramBot, error) {
+	if config.APIURL == "" {
+		config.APIURL = defaultTelegramAPIURL
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: telegramPollTimeout + 10*time.Second}
+	}
+	if config.Sightings == nil {
+		config.Sightings = RecentTicketInspectors
+	}
+
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the stations: %w", err)
+	}
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the lines: %w", err)
+	}
+
+	return &TelegramBot{config: config, stations: stations, lines: lines, importer: NewImporter(stations, lines)}, nil
+}
+
+// StartTelegramBot answers the chats of TELEGRAM_BOT_TOKEN, the bot is disabled if it isn't set
+func StartTelegramBot() {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return
+	}
+
+	bot, err := NewTelegramBot(TelegramBotConfig{
+		APIURL:         os.Getenv("TELEGRAM_API_URL"),
+		Token:          token,
+		ReplyToReports: os.Getenv("TELEGRAM_REPLY_TO_REPORTS") == "true",
+	})
+	if err != nil {
+		slog.Error("Failed to start the Telegram bot", "error", err)
+		return
+	}
+
+	go bot.Run(context.Background())
+}
+
+// Run polls for new messages and answers them until the context is cancelled
+func (b *TelegramBot) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := b.Poll(ctx, telegramPollTimeout); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to get the Telegram updates", "error", err)
+			time.Sleep(telegramRetryDelay)
+		}
+	}
+}
+
+// Poll handles the messages that arrived since the last poll, waiting up to timeout for new ones
+func (b *TelegramBot) Poll(ctx context.Context, timeout time.Duration) error {
+	var updates []telegramUpdate
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          b.offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		b.offset = update.UpdateID + 1
+		if update.Message == nil {
+			continue
+		}
+		if err := b.handleMessage(ctx, *update.Message); err != nil {
+			slog.Warn("Failed to answer Telegram message", "message", update.Message.MessageID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (b *TelegramBot) handleMessage(ctx context.Context, message telegramBotMessage) error {
+	text := strings.TrimSpace(message.Text)
+
+	reply := ""
+	if strings.HasPrefix(text, "/") {
+		reply = b.Answer(ctx, text, time.Time{})
+	} else if b.config.ReplyToReports {
+		reply = b.ResolveReport(text)
+	}
+	if reply == "" {
+		return nil
+	}
+
+	return b.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":             message.Chat.ID,
+		"text":                reply,
+		"reply_to_message_id": message.MessageID,
+	}, nil)
+}
+
+// Answer returns the reply to a command, the commands use the same data as the REST handlers.
+// The sightings are the live ones for the zero time, like /recent without 'at'.
+func (b *TelegramBot) Answer(ctx context.Context, text string, at time.Time) string {
+	command, args, _ := strings.Cut(text, " ")
+	// In groups commands can be addressed to a bot, e.g. /recent@FreiFahrenBot
+	command, _, _ = strings.Cut(command, "@")
+	args = strings.TrimSpace(args)
+
+	switch command {
+	case "/recent":
+		return b.answerRecent(ctx, strings.ToUpper(args), at)
+	case "/station":
+		return b.answerStation(ctx, args, at)
+	case "/risk":
+		return b.answerRisk(ctx, args, at)
+	case "/start", "/help":
+		return telegramHelp
+	default:
+		return "Unknown command.\n\n" + telegramHelp
+	}
+}
+
+// ResolveReport returns the station, line and direction a report was resolved to, like for the import.
+// Messages without a station are not answered.
+func (b *TelegramBot) ResolveReport(text string) string {
+	record := b.importer.matchMessage(text)
+	if record.StationID == nil {
+		return ""
+	}
+
+	reply := "Resolved to " + *record.StationName
+	if record.Line != nil {
+		reply += ", " + *record.Line
+	}
+	if record.DirectionName != nil {
+		reply += " towards " + *record.DirectionName
+	}
+	return reply
+}
+
+func (b *TelegramBot) answerRecent(ctx context.Context, line string, at time.Time) string {
+	if _, ok := b.lines[line]; line != "" && !ok {
+		return "Unknown line " + line
+	}
+
+	sightings, err := b.reportedSightings(ctx, at)
+	if err != nil {
+		return "The sightings are not available right now, please try again later."
+	}
+
+	lines := []string{}
+	for _, sighting := range sightings {
+		if line == "" || sighting.Line == line {
+			lines = append(lines, "• "+formatSighting(sighting))
+		}
+	}
+
+	scope := ""
+	if line != "" {
+		scope = " on " + line
+	}
+	if len(lines) == 0 {
+		return "No inspectors reported" + scope + " in the last 15 minutes."
+	}
+	return "Inspectors reported" + scope + " in the last 15 minutes:\n" + strings.Join(lines, "\n")
+}
+
+func (b *TelegramBot) answerStation(ctx context.Context, name string, at time.Time) string {
+	if name == "" {
+		return "Usage: /station <name>, e.g. /station Hermannplatz"
+	}
+	id, ok := FindStationId(name, b.stations)
+	if !ok {
+		return "No station found with the name " + name
+	}
+
+	reply := b.stations[id].Name + "\nLines: " + strings.Join(b.stationLines(id), ", ")
+
+	sightings, err := b.reportedSightings(ctx, at)
+	if err != nil {
+		return reply
+	}
+	for _, sighting := range sightings {
+		if sighting.Station.ID == id {
+			return reply + "\nInspectors reported: " + formatSighting(sighting)
+		}
+	}
+	return reply + "\nNo inspectors reported in the last 15 minutes."
+}
+
+func (b *TelegramBot) answerRisk(ctx context.Context, args string, at time.Time) string {
+	from, to, ok := b.splitStations(args)
+	if !ok {
+		return "Usage: /risk <from> <to>, e.g. /risk Alexanderplatz Kottbusser Tor"
+	}
+
+	sightings, err := b.config.Sightings(ctx, at)
+	if err != nil {
+		return "The sightings are not available right now, please try again later."
+	}
+
+	routes := RouteRisks(from, to, b.lines, sightings)
+	if len(routes) == 0 {
+		return "There is no direct line between " + b.stations[from].Name + " and " + b.stations[to].Name + "."
+	}
+
+	lines := []string{b.stations[from].Name + " → " + b.stations[to].Name}
+	for _, route := range routes {
+		line := route.Line + ": " + route.Risk + " risk"
+		if route.Sighting != nil {
+			if route.Sighting.IsHistoric {
+				line += ", inspectors are often at " + route.Sighting.Station.Name + " at this time"
+			} else {
+				line += ", inspectors reported at " + formatSighting(*route.Sighting)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitStations finds the two stations in e.g. "Alexanderplatz Kottbusser Tor", trying every split of the words
+func (b *TelegramBot) splitStations(args string) (string, string, bool) {
+	words := strings.Fields(strings.NewReplacer("->", " ", "→", " ", ",", " ").Replace(args))
+	for i := 1; i < len(words); i++ {
+		from, fromOK := FindStationId(strings.Join(words[:i], " "), b.stations)
+		to, toOK := FindStationId(strings.Join(words[i:], " "), b.stations)
+		if fromOK && toOK {
+			return from, to, true
+		}
+	}
+	return "", "", false
+}
+
+func (b *TelegramBot) stationLines(id string) []string {
+	lines := []string{}
+	for line, stations := range b.lines {
+		if slices.Contains(stations, id) {
+			lines = append(lines, line)
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// reportedSightings leaves out the historic sightings /recent is filled up with
+func (b *TelegramBot) reportedSightings(ctx context.Context, at time.Time) ([]structs.TicketInspector, error) {
+	sightings, err := b.config.Sightings(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(sightings, func(sighting structs.TicketInspector) bool { return sighting.IsHistoric }), nil
+}
+
+// RouteRisk is the risk of meeting inspectors between two stations on a line.
+// It is high if inspectors were reported on the way and medium if they are often there at this time.
+type RouteRisk struct {
+	Line     string
+	Risk     string
+	Sighting *structs.TicketInspector
+}
+
+// RouteRisks returns the risk for every line connecting the two stations, sorted by line
+func RouteRisks(from, to string, lines map[string][]string, sightings []structs.TicketInspector) []RouteRisk {
+	risks := []RouteRisk{}
+	for line, stations := range lines {
+		start, end := slices.Index(stations, from), slices.Index(stations, to)
+		if start < 0 || end < 0 {
+			continue
+		}
+		onTheWay := stations[min(start, end) : max(start, end)+1]
+
+		risk := RouteRisk{Line: line, Risk: "low"}
+		for _, sighting := range sightings {
+			if !slices.Contains(onTheWay, sighting.Station.ID) || (sighting.Line != "" && sighting.Line != line) {
+				continue
+			}
+			if !sighting.IsHistoric {
+				risk.Risk, risk.Sighting = "high", &sighting
+				break
+			}
+			if risk.Sighting == nil {
+				risk.Risk, risk.Sighting = "medium", &sighting
+			}
+		}
+		risks = append(risks, risk)
+	}
+
+	slices.SortFunc(risks, func(a, b RouteRisk) int { return strings.Compare(a.Line, b.Line) })
+	return risks
+}
+
+func formatSighting(sighting structs.TicketInspector) string {
+	text := sighting.Timestamp.Local().Format(windowTimeFormat) + " " + sighting.Station.Name
+	if sighting.Line != "" {
+		text += ", " + sighting.Line
+	}
+	if sighting.Direction.Name != "" {
+		text += " towards " + sighting.Direction.Name
+	}
+	return text
+}
+
+// call sends a Bot API request and decodes its result
+func (b *TelegramBot) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(b.config.APIURL, "/") + "/bot" + url.PathEscape(b.config.Token) + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	response, err := b.config.Client.Do(req)
+	if err != nil {
+		// The token is part of the url, so it must not end up in the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s failed: %w", method, urlErr.Err)
+		}
+		return err
+	}
+	defer response.Body.Close()
+
+	var decoded telegramResponse
+	if err := json.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("%s returned %d: %w", method, response.StatusCode, err)
+	}
+	if !decoded.OK {
+		return errors.New(method + " failed: " + decoded.Description + " (" + strconv.Itoa(response.StatusCode) + ")")
+	}
+	if result != nil {
+		return json.Unmarshal(decoded.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+const MIMEVectorTile = "application/vnd.mapbox-vector-tile"
+
+const (
+	maxTileZoom = 22
+	// The cache is cleared once it is full, the tiles of the visible area are quickly rebuilt
+	maxCachedTiles = 4096
+)
+
+var staticTiles = &staticTileCache{tiles: make(map[maptile.Tile]mvt.Layers)}
+
+// staticTileCache keeps the station and line layers, which only change with the data files
+type staticTileCache struct {
+	mu       sync.Mutex
+	stations []structs.Feature
+	lines    []structs.Feature
+	tiles    map[maptile.Tile]mvt.Layers
+}
+
+// GetTile returns a Mapbox Vector Tile with the layers stations, lines and sightings
+func GetTile(c echo.Context) error {
+	tile, err := parseTile(c.Param("z"), c.Param("x"), c.Param("y"))
+	if err != nil {
+		return err
+	}
+
+	static, err := staticTiles.layers(tile)
+	if err != nil {
+		return Unavailable("Failed to read the stations and lines", err)
+	}
+
+	ticketInspectors, err := RecentTicketInspectors(c.Request().Context(), time.Time{})
+	if err != nil {
+		return err
+	}
+	sightings := tileLayer("sightings", SightingFeatures(ticketInspectors), tile)
+
+	data, err := mvt.Marshal(append(mvt.Layers{sightings}, static...))
+	if err != nil {
+		return Internal(err)
+	}
+
+	return c.Blob(http.StatusOK, MIMEVectorTile, data)
+}
+
+// parseTile validates the tile coordinates, the y coordinate carries the .mvt extension
+func parseTile(z, x, y string) (maptile.Tile, error) {
+	y, ok := strings.CutSuffix(y, ".mvt")
+	if !ok {
+		return maptile.Tile{}, NotFound("Tiles are only available as .mvt")
+	}
+
+	zoom, err := strconv.ParseUint(z, 10, 32)
+	if err != nil || zoom > maxTileZoom {
+		return maptile.Tile{}, ValidationFailed("The zoom has to be between 0 and " + strconv.Itoa(maxTileZoom)).WithDetails(map[string]string{"field": "z", "value": z})
+	}
+
+	column, errX := strconv.ParseUint(x, 10, 32)
+	row, errY := strconv.ParseUint(y, 10, 32)
+	tile := maptile.New(uint32(column), uint32(row), maptile.Zoom(zoom))
+	if errX != nil || errY != nil || !tile.Valid() {
+		return maptile.Tile{}, ValidationFailed("The tile is outside of the map at zoom " + z).WithDetails(map[string]string{"field": "x/y", "value": x + "/" + y})
+	}
+
+	return tile, nil
+}
+
+func (cache *staticTileCache) layers(tile maptile.Tile) (mvt.Layers, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if layers, ok := cache.tiles[tile]; ok {
+		return layers, nil
+	}
+
+	if cache.stations == nil {
+		stationsList, err := ReadStationsList("data/StationsList.json")
+		if err != nil {
+			return nil, err
+		}
+		linesList, err := ReadLinesList("data/LinesList.json")
+		if err != nil {
+			return nil, err
+		}
+		cache.stations = StationFeatures(stationsList)
+		cache.lines = LineFeatures(linesList, stationsList)
+	}
+
+	layers := mvt.Layers{
+		tileLayer("lines", cache.lines, tile),
+		tileLayer("stations", cache.stations, tile),
+	}
+
+	if len(cache.tiles) >= maxCachedTiles {
+		clear(cache.tiles)
+	}
+	cache.tiles[tile] = layers
+
+	return layers, nil
+}
+
+// tileLayer projects the features to the tile and drops the ones outside of it
+func tileLayer(name string, features []structs.Feature, tile maptile.Tile) *mvt.Layer {
+	collection := geojson.NewFeatureCollection()
+	for _, feature := range features {
+		geometry := tileGeometry(feature.Geometry)
+		if geometry == nil {
+			continue
+		}
+
+		tileFeature := geojson.NewFeature(geometry)
+		tileFeature.Properties = tileProperties(feature)
+		collection.Append(tileFeature)
+	}
+
+	layer := mvt.NewLayer(name, collection)
+	layer.ProjectToTile(tile)
+	layer.Clip(mvt.MapboxGLDefaultExtentBound)
+	return layer
+}
+
+func tileGeometry(geometry structs.Geometry) orb.Geometry {
+	switch coordinates := geometry.Coordinates.(type) {
+	case []float64:
+		return orb.Point{coordinates[0], coordinates[1]}
+	case [][]float64:
+		line := make(orb.LineString, 0, len(coordinates))
+		for _, point := range coordinates {
+			line = append(line, orb.Point{point[0], point[1]})
+		}
+		return line
+	}
+	return nil
+}
+
+// tileProperties flattens the GeoJSON properties, as vector tiles only support plain values
+func tileProperties(feature structs.Feature) geojson.Properties {
+	properties := geojson.Properties{"id": feature.ID}
+	for key, value := range feature.Properties {
+		switch value := value.(type) {
+		case nil:
+		case time.Time:
+			properties[key] = value.Format(time.RFC3339)
+		case []string:
+			properties[key] = strings.Join(value, ",")
+		case map[string]string:
+			// e.g. station: {id, name} becomes stationId and stationName
+			for field, fieldValue := range value {
+				properties[key+strings.ToUpper(field[:1])+field[1:]] = fieldValue
+			}
+		default:
+			properties[key] = value
+		}
+	}
+	return properties
+}
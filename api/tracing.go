@@ -0,0 +1,81 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/FreiFahren/backend/telemetry"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace starts a span for every request and puts the request id into the context of the request,
+// so the logs and spans of the database calls belong to the request.
+// It has to run after the RequestID middleware, a traceparent header of the client is continued.
+func Trace(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx = telemetry.WithRequestID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := telemetry.Tracer().Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+				attribute.String("request_id", telemetry.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			status = errorStatus(err)
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// LogRequests writes a structured log line for every request, with the request id and trace of its context.
+// It has to run after Trace.
+func LogRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			status = errorStatus(err)
+		}
+
+		// Errors are logged with their cause by HTTPErrorHandler
+		slog.InfoContext(c.Request().Context(), "Request",
+			"method", c.Request().Method,
+			"path", c.Request().URL.Path,
+			"route", c.Path(),
+			"status", status,
+			"duration", time.Since(start),
+			"remote_ip", c.RealIP(),
+		)
+		return err
+	}
+}
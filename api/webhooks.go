@@ -0,0 +1,348 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+// Headers of the webhook requests, the signature is t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">
+const (
+	WebhookEventHeader     = "X-FreiFahren-Event"
+	WebhookDeliveryHeader  = "X-FreiFahren-Delivery"
+	WebhookSignatureHeader = "X-FreiFahren-Signature"
+)
+
+const (
+	defaultWebhookMaxAttempts    = 6
+	defaultWebhookBackoffSeconds = 2
+	maxWebhookBackoff            = 10 * time.Minute
+	webhookTimeout               = 10 * time.Second
+	// Receivers should reject signatures older than this, so captured requests can't be replayed
+	WebhookSignatureTolerance = 5 * time.Minute
+)
+
+// All sightings are in Berlin for now, the filter lets partners prepare for more cities
+var webhookCities = []string{"berlin"}
+
+// Webhooks delivers the new sightings to the webhooks of the partners
+var Webhooks = NewWebhookDispatcher(NewPublicClient(webhookTimeout), defaultWebhookMaxAttempts, defaultWebhookBackoffSeconds*time.Second)
+
+type WebhookDispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	// Wait before the second attempt, doubled for every further attempt
+	backoff time.Duration
+}
+
+func NewWebhookDispatcher(client *http.Client, maxAttempts int, backoff time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{client: client, maxAttempts: max(maxAttempts, 1), backoff: backoff}
+}
+
+// InitWebhooks reads the retry settings from the environment.
+// It has to be called after the .env file has been loaded.
+func InitWebhooks() {
+	Webhooks = NewWebhookDispatcher(
+		NewPublicClient(webhookTimeout),
+		envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts),
+		time.Duration(envInt("WEBHOOK_BACKOFF_SECONDS", defaultWebhookBackoffSeconds))*time.Second,
+	)
+}
+
+// Dispatch sends the sighting to the matching webhooks in the background.
+// Every attempt is written to the delivery log, events that failed all attempts to the dead letters.
+func (d *WebhookDispatcher) Dispatch(sighting structs.TicketInspector) {
+	go func() {
+		webhooks, err := database.ListWebhooksFor(context.Background(), sighting.Station.ID, sighting.Line)
+		if err != nil {
+			slog.Error("Failed to get the webhooks", "error", err)
+			return
+		}
+
+		body, err := json.Marshal(sighting)
+		if err != nil {
+			slog.Error("Failed to encode the sighting for the webhooks", "error", err)
+			return
+		}
+
+		for _, webhook := range webhooks {
+			go d.deliver(webhook, body)
+		}
+	}()
+}
+
+func (d *WebhookDispatcher) deliver(webhook structs.Webhook, body []byte) {
+	deliveryID, err := newUUID()
+	if err != nil {
+		slog.Error("Failed to create a delivery id", "error", err)
+		return
+	}
+
+	attempts, err := d.Send(webhook, deliveryID, body, func(delivery structs.WebhookDelivery) {
+		if err := database.InsertWebhookDelivery(context.Background(), delivery); err != nil {
+			slog.Error("Failed to log webhook delivery", "delivery", deliveryID, "error", err)
+		}
+	})
+	if err == nil {
+		return
+	}
+
+	if err := database.InsertWebhookDeadLetter(context.Background(), webhook.ID, deliveryID, structs.WebhookEventSighting, body, attempts, err.Error()); err != nil {
+		slog.Error("Failed to store dead letter of webhook delivery", "delivery", deliveryID, "error", err)
+	}
+}
+
+// Send posts the body to the webhook until it succeeds, retrying network errors, timeouts, 429 and 5xx with exponential backoff.
+// It returns the number of attempts and the error of the last one, record is called after every attempt.
+func (d *WebhookDispatcher) Send(webhook structs.Webhook, deliveryID string, body []byte, record func(structs.WebhookDelivery)) (int, error) {
+	var err error
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.backoffBefore(attempt))
+		}
+
+		start := time.Now()
+		var statusCode int
+		statusCode, err = d.post(webhook, deliveryID, body, start)
+
+		delivery := structs.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			DeliveryID: deliveryID,
+			Attempt:    attempt,
+			DurationMs: time.Since(start).Milliseconds(),
+			Timestamp:  start,
+		}
+		if statusCode != 0 {
+			delivery.StatusCode = &statusCode
+		}
+		if err != nil {
+			message := err.Error()
+			delivery.Error = &message
+		}
+		record(delivery)
+
+		if err == nil {
+			return attempt, nil
+		}
+		if !isRetryableStatus(statusCode) {
+			return attempt, err
+		}
+	}
+	return d.maxAttempts, err
+}
+
+func (d *WebhookDispatcher) backoffBefore(attempt int) time.Duration {
+	backoff := d.backoff
+	for i := 2; i < attempt && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxWebhookBackoff)
+}
+
+func (d *WebhookDispatcher) post(webhook structs.Webhook, deliveryID string, body []byte, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(WebhookEventHeader, structs.WebhookEventSighting)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, now, body))
+
+	response, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("responded with %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// isRetryableStatus is true for network errors (0) and responses that may succeed later
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// SignWebhook returns the signature header for the body, the timestamp is signed as well to prevent replays
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + webhookHMAC(secret, unix, body)
+}
+
+// VerifyWebhookSignature checks a signature header like receivers of the webhooks should
+func VerifyWebhookSignature(secret, signature string, body []byte, now time.Time) error {
+	var unix, mac string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			mac = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || mac == "" {
+		return errors.New("malformed signature")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > WebhookSignatureTolerance || age < -WebhookSignatureTolerance {
+		return errors.New("signature timestamp outside of the tolerance")
+	}
+	if !hmac.Equal([]byte(mac), []byte(webhookHMAC(secret, unix, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func webhookHMAC(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateWebhook registers a webhook for the api key, the response contains the secret for verifying the signatures
+func CreateWebhook(c echo.Context) error {
+	var webhook structs.Webhook
+	if err := c.Bind(&webhook); err != nil {
+		return InvalidRequest("Invalid request body").WithInternal(err)
+	}
+
+	if err := validateWebhook(c.Request().Context(), webhook); err != nil {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Internal(err)
+	}
+	webhook.Secret = "whsec_" + hex.EncodeToString(secret)
+
+	created, err := database.InsertWebhook(c.Request().Context(), apiKeyOf(c).ID, webhook)
+	if err != nil {
+		return Unavailable("Failed to save the webhook", err)
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// ListWebhooks returns the webhooks of the api key without their secrets
+func ListWebhooks(c echo.Context) error {
+	webhooks, err := database.ListWebhooks(c.Request().Context(), apiKeyOf(c).ID)
+	if err != nil {
+		return Unavailable("Failed to access the database", err)
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+func DeleteWebhook(c echo.Context) error {
+	err := database.DeleteWebhook(c.Request().Context(), apiKeyOf(c).ID, c.Param("id"))
+	if err != nil {
+		return webhookError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first
+func GetWebhookDeliveries(c echo.Context) error {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return ValidationFailed(err.Error())
+	}
+
+	deliveries, err := database.ListWebhookDeliveries(c.Request().Context(), apiKeyOf(c).ID, c.Param("id"), limit, offset)
+	if err != nil {
+		return webhookError(err)
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+func webhookError(err error) error {
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		return NotFound(err.Error())
+	}
+	return Unavailable("Failed to access the database", err)
+}
+
+func validateWebhook(ctx context.Context, webhook structs.Webhook) error {
+	field := func(name, value, message string) error {
+		return ValidationFailed(message).WithDetails(map[string]string{"field": name, "value": value})
+	}
+
+	endpoint, err := url.Parse(webhook.URL)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return field("url", webhook.URL, "'url' must be an https url")
+	}
+
+	if webhook.City != "" && !slices.Contains(webhookCities, webhook.City) {
+		return field("city", webhook.City, "'city' must be one of "+strings.Join(webhookCities, ", "))
+	}
+
+	stations, err := ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return Unavailable("Failed to read the stations", err)
+	}
+	for _, id := range webhook.Stations {
+		if _, ok := stations[id]; !ok {
+			return field("stations", id, "Unknown station id "+id)
+		}
+	}
+
+	lines, err := ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return Unavailable("Failed to read the lines", err)
+	}
+	for _, line := range webhook.Lines {
+		if _, ok := lines[line]; !ok {
+			return field("lines", line, "Unknown line "+line)
+		}
+	}
+
+	// The server must not be used to reach the internal network, the client checks the address again when connecting
+	if err := checkPublicHost(ctx, endpoint.Hostname()); err != nil {
+		return field("url", webhook.URL, "'url' must be a public address")
+	}
+
+	return nil
+}
+
+func apiKeyOf(c echo.Context) structs.ApiKey {
+	apiKey, _ := c.Get("apiKey").(structs.ApiKey)
+	return apiKey
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
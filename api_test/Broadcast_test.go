@@ -0,0 +1,281 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+type recordingBroadcaster struct {
+	mu      sync.Mutex
+	batches []structs.BroadcastBatch
+}
+
+func (r *recordingBroadcaster) Name() string { return "recording" }
+
+func (r *recordingBroadcaster) Broadcast(ctx context.Context, batch structs.BroadcastBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, batch)
+	return nil
+}
+
+func (r *recordingBroadcaster) Batches() []structs.BroadcastBatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]structs.BroadcastBatch{}, r.batches...)
+}
+
+func testSighting(station, line, direction string) structs.TicketInspector {
+	return structs.TicketInspector{
+		Timestamp: time.Date(2024, 5, 3, 14, 5, 0, 0, time.Local),
+		Station:   structs.Station{ID: "SU-" + station, Name: station},
+		Direction: structs.Station{Name: direction},
+		Line:      line,
+	}
+}
+
+func TestBroadcastHubBatches(t *testing.T) {
+	hub := api.NewBroadcastHub()
+	batched := &recordingBroadcaster{}
+	hub.Register(batched, time.Hour)
+
+	hub.Publish(testSighting("Alexanderplatz", "U8", "Wittenau"))
+	hub.Publish(testSighting("Hermannplatz", "U7", ""))
+	if len(batched.Batches()) != 0 {
+		t.Fatal("Sightings were broadcast before the end of the batch window")
+	}
+
+	hub.Flush()
+	batches := batched.Batches()
+	if len(batches) != 1 || len(batches[0].Sightings) != 2 {
+		t.Fatalf("Expected one batch with both sightings, got %+v", batches)
+	}
+
+	// Nothing is sent for an empty batch
+	hub.Flush()
+	if len(batched.Batches()) != 1 {
+		t.Error("An empty batch was broadcast")
+	}
+}
+
+func TestBroadcastHubWindow(t *testing.T) {
+	hub := api.NewBroadcastHub()
+	batched := &recordingBroadcaster{}
+	hub.Register(batched, 20*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(testSighting("Alexanderplatz", "U8", ""))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(batched.Batches()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	batches := batched.Batches()
+	if len(batches) != 1 || len(batches[0].Sightings) != 3 {
+		t.Fatalf("Expected the window to send one batch of 3 sightings, got %+v", batches)
+	}
+}
+
+func TestBroadcastTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		sightings []structs.TicketInspector
+		expected  string
+	}{
+		{"Matrix", api.DefaultMatrixTemplate, []structs.TicketInspector{testSighting("Alexanderplatz", "U8", "Wittenau")}, "Ticket inspectors at Alexanderplatz, U8 towards Wittenau (14:05)"},
+		{"Mastodon single", api.DefaultMastodonTemplate, []structs.TicketInspector{testSighting("Hermannplatz", "", "")}, "Ticket inspectors at Hermannplatz (14:05)\n#FreiFahren #Berlin"},
+		{"Mastodon batch", api.DefaultMastodonTemplate, []structs.TicketInspector{testSighting("Alexanderplatz", "U8", ""), testSighting("Hermannplatz", "U7", "")}, "2 new sightings:\n- Alexanderplatz U8 (14:05)\n- Hermannplatz U7 (14:05)\n\n#FreiFahren #Berlin"},
+		{"Custom", "{{range .Sightings}}{{.Line}}@{{.Station.ID}} {{end}}", []structs.TicketInspector{testSighting("Alexanderplatz", "U8", "")}, "U8@SU-Alexanderplatz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := api.ParseBroadcastTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParseBroadcastTemplate failed: %v", err)
+			}
+
+			var posted string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				posted = r.PostForm.Get("status")
+			}))
+			defer server.Close()
+
+			broadcaster := api.NewMastodonBroadcaster(server.URL, "token", tmpl, server.Client())
+			if err := broadcaster.Broadcast(context.Background(), structs.BroadcastBatch{Sightings: tt.sightings}); err != nil {
+				t.Fatalf("Broadcast failed: %v", err)
+			}
+			if posted != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, posted)
+			}
+		})
+	}
+
+	if _, err := api.ParseBroadcastTemplate("{{range .Sightings}"); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
+
+func TestMatrixBroadcaster(t *testing.T) {
+	var request *http.Request
+	var message map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		json.NewDecoder(r.Body).Decode(&message)
+		w.Write([]byte(`{"event_id":"$1"}`))
+	}))
+	defer server.Close()
+
+	tmpl, _ := api.ParseBroadcastTemplate(api.DefaultMatrixTemplate)
+	broadcaster := api.NewMatrixBroadcaster(server.URL+"/", "!room:example.org", "secret", tmpl, server.Client())
+	batch := structs.BroadcastBatch{Sightings: []structs.TicketInspector{testSighting("Alexanderplatz", "U8", ""), testSighting("Hermannplatz", "U7", "")}}
+	if err := broadcaster.Broadcast(context.Background(), batch); err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+
+	if request.Method != http.MethodPut || !strings.HasPrefix(request.URL.EscapedPath(), "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/") {
+		t.Errorf("Unexpected request %s %s", request.Method, request.URL.EscapedPath())
+	}
+	if request.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("The access token was not sent")
+	}
+	expected := "Ticket inspectors at Alexanderplatz, U8 (14:05)\nTicket inspectors at Hermannplatz, U7 (14:05)"
+	if message["msgtype"] != "m.text" || message["body"] != expected {
+		t.Errorf("Unexpected message %+v", message)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	if err := broadcaster.Broadcast(context.Background(), batch); err == nil {
+		t.Error("Expected an error when the homeserver rejects the message")
+	}
+}
+
+func TestMastodonStatusLength(t *testing.T) {
+	var status string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		status = r.PostForm.Get("status")
+	}))
+	defer server.Close()
+
+	tmpl := template.Must(api.ParseBroadcastTemplate(strings.Repeat("ü", 600)))
+	broadcaster := api.NewMastodonBroadcaster(server.URL, "token", tmpl, server.Client())
+	if err := broadcaster.Broadcast(context.Background(), structs.BroadcastBatch{Sightings: []structs.TicketInspector{testSighting("Alexanderplatz", "", "")}}); err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	if length := len([]rune(status)); length != 500 {
+		t.Errorf("Expected the status to be shortened to 500 characters, got %d", length)
+	}
+}
+
+func TestGetFeed(t *testing.T) {
+	chdirToRepoRoot(t)
+	store := useMemoryStore(t)
+
+	tmpl, _ := api.ParseBroadcastTemplate(api.DefaultFeedTemplate)
+	previous := api.Feed
+	api.Feed = api.NewSightingFeed(tmpl, "https://api.example.org/")
+	defer func() { api.Feed = previous }()
+
+	at := time.Date(2024, 5, 3, 14, 5, 0, 0, time.Local)
+	insertReport(t, store, at, "U8", "SU-A", false)
+	insertReport(t, store, at.Add(time.Minute), "U8", "U-Hpu", false)
+	// Quarantined reports are left out like hidden ones
+	insertReport(t, store, at.Add(2*time.Minute), "U8", "SU-WIU", true)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/v1/feed.xml", nil)
+	// The host of the request isn't used for the links
+	req.Host = "attacker.example.com"
+	rec := httptest.NewRecorder()
+	if err := api.GetFeed(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("GetFeed failed: %v", err)
+	}
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), api.MIMEAtom) {
+		t.Errorf("Unexpected content type %s", rec.Header().Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(rec.Body)
+	var atom structs.AtomFeed
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		t.Fatalf("Invalid feed: %v\n%s", err, body)
+	}
+
+	if atom.ID != "https://api.example.org/v1/feed.xml" || len(atom.Links) != 1 || atom.Links[0].Href != atom.ID || len(atom.Entries) != 2 {
+		t.Fatalf("Unexpected feed %+v", atom)
+	}
+	newest := atom.Entries[0]
+	if newest.Title != "Ticket inspectors at Hermannplatz" || newest.Content.Text != "Ticket inspectors at Hermannplatz, U8 at 14:06." {
+		t.Errorf("The newest sighting should be first, got %+v", newest)
+	}
+	if !strings.HasPrefix(newest.ID, "tag:api.example.org,2024-05-03:sighting/U-Hpu/") {
+		t.Errorf("Unexpected id %s", newest.ID)
+	}
+	if atom.Updated != newest.Updated || newest.Updated != at.Add(time.Minute).Format(time.RFC3339) {
+		t.Errorf("The feed should be updated with its newest entry, got %s", atom.Updated)
+	}
+}
+
+func TestBroadcastRetract(t *testing.T) {
+	var posted int
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, r.URL.Path)
+			return
+		}
+		posted++
+		fmt.Fprintf(w, `{"id":"%d"}`, posted)
+	}))
+	defer server.Close()
+
+	tmpl, _ := api.ParseBroadcastTemplate(api.DefaultMastodonTemplate)
+	mastodon := api.NewMastodonBroadcaster(server.URL, "token", tmpl, server.Client())
+	batched := &recordingBroadcaster{}
+	hub := api.NewBroadcastHub()
+	hub.Register(mastodon, time.Hour)
+	hub.Register(batched, time.Hour)
+
+	hidden := testSighting("Alexanderplatz", "U8", "")
+	other := testSighting("Hermannplatz", "U7", "")
+	for _, sighting := range []structs.TicketInspector{hidden, other} {
+		if err := mastodon.Broadcast(context.Background(), structs.BroadcastBatch{Sightings: []structs.TicketInspector{sighting}}); err != nil {
+			t.Fatalf("Broadcast failed: %v", err)
+		}
+		hub.Publish(sighting)
+	}
+
+	// The report was stored in local time without a zone and is read back in UTC
+	wallClock := time.Date(2024, 5, 3, 14, 5, 0, 0, time.UTC)
+	stationID := hidden.Station.ID
+	hub.Retract(structs.Report{ID: "6c1f3b2e-7a0d-4e53-9a55-3b8d0f3c2a11", Timestamp: wallClock, StationID: &stationID})
+
+	if len(deleted) != 1 || deleted[0] != "/api/v1/statuses/1" {
+		t.Errorf("Expected only the status of the hidden report to be deleted, got %v", deleted)
+	}
+
+	hub.Flush()
+	batches := batched.Batches()
+	if len(batches) != 1 || len(batches[0].Sightings) != 1 || batches[0].Sightings[0].Station.Name != "Hermannplatz" {
+		t.Errorf("Expected the hidden report to be dropped from the pending batch, got %+v", batches)
+	}
+}
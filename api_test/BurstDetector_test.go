@@ -0,0 +1,39 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+)
+
+func TestBurstDetector(t *testing.T) {
+	start := time.Date(2024, 3, 19, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		source   string
+		station  string
+		offset   time.Duration
+		expected bool
+	}{
+		{"First station", "ip:1", "U-Ado", 0, false},
+		{"Same station again", "ip:1", "U-Ado", time.Minute, false},
+		{"Second station", "ip:1", "S-Ad", 2 * time.Minute, false},
+		{"Third station", "ip:1", "S-Ah", 3 * time.Minute, false},
+		{"Fourth station within window", "ip:1", "S-Blf", 4 * time.Minute, true},
+		{"Other source is not affected", "ip:2", "S-Blf", 4 * time.Minute, false},
+		{"Old reports expire", "ip:1", "U-Kt", 20 * time.Minute, false},
+	}
+
+	detector := api.NewBurstDetector(10*time.Minute, 3)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isBurst := detector.Record(tt.source, tt.station, start.Add(tt.offset))
+			if isBurst != tt.expected {
+				t.Errorf("Record(%s, %s) = %t; expected %t", tt.source, tt.station, isBurst, tt.expected)
+			}
+		})
+	}
+}
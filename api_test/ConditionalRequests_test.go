@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseHTTPDate(t *testing.T) {
+	expected := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"Sun, 06 Nov 1994 08:49:37 GMT", true},
+		{"Sunday, 06-Nov-94 08:49:37 GMT", true},
+		{"Sun Nov  6 08:49:37 1994", true},
+		{"1994-11-06T09:49:37+01:00", true},
+		{"06.11.1994 08:49", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		parsed, ok := api.ParseHTTPDate(tt.value)
+		if ok != tt.valid || (ok && !parsed.Equal(expected)) {
+			t.Errorf("ParseHTTPDate(%q) = %v, %v; expected valid=%v", tt.value, parsed, ok, tt.valid)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2024, 5, 3, 14, 5, 30, 500_000_000, time.UTC)
+	etag := `"abc"`
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		expected        bool
+	}{
+		{"No conditions", "", "", false},
+		{"Same second", "", "Fri, 03 May 2024 14:05:30 GMT", true},
+		{"Later", "", "Fri, 03 May 2024 15:00:00 GMT", true},
+		{"Earlier", "", "Fri, 03 May 2024 14:05:29 GMT", false},
+		{"RFC3339", "", "2024-05-03T16:05:30+02:00", true},
+		{"Invalid date is ignored", "", "yesterday", false},
+		{"Matching ETag", `"xyz", "abc"`, "", true},
+		{"Weak comparison", `W/"abc"`, "", true},
+		{"Any ETag", "*", "", true},
+		{"Other ETag", `"xyz"`, "", false},
+		{"If-None-Match wins over If-Modified-Since", `"xyz"`, "Fri, 03 May 2024 15:00:00 GMT", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/recent", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+
+			if result := api.NotModified(req, etag, lastModified); result != tt.expected {
+				t.Errorf("NotModified() = %v; expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/recent", nil)
+	req.Header.Set("If-Modified-Since", "Fri, 03 May 2024 15:00:00 GMT")
+	if api.NotModified(req, etag, time.Time{}) {
+		t.Error("A response without Last-Modified can't be unmodified since a date")
+	}
+}
+
+func TestResponseCacheConditionalRequests(t *testing.T) {
+	lastModified := time.Date(2024, 5, 3, 14, 5, 30, 0, time.UTC)
+	calls := 0
+	e := newCachedEcho(api.NewResponseCache(time.Minute), func(c echo.Context) error {
+		calls++
+		// The cache has to get the full response to store it
+		if c.Request().Header.Get("If-Modified-Since") != "" || c.Request().Header.Get("If-None-Match") != "" {
+			t.Error("The conditional headers were passed to the handler")
+		}
+		c.Response().Header().Set(echo.HeaderLastModified, lastModified.Format(http.TimeFormat))
+		return c.JSON(http.StatusOK, []string{"SU-A"})
+	})
+
+	first := cachedRequest(e, "/recent", map[string]string{"If-Modified-Since": "Fri, 03 May 2024 15:00:00 GMT"})
+	if first.Code != http.StatusNotModified || first.Header().Get("Last-Modified") != "Fri, 03 May 2024 14:05:30 GMT" {
+		t.Errorf("Expected 304 with Last-Modified, got %d %q", first.Code, first.Header().Get("Last-Modified"))
+	}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"Modified", map[string]string{"If-Modified-Since": "Fri, 03 May 2024 14:00:00 GMT"}, http.StatusOK},
+		{"Not modified", map[string]string{"If-Modified-Since": "Fri, 03 May 2024 14:05:30 GMT"}, http.StatusNotModified},
+		{"Invalid date", map[string]string{"If-Modified-Since": "not a date"}, http.StatusOK},
+		{"ETag changed", map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": "Fri, 03 May 2024 15:00:00 GMT"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := cachedRequest(e, "/recent", tt.headers)
+		if rec.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, rec.Code)
+		}
+		if rec.Header().Get("Last-Modified") == "" || rec.Header().Get("ETag") == "" {
+			t.Errorf("%s: missing validators", tt.name)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, it ran %d times", calls)
+	}
+}
+
+func TestRecentModifiedByExpiredSightings(t *testing.T) {
+	chdirToRepoRoot(t)
+	store := useMemoryStore(t)
+	api.RecentResponses.Invalidate()
+	t.Cleanup(api.RecentResponses.Invalidate)
+
+	now := time.Now()
+	insertReport(t, store, now.Add(-20*time.Minute), "U8", "SU-A", false)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/recent", api.GetRecentTicketInspectorInfo)
+
+	tests := []struct {
+		name            string
+		ifModifiedSince time.Time
+		expected        int
+	}{
+		// The sighting left the map 5 minutes ago
+		{"Seen before the sighting expired", now.Add(-19 * time.Minute), http.StatusOK},
+		{"Seen after the sighting expired", now.Add(time.Minute), http.StatusNotModified},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/recent", nil)
+		req.Header.Set("If-Modified-Since", tt.ifModifiedSince.UTC().Format(http.TimeFormat))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, rec.Code)
+		}
+	}
+}
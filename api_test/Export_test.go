@@ -0,0 +1,129 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		path           string
+		expectedStatus int
+	}{
+		{"Unknown format", structs.RolePartner, "/export?format=xlsx", http.StatusUnprocessableEntity},
+		{"Invalid start", structs.RolePartner, "/export?from=2024-05-01", http.StatusUnprocessableEntity},
+		{"Invalid anonymized", structs.RolePartner, "/export?anonymized=maybe", http.StatusUnprocessableEntity},
+		{"Partner can't export messages", structs.RolePartner, "/export?anonymized=false", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = api.HTTPErrorHandler
+			setRole := func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("role", tt.role)
+					return next(c)
+				}
+			}
+			e.GET("/export", api.Export, setRole)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("GET %s returned %d; expected %d: %s", tt.path, rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportWriters(t *testing.T) {
+	stationID, stationName, line := "SU-A", "Alexanderplatz", "U8"
+	latitude, longitude := 52.5217905, 13.4136147
+	rows := []structs.ExportRow{
+		{
+			ID:               "6c1f3b2e-7a0d-4e53-9a55-3b8d0f3c2a11",
+			Timestamp:        time.Date(2024, 5, 1, 6, 12, 3, 0, time.UTC),
+			Line:             &line,
+			StationID:        &stationID,
+			StationName:      &stationName,
+			StationLatitude:  &latitude,
+			StationLongitude: &longitude,
+			StationLines:     []string{"U2", "U5", "U8"},
+		},
+		{ID: "0b5e3d7a-2f4c-4d1e-8a9b-1c2d3e4f5a6b", Timestamp: time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)},
+	}
+
+	write := func(t *testing.T, format string) []byte {
+		var buf bytes.Buffer
+		writer, err := api.NewExportWriter(format, &buf)
+		if err != nil {
+			t.Fatalf("NewExportWriter(%s) failed: %v", format, err)
+		}
+		for _, row := range rows {
+			if err := writer.Write(row); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		records, err := csv.NewReader(bytes.NewReader(write(t, api.ExportFormatCSV))).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read the CSV: %v", err)
+		}
+		if len(records) != len(rows)+1 {
+			t.Fatalf("Expected a header and %d rows, got %d records", len(rows), len(records))
+		}
+		if records[0][5] != "station_id" || records[1][5] != stationID || records[1][9] != "U2,U5,U8" || records[2][5] != "" {
+			t.Errorf("Unexpected CSV records: %v", records)
+		}
+	})
+
+	t.Run("JSON Lines", func(t *testing.T) {
+		decoder := json.NewDecoder(bytes.NewReader(write(t, api.ExportFormatJSONL)))
+		var decoded []structs.ExportRow
+		for decoder.More() {
+			var row structs.ExportRow
+			if err := decoder.Decode(&row); err != nil {
+				t.Fatalf("Failed to decode a line: %v", err)
+			}
+			decoded = append(decoded, row)
+		}
+		if len(decoded) != len(rows) || *decoded[0].StationName != stationName || decoded[1].StationID != nil {
+			t.Errorf("Unexpected JSON lines: %+v", decoded)
+		}
+	})
+
+	t.Run("Parquet", func(t *testing.T) {
+		data := write(t, api.ExportFormatParquet)
+		decoded, err := parquet.Read[structs.ExportRow](bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Failed to read the Parquet file: %v", err)
+		}
+		if len(decoded) != len(rows) || *decoded[0].StationLatitude != latitude || decoded[1].Line != nil || !decoded[0].Timestamp.Equal(rows[0].Timestamp) {
+			t.Errorf("Unexpected Parquet rows: %+v", decoded)
+		}
+	})
+
+	if _, err := api.NewExportWriter("xlsx", &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	pb "github.com/FreiFahren/backend/proto"
+	structs "github.com/FreiFahren/backend/structs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newGRPCClient(t *testing.T) pb.FreiFahrenClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := api.NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect to the gRPC server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewFreiFahrenClient(conn)
+}
+
+func TestGRPCLookups(t *testing.T) {
+	chdirToRepoRoot(t)
+	client := newGRPCClient(t)
+	ctx := context.Background()
+
+	station, err := client.GetStation(ctx, &pb.GetStationRequest{Query: &pb.GetStationRequest_Name{Name: "alexanderplatz"}})
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+	if station.GetId() != "SU-A" || station.GetName() != "Alexanderplatz" || len(station.GetLines()) == 0 {
+		t.Errorf("GetStation(alexanderplatz) = %v; expected SU-A with its lines", station)
+	}
+
+	_, err = client.GetStation(ctx, &pb.GetStationRequest{Query: &pb.GetStationRequest_Id{Id: "Fake Station"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetStation(Fake Station) returned %v; expected NotFound", err)
+	}
+
+	stations, err := client.ListStations(ctx, &pb.ListStationsRequest{Line: "U8"})
+	if err != nil {
+		t.Fatalf("ListStations failed: %v", err)
+	}
+	if len(stations.GetStations()) == 0 {
+		t.Errorf("ListStations(U8) returned no stations")
+	}
+}
+
+func TestGRPCReportRequiresApiKey(t *testing.T) {
+	client := newGRPCClient(t)
+
+	_, err := client.ReportInspector(context.Background(), &pb.InspectorRequest{Station: "Alexanderplatz"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ReportInspector without api key returned %v; expected Unauthenticated", err)
+	}
+}
+
+func TestGRPCStreamSightings(t *testing.T) {
+	client := newGRPCClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamSightings(ctx, &pb.StreamSightingsRequest{Lines: []string{"U8"}})
+	if err != nil {
+		t.Fatalf("StreamSightings failed: %v", err)
+	}
+
+	// Publish until the stream picks the sightings up, the other line has to be filtered out
+	go func() {
+		for ctx.Err() == nil {
+			api.Sightings.Publish(structs.TicketInspector{Line: "U6", Station: structs.Station{ID: "U-PL", Name: "Platz der Luftbrücke"}})
+			api.Sightings.Publish(structs.TicketInspector{Line: "U8", Station: structs.Station{ID: "U-Hpu", Name: "Hermannplatz"}})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	sighting, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive a sighting: %v", err)
+	}
+	if sighting.GetLine() != "U8" || sighting.GetStation().GetId() != "U-Hpu" {
+		t.Errorf("StreamSightings returned %v; expected the sighting on the U8", sighting)
+	}
+}
@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestLineFeatures(t *testing.T) {
+	stations := map[string]structs.StationListEntry{
+		"U-A": {Name: "A", Coordinates: structs.CoordinatesEntry{Latitude: 52.1, Longitude: 13.1}},
+		"U-B": {Name: "B", Coordinates: structs.CoordinatesEntry{Latitude: 52.2, Longitude: 13.2}},
+		"U-C": {Name: "C", Coordinates: structs.CoordinatesEntry{Latitude: 52.3, Longitude: 13.3}},
+	}
+	lines := map[string][]string{"U1": {"U-C", "U-A", "U-Missing", "U-B"}}
+
+	features := api.LineFeatures(lines, stations)
+	if len(features) != 1 {
+		t.Fatalf("LineFeatures returned %d features; expected 1", len(features))
+	}
+
+	// The line has to follow the order of the stations, without the unknown one
+	expected := [][]float64{{13.3, 52.3}, {13.1, 52.1}, {13.2, 52.2}}
+	if features[0].Geometry.Type != "LineString" || !reflect.DeepEqual(features[0].Geometry.Coordinates, expected) {
+		t.Errorf("LineFeatures returned %v; expected a LineString through %v", features[0].Geometry, expected)
+	}
+}
+
+func TestSightingFeatures(t *testing.T) {
+	sighting := structs.TicketInspector{
+		Station: structs.Station{ID: "SU-A", Name: "Alexanderplatz", Coordinates: structs.Coordinates{Latitude: 52.52, Longitude: 13.41}},
+		Line:    "U8",
+	}
+
+	features := api.SightingFeatures([]structs.TicketInspector{sighting})
+	if len(features) != 1 {
+		t.Fatalf("SightingFeatures returned %d features; expected 1", len(features))
+	}
+
+	feature := features[0]
+	if !reflect.DeepEqual(feature.Geometry.Coordinates, []float64{13.41, 52.52}) {
+		t.Errorf("Point has the coordinates %v; expected [longitude, latitude]", feature.Geometry.Coordinates)
+	}
+	if feature.Properties["line"] != "U8" || feature.Properties["direction"] != nil {
+		t.Errorf("Sighting has the properties %v; expected the line U8 without direction", feature.Properties)
+	}
+}
+
+func TestListGeoJSONContentNegotiation(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.GET("/list", api.GetAllStationsAndLines)
+
+	req := httptest.NewRequest(http.MethodGet, "/list?lines=true", nil)
+	req.Header.Set(echo.HeaderAccept, api.MIMEApplicationGeoJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != api.MIMEApplicationGeoJSON {
+		t.Fatalf("GET /list returned %d as %s; expected GeoJSON", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	var collection structs.FeatureCollection
+	if err := json.Unmarshal(rec.Body.Bytes(), &collection); err != nil {
+		t.Fatalf("Failed to decode the FeatureCollection: %v", err)
+	}
+	for _, feature := range collection.Features {
+		if feature.Geometry.Type != "LineString" {
+			t.Fatalf("GET /list?lines=true returned a %s; expected only lines", feature.Geometry.Type)
+		}
+	}
+	if len(collection.Features) == 0 {
+		t.Errorf("GET /list?lines=true returned no lines")
+	}
+}
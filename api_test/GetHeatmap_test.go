@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetHeatmapValidation(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/stats/heatmap", api.GetHeatmap)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Invalid from", "from=yesterday"},
+		{"Invalid to", "to=2024-13-01"},
+		{"From after to", "from=2024-05-02T00:00:00Z&to=2024-05-01T00:00:00Z"},
+		{"Hour out of range", "hours=17,24"},
+		{"Invalid hour", "hours=night"},
+		{"Weekday out of range", "weekdays=7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/heatmap?"+tt.query, nil))
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("GET /stats/heatmap?%s returned %d; expected %d: %s", tt.query, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuildHeatmap(t *testing.T) {
+	chdirToRepoRoot(t)
+	stations, err := api.ReadFromFile("data/StationsList.json")
+	if err != nil {
+		t.Fatalf("Failed to read the stations: %v", err)
+	}
+
+	filter := structs.AggregationFilter{From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}
+	stationCounts := []structs.ReportCount{{Key: "SU-A", Count: 8}, {Key: "X-Removed", Count: 6}, {Key: "U-Hpu", Count: 2}}
+	lineCounts := []structs.ReportCount{{Key: "U8", Count: 10}, {Key: "S7", Count: 4}}
+
+	heatmap := api.BuildHeatmap(filter, stationCounts, lineCounts, stations)
+
+	if !heatmap.From.Equal(filter.From) || !heatmap.To.Equal(filter.To) {
+		t.Errorf("Expected the period of the filter, got %v to %v", heatmap.From, heatmap.To)
+	}
+
+	// Stations missing in the station list are dropped
+	if len(heatmap.Stations) != 2 {
+		t.Fatalf("Expected 2 stations, got %+v", heatmap.Stations)
+	}
+	expectedStations := []struct {
+		id     string
+		count  int
+		weight float64
+	}{{"SU-A", 8, 1}, {"U-Hpu", 2, 0.25}}
+	for i, expected := range expectedStations {
+		station := heatmap.Stations[i]
+		if station.Station.ID != expected.id || station.Count != expected.count || station.Weight != expected.weight {
+			t.Errorf("Expected %s with %d reports and weight %v, got %s with %d and %v", expected.id, expected.count, expected.weight, station.Station.ID, station.Count, station.Weight)
+		}
+		if station.Station.Name == "" || station.Station.Coordinates.Latitude == 0 {
+			t.Errorf("Expected the name and coordinates of %s, got %+v", expected.id, station.Station)
+		}
+	}
+
+	if len(heatmap.Lines) != 2 || heatmap.Lines[0].Weight != 1 || heatmap.Lines[1].Line != "S7" || heatmap.Lines[1].Weight != 0.4 {
+		t.Errorf("Expected U8 with weight 1 and S7 with weight 0.4, got %+v", heatmap.Lines)
+	}
+
+	empty := api.BuildHeatmap(filter, nil, nil, stations)
+	if empty.Stations == nil || empty.Lines == nil {
+		t.Errorf("Expected empty lists without reports, got %+v", empty)
+	}
+}
+
+func TestHeatmapLocalBounds(t *testing.T) {
+	chdirToRepoRoot(t)
+	setup()
+	defer teardown()
+
+	// UTC bounds have to be compared with the local wall clock the reports are stored in
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() { time.Local = local }()
+
+	midnight := time.Date(2031, 5, 1, 0, 0, 0, 0, time.Local)
+	line, stationName, stationId := "U8", "Alexanderplatz", "SU-A"
+	if err := database.InsertTicketInfo(context.Background(), &midnight, nil, nil, &line, &stationName, &stationId, nil, nil, nil, false); err != nil {
+		t.Fatalf("Failed to insert ticket info: %v", err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/stats/heatmap", api.GetHeatmap)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedCount int
+	}{
+		{"Around local midnight", "from=2031-04-30T21:30:00Z&to=2031-04-30T22:30:00Z", 1},
+		{"After local midnight", "from=2031-04-30T22:30:00Z&to=2031-04-30T23:30:00Z", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/heatmap?stations=SU-A&"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /stats/heatmap?%s returned %d: %s", tt.query, rec.Code, rec.Body.String())
+			}
+
+			var heatmap structs.HeatmapResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &heatmap); err != nil {
+				t.Fatalf("Failed to decode the heatmap: %v", err)
+			}
+			count := 0
+			for _, station := range heatmap.Stations {
+				count += station.Count
+			}
+			if count != tt.expectedCount {
+				t.Errorf("Expected %d reports between %s, got %+v", tt.expectedCount, tt.query, heatmap.Stations)
+			}
+		})
+	}
+}
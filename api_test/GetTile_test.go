@@ -0,0 +1,101 @@
+package api_test
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/labstack/echo/v4"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/maptile"
+)
+
+func TestGetTileValidation(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/tiles/:z/:x/:y", api.GetTile)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"Wrong extension", "/tiles/12/2200/1343.png", http.StatusNotFound},
+		{"Zoom too large", "/tiles/30/0/0.mvt", http.StatusUnprocessableEntity},
+		{"Invalid zoom", "/tiles/z/0/0.mvt", http.StatusUnprocessableEntity},
+		{"Column outside of the map", "/tiles/1/2/0.mvt", http.StatusUnprocessableEntity},
+		{"Invalid row", "/tiles/1/0/y.mvt", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("GET %s returned %d; expected %d: %s", tt.path, rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTile(t *testing.T) {
+	chdirToRepoRoot(t)
+	store := useMemoryStore(t)
+	insertReport(t, store, time.Now().Add(-time.Minute), "U8", "SU-A", false)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/tiles/:z/:x/:y", api.GetTile)
+
+	latitude, longitude, err := api.IdToCoordinates("SU-A")
+	if err != nil {
+		t.Fatalf("Failed to get the coordinates of Alexanderplatz: %v", err)
+	}
+	tile := maptile.At(orb.Point{longitude, latitude}, 14)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/tiles/%d/%d/%d.mvt", tile.Z, tile.X, tile.Y), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET tile returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get(echo.HeaderContentType); contentType != api.MIMEVectorTile {
+		t.Errorf("Expected the content type %s, got %s", api.MIMEVectorTile, contentType)
+	}
+
+	layers, err := mvt.Unmarshal(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to decode the tile: %v", err)
+	}
+	layers.ProjectToWGS84(tile)
+
+	features := map[string]map[string]orb.Point{}
+	for _, layer := range layers {
+		features[layer.Name] = map[string]orb.Point{}
+		for _, feature := range layer.Features {
+			if point, ok := feature.Geometry.(orb.Point); ok {
+				features[layer.Name][fmt.Sprint(feature.Properties["id"])] = point
+			}
+		}
+	}
+
+	for _, layer := range []string{"stations", "sightings"} {
+		point, ok := features[layer]["SU-A"]
+		if !ok {
+			t.Errorf("Expected Alexanderplatz in the %s layer, got %v", layer, features[layer])
+			continue
+		}
+		// The coordinates are rounded to the grid of the tile
+		if math.Abs(point.Lon()-longitude) > 0.001 || math.Abs(point.Lat()-latitude) > 0.001 {
+			t.Errorf("Expected Alexanderplatz at %v, %v in the %s layer, got %v", longitude, latitude, layer, point)
+		}
+	}
+	if _, ok := features["lines"]; !ok {
+		t.Error("Expected a lines layer")
+	}
+}
@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGraphQLQuery(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.POST("/graphql", api.GraphQL)
+
+	query := `{
+		station(name: "alexanderplatz") { id name lines { name } }
+		lines(names: ["U8"]) { name stations { id } }
+	}`
+	body, _ := json.Marshal(map[string]string{"query": query})
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /graphql returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result struct {
+		Data struct {
+			Station struct {
+				ID    string
+				Name  string
+				Lines []struct{ Name string }
+			}
+			Lines []struct {
+				Name     string
+				Stations []struct{ ID string }
+			}
+		}
+		Errors []interface{}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode the result: %v", err)
+	}
+
+	if len(result.Errors) > 0 {
+		t.Fatalf("Query returned errors: %v", result.Errors)
+	}
+	if result.Data.Station.ID != "SU-A" || result.Data.Station.Name != "Alexanderplatz" || len(result.Data.Station.Lines) == 0 {
+		t.Errorf("station(name: alexanderplatz) = %+v; expected SU-A with its lines", result.Data.Station)
+	}
+	if len(result.Data.Lines) != 1 || result.Data.Lines[0].Name != "U8" || len(result.Data.Lines[0].Stations) == 0 {
+		t.Errorf("lines(names: [U8]) = %+v; expected U8 with its stations", result.Data.Lines)
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.POST("/graphql", api.GraphQL)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body := `{"query": "subscription { sightings(lines: [\"U8\"]) { line { name } station { name } } }"}`
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/graphql", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAccept, "text/event-stream")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer res.Body.Close()
+
+	// Publish until the subscription picks the sightings up, the other line has to be filtered out
+	go func() {
+		for ctx.Err() == nil {
+			api.Sightings.Publish(structs.TicketInspector{Line: "U6", Station: structs.Station{ID: "U-PL", Name: "Platz der Luftbrücke"}})
+			api.Sightings.Publish(structs.TicketInspector{Line: "U8", Station: structs.Station{ID: "U-Hpu", Name: "Hermannplatz"}})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		expected := `{"data":{"sightings":{"line":{"name":"U8"},"station":{"name":"Hermannplatz"}}}}`
+		if data != expected {
+			t.Errorf("Subscription returned %s; expected %s", data, expected)
+		}
+		return
+	}
+	t.Fatalf("Subscription ended without a sighting: %v", scanner.Err())
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	api.RegisterRoutes(e.Group(""))
+
+	var wide strings.Builder
+	wide.WriteString("{")
+	for i := 0; i < 101; i++ {
+		fmt.Fprintf(&wide, " s%d: stations(line: \"U8\") { id }", i)
+	}
+	wide.WriteString(" }")
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Six levels", `{ station(id: "SU-A") { lines { stations { lines { stations { id } } } } } }`, http.StatusOK},
+		{"Seven levels", `{ station(id: "SU-A") { lines { stations { lines { stations { lines { name } } } } } } }`, http.StatusUnprocessableEntity},
+		{"Seven levels through fragments", `{ station(id: "SU-A") { ...Deep } } fragment Deep on Station { lines { stations { lines { stations { lines { name } } } } } }`, http.StatusUnprocessableEntity},
+		{"Too many fields", wide.String(), http.StatusUnprocessableEntity},
+		{"Nested lists", `{ lines { stations { lines { stations { lines { name } } } } } }`, http.StatusUnprocessableEntity},
+		{"Nested lists through fragments", `{ lines { ...Stations } } fragment Stations on Line { stations { lines { stations { lines { name } } } } }`, http.StatusUnprocessableEntity},
+		{"Nested lists beyond the depth", `{ lines { stations { lines { stations { lines { stations { id } } } } } } }`, http.StatusUnprocessableEntity},
+		{"Body too large", `{ lines { name } }` + strings.Repeat(" ", 64*1024), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"query": tt.query})
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("POST /graphql returned %d; expected %d: %.200s", rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+
+	e.GET("/station", api.GetStationName)
+	e.GET("/id", api.GetStationId)
+	e.GET("/unavailable", func(c echo.Context) error {
+		return api.Unavailable("Database is down", errors.New("connection refused"))
+	})
+	e.GET("/unexpected", func(c echo.Context) error {
+		return errors.New("something unexpected")
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Missing station id", "/station", http.StatusUnprocessableEntity, api.ErrorCodeValidationFailed},
+		{"Missing station name", "/id", http.StatusUnprocessableEntity, api.ErrorCodeValidationFailed},
+		{"Unavailable", "/unavailable", http.StatusServiceUnavailable, api.ErrorCodeUnavailable},
+		{"Unexpected error", "/unexpected", http.StatusInternalServerError, api.ErrorCodeInternal},
+		{"Unknown route", "/unknown", http.StatusNotFound, api.ErrorCodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("GET %s returned %d; expected %d", tt.path, rec.Code, tt.expectedStatus)
+			}
+
+			var response structs.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("GET %s returned no error envelope: %s", tt.path, rec.Body.String())
+			}
+
+			if response.Code != tt.expectedCode {
+				t.Errorf("GET %s returned code %s; expected %s", tt.path, response.Code, tt.expectedCode)
+			}
+			if response.Message == "" {
+				t.Errorf("GET %s returned an empty message", tt.path)
+			}
+			if response.RequestID == "" || response.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+				t.Errorf("GET %s returned request id %q; expected %q", tt.path, response.RequestID, rec.Header().Get(echo.HeaderXRequestID))
+			}
+		})
+	}
+}
+
+func TestHTTPErrorHandlerPoolExhausted(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+
+	e.GET("/busy", func(c echo.Context) error {
+		return api.Unavailable("Failed to get the sightings", fmt.Errorf("query execution error: %w", database.ErrPoolExhausted))
+	})
+	e.GET("/timeout", func(c echo.Context) error {
+		return api.Unavailable("Failed to get the sightings", fmt.Errorf("query execution error: %w", context.DeadlineExceeded))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/busy", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d when the pool is exhausted, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Expected Retry-After 1 when the pool is exhausted, got %q", retryAfter)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/timeout", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d when the query timed out, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "" {
+		t.Errorf("Expected no Retry-After when the query timed out, got %q", retryAfter)
+	}
+}
+
+func TestHTTPErrorHandlerExportRunning(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+
+	e.GET("/export", func(c echo.Context) error {
+		return api.Unavailable("Failed to export the reports", database.ErrExportRunning)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d while another export is running, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("Expected Retry-After 60 while another export is running, got %q", retryAfter)
+	}
+}
@@ -0,0 +1,46 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/labstack/echo/v4"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		expectedIP string
+	}{
+		{"Forwarded header is ignored without proxies", "", "203.0.113.7:1234", "203.0.113.7"},
+		{"Forwarded header of a trusted proxy", "10.0.0.0/8", "10.1.2.3:1234", "198.51.100.1"},
+		{"Forwarded header of an unknown proxy", "10.0.0.0/8", "192.168.1.1:1234", "192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+			extractor, err := api.IPExtractor()
+			if err != nil {
+				t.Fatalf("IPExtractor failed: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.1")
+
+			if ip := extractor(req); ip != tt.expectedIP {
+				t.Errorf("Expected the IP %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,not-a-range")
+	if _, err := api.IPExtractor(); err == nil {
+		t.Error("Expected an error for an invalid range")
+	}
+}
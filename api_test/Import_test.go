@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+)
+
+func newTestImporter(t *testing.T) *api.Importer {
+	chdirToRepoRoot(t)
+	stations, err := api.ReadFromFile("data/StationsList.json")
+	if err != nil {
+		t.Fatalf("Failed to read the stations: %v", err)
+	}
+	lines, err := api.ReadLinesList("data/LinesList.json")
+	if err != nil {
+		t.Fatalf("Failed to read the lines: %v", err)
+	}
+	return api.NewImporter(stations, lines)
+}
+
+func TestParseTelegramExport(t *testing.T) {
+	export := `{
+		"name": "Freifahren",
+		"id": 1234,
+		"messages": [
+			{"id": 1, "type": "service", "date": "2023-05-01T08:00:00", "action": "join_group_by_link"},
+			{"id": 2, "type": "message", "date": "2023-05-01T08:12:00", "date_unixtime": "1682921520", "from_id": "user42", "text": "U8 Hermannplatz Richtung Wittenau, 2 Kontrolleure"},
+			{"id": 3, "type": "message", "date": "2023-05-01T08:13:00", "from_id": "user43", "text": ["Jetzt ", {"type": "bold", "text": "Freie Universität (Thielplatz)"}]},
+			{"id": 4, "type": "message", "date": "2023-05-01T08:14:00", "from_id": "user44", "text": "Danke!"},
+			{"id": 5, "type": "message", "date": "2023-05-01T08:15:00", "from_id": "user45", "text": ""}
+		]
+	}`
+
+	importer := newTestImporter(t)
+	records, rejects, err := importer.ParseTelegramExport("result.json", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseTelegramExport failed: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %+v", len(records), records)
+	}
+	first := records[0]
+	if *first.StationID != "U-Hpu" || *first.DirectionID != "SU-WIU" || *first.Line != "U8" || *first.Author != 42 {
+		t.Errorf("Unexpected first record: station %v, direction %v, line %v, author %v", *first.StationID, first.DirectionID, first.Line, first.Author)
+	}
+	if first.Timestamp.Unix() != 1682921520 {
+		t.Errorf("Expected the original time of the message, got %v", first.Timestamp)
+	}
+	if *records[1].StationID != "U-T" || records[1].Line != nil {
+		t.Errorf("Unexpected second record: %+v", records[1])
+	}
+
+	if len(rejects) != 1 || rejects[0].Reference != "message 4" || rejects[0].Reason != "no station found" {
+		t.Errorf("Expected message 4 to be rejected, got %+v", rejects)
+	}
+
+	again, _, _ := importer.ParseTelegramExport("copy.json", strings.NewReader(export))
+	if again[0].SourceHash != first.SourceHash || first.SourceHash == records[1].SourceHash {
+		t.Error("Expected the source hash to identify the message, independent of the file")
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	file := `Timestamp,Station,Line,Direction,Message,Author
+2023-05-01 08:12:00,Alexanderplatz,u8,Wittenau,,
+2023-05-01T08:12:00+02:00,U-Kbo,,,Zwei in blau,42
+yesterday,Alexanderplatz,,,,
+2023-05-01 09:00:00,Nowhere,,,,
+2023-05-01 09:00:00,Alexanderplatz,X99,,,
+`
+
+	importer := newTestImporter(t)
+	records, rejects, err := importer.ParseCSV("reports.csv", strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseCSV failed: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %+v", len(records), records)
+	}
+	if *records[0].StationID != "SU-A" || *records[0].Line != "U8" || *records[0].DirectionID != "SU-WIU" || records[0].Message != nil {
+		t.Errorf("Unexpected first record: %+v", records[0])
+	}
+	if *records[1].StationName != "Kottbusser Tor" || *records[1].Author != 42 || records[0].SourceHash == records[1].SourceHash {
+		t.Errorf("Unexpected second record: %+v", records[1])
+	}
+
+	expectedRejects := map[string]string{"line 4": "invalid timestamp", "line 5": "unknown station", "line 6": "unknown line"}
+	if len(rejects) != len(expectedRejects) {
+		t.Fatalf("Expected %d rejects, got %+v", len(expectedRejects), rejects)
+	}
+	for _, reject := range rejects {
+		if expectedRejects[reject.Reference] != reject.Reason {
+			t.Errorf("Unexpected reject %+v", reject)
+		}
+	}
+
+	if _, _, err := importer.ParseCSV("empty.csv", strings.NewReader("line,direction\n")); err == nil {
+		t.Error("Expected an error for a file without timestamp and station columns")
+	}
+}
@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/commands"
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func useMemoryStore(t *testing.T) *database.MemoryStore {
+	store := database.NewMemoryStore()
+	previous := api.Reports
+	api.Reports = store
+	t.Cleanup(func() { api.Reports = previous })
+	return store
+}
+
+func insertReport(t *testing.T, store *database.MemoryStore, at time.Time, line, stationID string, quarantined bool) {
+	stationName := stationID
+	if err := store.InsertTicketInfo(context.Background(), &at, nil, nil, &line, &stationName, &stationID, nil, nil, nil, quarantined); err != nil {
+		t.Fatalf("Failed to insert the report: %v", err)
+	}
+}
+
+func TestMemoryStoreRecent(t *testing.T) {
+	store := database.NewMemoryStore()
+	ctx := context.Background()
+	now := time.Date(2024, 6, 3, 14, 30, 0, 0, time.Local)
+
+	insertReport(t, store, now.Add(-5*time.Minute), "U8", "SU-A", false)
+	insertReport(t, store, now.Add(-10*time.Minute), "U7", "U-Hpu", true)
+	insertReport(t, store, now.Add(-20*time.Minute), "U8", "SU-WIU", false)
+	insertReport(t, store, now.Add(5*time.Minute), "U8", "SU-WIU", false)
+
+	recent, err := store.GetStationCoordinatesAt(ctx, now)
+	if err != nil {
+		t.Fatalf("GetStationCoordinatesAt failed: %v", err)
+	}
+	if len(recent) != 1 || recent[0].Station_ID != "SU-A" || recent[0].Line.String != "U8" || recent[0].Direction_ID.Valid {
+		t.Fatalf("Expected only the visible report of the last 15 minutes, got %+v", recent)
+	}
+	// Like a TIMESTAMP column, the time keeps its wall clock without the zone
+	if recent[0].Timestamp.Hour() != 14 || recent[0].Timestamp.Minute() != 25 {
+		t.Errorf("Expected the wall clock 14:25, got %v", recent[0].Timestamp)
+	}
+
+	latest, err := store.GetLatestUpdateTime(ctx)
+	if err != nil {
+		t.Fatalf("GetLatestUpdateTime failed: %v", err)
+	}
+	// The latest report left the 15 minutes after it was made
+	if !latest.Equal(now.Add(20 * time.Minute)) {
+		t.Errorf("Expected the latest update at %v, got %v", now.Add(20*time.Minute), latest)
+	}
+
+	empty, err := database.NewMemoryStore().GetLatestUpdateTime(ctx)
+	if err != nil || !empty.IsZero() {
+		t.Errorf("Expected no update time without reports, got %v (%v)", empty, err)
+	}
+}
+
+func TestMemoryStoreLatest(t *testing.T) {
+	store := database.NewMemoryStore()
+	now := time.Now()
+
+	insertReport(t, store, now.Add(-5*time.Minute), "U8", "SU-A", false)
+	insertReport(t, store, now.Add(-20*time.Minute), "U8", "SU-WIU", false)
+	// Like NOW() in the query, reports with a clock slightly ahead are live as well
+	insertReport(t, store, now.Add(time.Minute), "U7", "U-Hpu", false)
+
+	latest, err := store.GetLatestStationCoordinates(context.Background())
+	if err != nil {
+		t.Fatalf("GetLatestStationCoordinates failed: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Station_ID != "SU-A" || latest[1].Station_ID != "U-Hpu" {
+		t.Errorf("Expected the reports of the last 15 minutes, got %+v", latest)
+	}
+}
+
+func TestMemoryStoreHistoric(t *testing.T) {
+	store := database.NewMemoryStore()
+	ctx := context.Background()
+	at := time.Date(2024, 6, 3, 14, 30, 0, 0, time.Local)
+
+	// Mondays at 14:xx, one week apart
+	insertReport(t, store, at.AddDate(0, 0, -7), "U8", "SU-A", false)
+	insertReport(t, store, at.AddDate(0, 0, -14), "U8", "SU-A", false)
+	insertReport(t, store, at.AddDate(0, 0, -14), "U7", "U-Hpu", false)
+	insertReport(t, store, at.AddDate(0, 0, -21), "U7", "U-Hpu", true)
+	// Another hour and a report after the time don't count
+	insertReport(t, store, at.AddDate(0, 0, -7).Add(2*time.Hour), "U8", "SU-WIU", false)
+	insertReport(t, store, at.Add(time.Minute), "U8", "SU-WIU", false)
+	// Quarantined reports don't move the time of the last report
+	insertReport(t, store, at.Add(-time.Hour), "U7", "U-Hpu", true)
+
+	historic, err := store.GetHistoricStations(ctx, at)
+	if err != nil {
+		t.Fatalf("GetHistoricStations failed: %v", err)
+	}
+
+	if len(historic) != 2 || historic[0].Station_ID != "SU-A" || historic[1].Station_ID != "U-Hpu" {
+		t.Fatalf("Expected SU-A and U-Hpu by their number of reports, got %+v", historic)
+	}
+	lastReport := at.AddDate(0, 0, -7).Add(2 * time.Hour)
+	for _, ticketInfo := range historic {
+		if !ticketInfo.IsHistoric || ticketInfo.Timestamp.Hour() != lastReport.Hour() || ticketInfo.Timestamp.Day() != lastReport.Day() {
+			t.Errorf("Expected a historic sighting at the time of the last report %v, got %+v", lastReport, ticketInfo)
+		}
+	}
+
+	none, err := store.GetHistoricStations(ctx, at.AddDate(-1, 0, 0))
+	if err != nil || len(none) != 0 {
+		t.Errorf("Expected no historic data before the first report, got %+v (%v)", none, err)
+	}
+}
+
+func TestReportAndRecentWithMemoryStore(t *testing.T) {
+	chdirToRepoRoot(t)
+	useMemoryStore(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.POST("/newInspector", api.PostInspector)
+	e.GET("/recent", api.GetRecentTicketInspectorInfo)
+
+	req := httptest.NewRequest(http.MethodPost, "/newInspector", strings.NewReader(`{"line":"U8","station":"Alexanderplatz","direction":"Wittenau"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /newInspector returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recent", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /recent returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(echo.HeaderLastModified) == "" {
+		t.Error("Expected a Last-Modified header for the reported sighting")
+	}
+
+	var sightings []structs.TicketInspector
+	if err := json.Unmarshal(rec.Body.Bytes(), &sightings); err != nil {
+		t.Fatalf("Failed to decode the sightings: %v", err)
+	}
+	if len(sightings) == 0 || sightings[0].Station.ID != "SU-A" || sightings[0].Direction.ID != "SU-WIU" || sightings[0].IsHistoric {
+		t.Fatalf("Expected the reported sighting at Alexanderplatz first, got %+v", sightings)
+	}
+}
+
+func TestCommandsNeedDatabase(t *testing.T) {
+	useMemoryStore(t)
+
+	// The commands are refused before they touch a table
+	for _, args := range [][]string{{"keys", "list"}, {"export", "-format", "csv"}, {"import", "result.json"}} {
+		err := commands.Run(args)
+		if err == nil || !strings.Contains(err.Error(), "needs the database") {
+			t.Errorf("%s with the in-memory store returned %v; expected an error asking for the database", args[0], err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestRecordMetrics(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.Use(api.RecordMetrics)
+	e.Use(middleware.Recover())
+	e.GET("/metrics", api.GetMetrics)
+	e.GET("/metricsTest/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+	e.GET("/metricsTest/failing", func(c echo.Context) error {
+		return api.ValidationFailed("Invalid")
+	})
+	e.GET("/metricsTest/panic", func(c echo.Context) error {
+		panic("broken")
+	})
+
+	for _, path := range []string{"/metricsTest/1", "/metricsTest/2", "/metricsTest/failing", "/metricsTest/panic", "/unknown/path"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", rec.Code)
+	}
+	metrics := rec.Body.String()
+
+	expected := []string{
+		`freifahren_http_request_duration_seconds_count{method="GET",route="/metricsTest/:id",status="200"} 2`,
+		`freifahren_http_request_duration_seconds_count{method="GET",route="/metricsTest/failing",status="422"} 1`,
+		`freifahren_http_request_duration_seconds_count{method="GET",route="/metricsTest/panic",status="500"} 1`,
+		`route="unmatched",status="404"`,
+		"freifahren_historic_fallback_total",
+		"go_goroutines",
+	}
+	for _, line := range expected {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Metrics don't contain %s", line)
+		}
+	}
+	if strings.Contains(metrics, "/unknown/path") {
+		t.Error("Unknown paths must not be used as route label")
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	chdirToRepoRoot(t)
+	e := echo.New()
+	e.GET("/healthz", api.GetHealth)
+	e.GET("/readyz", api.GetReadiness)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+		failingCheck   string
+	}{
+		{"/healthz", http.StatusOK, ""},
+		// The tests run without a database
+		{"/readyz", http.StatusServiceUnavailable, "database"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.expectedStatus {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.expectedStatus, rec.Code)
+		}
+
+		var response structs.HealthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: invalid response: %v", tt.path, err)
+		}
+		if response.Checks["stations"] != "ok" {
+			t.Errorf("%s: the station data should be loaded, got %q", tt.path, response.Checks["stations"])
+		}
+		if tt.failingCheck != "" && (response.Status != "unavailable" || response.Checks[tt.failingCheck] == "ok") {
+			t.Errorf("%s: expected the %s check to fail, got %+v", tt.path, tt.failingCheck, response)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/labstack/echo/v4"
+)
+
+func TestModerationRejectsInvalidReportIDs(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/admin/reports/:id", api.GetReport)
+	e.POST("/admin/reports/:id/hide", api.HideReport)
+	e.POST("/admin/reports/:id/restore", api.RestoreReport)
+	e.POST("/admin/reports/:id/approve", api.ApproveReport)
+	e.POST("/admin/bans", api.BanReporter)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/admin/reports/not-a-uuid", ""},
+		{http.MethodPost, "/admin/reports/42/hide", `{"reason":"Spam"}`},
+		{http.MethodPost, "/admin/reports/42/restore", ""},
+		{http.MethodPost, "/admin/reports/42/approve", ""},
+		{http.MethodPost, "/admin/bans", `{"reportId":"42"}`},
+	}
+
+	// The ids are rejected before the database is queried
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s returned %d; expected %d", tt.method, tt.path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/pushtest"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSubscriptionMatches(t *testing.T) {
+	// Wednesday, 1 May 2024
+	morning := time.Date(2024, 5, 1, 8, 12, 0, 0, time.Local)
+	sighting := structs.TicketInspector{Timestamp: morning, Station: structs.Station{ID: "U-Hpu"}, Line: "U8"}
+
+	tests := []struct {
+		name         string
+		subscription structs.PushSubscription
+		expected     bool
+	}{
+		{"Watched station", structs.PushSubscription{Stations: []string{"SU-A", "U-Hpu"}}, true},
+		{"Other station", structs.PushSubscription{Stations: []string{"SU-A"}}, false},
+		{"Watched line", structs.PushSubscription{Lines: []string{"U8"}}, true},
+		{"Station on another line", structs.PushSubscription{Stations: []string{"U-Hpu"}, Lines: []string{"U7"}}, false},
+		{"Within the time window", structs.PushSubscription{Lines: []string{"U8"}, From: "07:30", To: "09:00"}, true},
+		{"Outside of the time window", structs.PushSubscription{Lines: []string{"U8"}, From: "17:00", To: "19:00"}, false},
+		{"Window over midnight", structs.PushSubscription{Lines: []string{"U8"}, From: "22:00", To: "08:30"}, true},
+		{"On a watched weekday", structs.PushSubscription{Lines: []string{"U8"}, Weekdays: []int{1, 2, 3, 4, 5}}, true},
+		{"Only on weekends", structs.PushSubscription{Lines: []string{"U8"}, Weekdays: []int{0, 6}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.SubscriptionMatches(tt.subscription, sighting); got != tt.expected {
+				t.Errorf("SubscriptionMatches() = %v; expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeliverWebPush(t *testing.T) {
+	pushService := pushtest.NewServer()
+	defer pushService.Close()
+
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Failed to generate VAPID keys: %v", err)
+	}
+	notifier := api.NewNotifier(api.VAPIDConfig{PublicKey: publicKey, PrivateKey: privateKey, Subject: "mailto:test@example.com"}, http.DefaultClient)
+
+	subscription, err := pushService.Subscribe()
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	sighting := structs.TicketInspector{
+		Timestamp: time.Now(),
+		Station:   structs.Station{ID: "U-Hpu", Name: "Hermannplatz"},
+		Direction: structs.Station{ID: "SU-WIU", Name: "Wittenau"},
+		Line:      "U8",
+	}
+	if err := notifier.Deliver(subscription, api.NewPushNotification(sighting)); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	messages := pushService.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	var notification structs.PushNotification
+	if err := json.Unmarshal(messages[0].Payload, &notification); err != nil {
+		t.Fatalf("Failed to decode the decrypted payload: %v", err)
+	}
+	if notification.Title != "Ticket inspectors at Hermannplatz" || !strings.Contains(notification.Body, "towards Wittenau") || notification.Sighting.Line != "U8" {
+		t.Errorf("Unexpected notification: %+v", notification)
+	}
+	if messages[0].Urgency != "high" || messages[0].TTL != "900" {
+		t.Errorf("Unexpected headers: urgency %s, ttl %s", messages[0].Urgency, messages[0].TTL)
+	}
+
+	pushService.Expire(subscription.Endpoint)
+	if err := notifier.Deliver(subscription, api.NewPushNotification(sighting)); !errors.Is(err, api.ErrSubscriptionExpired) {
+		t.Errorf("Expected ErrSubscriptionExpired for an expired subscription, got %v", err)
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var received structs.PushNotification
+	gone := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := api.NewNotifier(api.VAPIDConfig{}, http.DefaultClient)
+	subscription := structs.PushSubscription{Channel: structs.PushChannelWebhook, Endpoint: server.URL}
+	notification := api.NewPushNotification(structs.TicketInspector{Station: structs.Station{ID: "SU-A", Name: "Alexanderplatz"}})
+
+	if err := notifier.Deliver(subscription, notification); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if received.Sighting.Station.ID != "SU-A" {
+		t.Errorf("Unexpected webhook payload: %+v", received)
+	}
+
+	gone = true
+	if err := notifier.Deliver(subscription, notification); !errors.Is(err, api.ErrSubscriptionExpired) {
+		t.Errorf("Expected ErrSubscriptionExpired for 410 Gone, got %v", err)
+	}
+
+	if err := notifier.Deliver(structs.PushSubscription{Channel: structs.PushChannelWebPush, Endpoint: server.URL}, notification); err == nil {
+		t.Error("Expected an error for Web Push without VAPID keys")
+	}
+}
+
+func TestDeliverRefusesInternalAddresses(t *testing.T) {
+	received := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The test server listens on the loopback address
+	notifier := api.NewNotifier(api.VAPIDConfig{}, api.NewPublicClient(time.Second))
+	subscription := structs.PushSubscription{Channel: structs.PushChannelWebhook, Endpoint: server.URL}
+	notification := api.NewPushNotification(structs.TicketInspector{Station: structs.Station{ID: "SU-A", Name: "Alexanderplatz"}})
+
+	if err := notifier.Deliver(subscription, notification); err == nil {
+		t.Error("Expected an error for a webhook on the loopback address")
+	}
+	if received {
+		t.Error("The webhook on the loopback address received the notification")
+	}
+}
+
+func TestPushSubscriptionValidation(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	// Webhooks can only be subscribed by partners
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("role", structs.RolePartner)
+			return next(c)
+		}
+	})
+	e.POST("/subscriptions", api.CreatePushSubscription)
+	e.DELETE("/subscriptions/:id", api.DeletePushSubscription)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"Invalid JSON", `{"channel":`, http.StatusBadRequest},
+		{"Unknown channel", `{"channel":"sms","endpoint":"https://example.com","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Web Push is not configured", `{"channel":"webpush","endpoint":"https://push.example.com/1","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Invalid endpoint", `{"channel":"webhook","endpoint":"ftp://example.com","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Endpoint without https", `{"channel":"webhook","endpoint":"http://example.com","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Loopback endpoint", `{"channel":"webhook","endpoint":"https://127.0.0.1/hook","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"IPv6 loopback endpoint", `{"channel":"webhook","endpoint":"https://[::1]/hook","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Private endpoint", `{"channel":"webhook","endpoint":"https://10.0.0.1/hook","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Link-local endpoint", `{"channel":"webhook","endpoint":"https://169.254.169.254/latest/meta-data","lines":["U8"]}`, http.StatusUnprocessableEntity},
+		{"Nothing watched", `{"channel":"webhook","endpoint":"https://example.com"}`, http.StatusUnprocessableEntity},
+		{"Unknown station", `{"channel":"webhook","endpoint":"https://example.com","stations":["U-Nowhere"]}`, http.StatusUnprocessableEntity},
+		{"Unknown line", `{"channel":"webhook","endpoint":"https://example.com","lines":["U99"]}`, http.StatusUnprocessableEntity},
+		{"Only a start time", `{"channel":"webhook","endpoint":"https://example.com","lines":["U8"],"from":"07:30"}`, http.StatusUnprocessableEntity},
+		{"Invalid time", `{"channel":"webhook","endpoint":"https://example.com","lines":["U8"],"from":"7h","to":"9h"}`, http.StatusUnprocessableEntity},
+		{"Invalid weekday", `{"channel":"webhook","endpoint":"https://example.com","lines":["U8"],"weekdays":[7]}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("POST /subscriptions returned %d; expected %d: %s", rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/subscriptions/6c1f3b2e-7a0d-4e53-9a55-3b8d0f3c2a11", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE without token returned %d; expected %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestWebhookSubscriptionNeedsPartner(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.POST("/subscriptions", api.CreatePushSubscription)
+
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{"channel":"webhook","endpoint":"https://example.com","lines":["U8"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST /subscriptions of a webhook without api key returned %d; expected %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,329 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// The handlers read the station data relative to the repository root
+func chdirToRepoRoot(t *testing.T) {
+	if _, err := os.Stat("data"); err == nil {
+		return
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatalf("Failed to change to the repository root: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+}
+
+func loadOpenAPISpec(t *testing.T) map[string]interface{} {
+	encoded, err := json.Marshal(api.OpenAPISpec())
+	if err != nil {
+		t.Fatalf("Failed to encode the OpenAPI spec: %v", err)
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(encoded, &spec); err != nil {
+		t.Fatalf("Failed to decode the OpenAPI spec: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	chdirToRepoRoot(t)
+	spec := loadOpenAPISpec(t)
+
+	// /recent answers from the store in memory, without the cached responses of other tests
+	store := useMemoryStore(t)
+	insertReport(t, store, time.Now().Add(-time.Minute), "U8", "SU-A", false)
+	api.RecentResponses.Invalidate()
+	t.Cleanup(api.RecentResponses.Invalidate)
+	replayAt := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	api.RegisterRoutes(e.Group(""))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		specPath       string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"Station id", http.MethodGet, "/id?name=Alexanderplatz", "/id", "", nil, http.StatusOK},
+		{"Unknown station id", http.MethodGet, "/id?name=Fake%20Station", "/id", "", nil, http.StatusNotFound},
+		{"Missing station name", http.MethodGet, "/id", "/id", "", nil, http.StatusUnprocessableEntity},
+		{"Station name", http.MethodGet, "/station?id=SU-A", "/station", "", nil, http.StatusOK},
+		{"Unknown station name", http.MethodGet, "/station?id=X-Fake", "/station", "", nil, http.StatusNotFound},
+		{"Recent", http.MethodGet, "/recent", "/recent", "", nil, http.StatusOK},
+		{"Recent as GeoJSON", http.MethodGet, "/recent?format=geojson", "/recent", "", nil, http.StatusOK},
+		{"Recent as GeoJSON by Accept", http.MethodGet, "/recent", "/recent", "", map[string]string{echo.HeaderAccept: api.MIMEApplicationGeoJSON}, http.StatusOK},
+		{"Recent replayed", http.MethodGet, "/recent?at=" + replayAt, "/recent", "", nil, http.StatusOK},
+		{"Recent not modified", http.MethodGet, "/recent", "/recent", "", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"Recent in the future", http.MethodGet, "/recent?at=2999-01-01T00:00:00Z", "/recent", "", nil, http.StatusUnprocessableEntity},
+		{"Stations and lines", http.MethodGet, "/list", "/list", "", nil, http.StatusOK},
+		{"Lines", http.MethodGet, "/list?lines=true", "/list", "", nil, http.StatusOK},
+		{"Stations", http.MethodGet, "/list?stations=true", "/list", "", nil, http.StatusOK},
+		{"Stations and lines as GeoJSON", http.MethodGet, "/list?format=geojson", "/list", "", nil, http.StatusOK},
+		{"Disabled challenge", http.MethodGet, "/challenge", "/challenge", "", nil, http.StatusNotFound},
+		{"Empty report", http.MethodPost, "/newInspector", "/newInspector", `{}`, nil, http.StatusUnprocessableEntity},
+		{"Malformed report", http.MethodPost, "/newInspector", "/newInspector", `{"line":`, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("%s %s returned %d; expected %d: %s", tt.method, tt.path, rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+
+			response, err := specResponse(spec, tt.specPath, strings.ToLower(tt.method), rec.Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateHeaders(response, rec.Header()); err != nil {
+				t.Errorf("%s %s diverges from the OpenAPI spec: %v", tt.method, tt.path, err)
+			}
+			if rec.Code == http.StatusNotModified {
+				return
+			}
+
+			mediaType, _, _ := strings.Cut(rec.Header().Get(echo.HeaderContentType), ";")
+			schema, ok := lookup(response, "content", mediaType, "schema").(map[string]interface{})
+			if !ok {
+				t.Fatalf("response %d of %s %s as %s is not in the OpenAPI spec", rec.Code, tt.method, tt.specPath, mediaType)
+			}
+
+			var body interface{}
+			decoder := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+			decoder.UseNumber()
+			if err := decoder.Decode(&body); err != nil {
+				t.Fatalf("%s %s returned invalid JSON: %v", tt.method, tt.path, err)
+			}
+
+			if err := validateSchema(spec, schema, body, "$"); err != nil {
+				t.Errorf("%s %s diverges from the OpenAPI spec: %v", tt.method, tt.path, err)
+			}
+		})
+	}
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	paths := spec["paths"].(map[string]interface{})
+
+	e := echo.New()
+	api.RegisterRoutes(e.Group("/v1"))
+
+	documented := map[string]bool{}
+	for path, operations := range paths {
+		for method := range operations.(map[string]interface{}) {
+			documented[strings.ToUpper(method)+" "+routePattern(path)] = true
+		}
+	}
+
+	registered := map[string]bool{}
+	for _, route := range e.Routes() {
+		operation := route.Method + " " + routePattern(strings.TrimPrefix(route.Path, "/v1"))
+		registered[operation] = true
+		if !documented[operation] {
+			t.Errorf("Route %s %s is missing in the OpenAPI spec", route.Method, route.Path)
+		}
+	}
+
+	for operation := range documented {
+		if !registered[operation] {
+			t.Errorf("%s is in the OpenAPI spec, but not a route", operation)
+		}
+	}
+}
+
+// routePattern replaces the parameters of echo (:id) and OpenAPI ({id}) paths with the same placeholder,
+// a parameter covers the rest of its segment like the .mvt extension of the tiles
+func routePattern(path string) string {
+	return routeParameter.ReplaceAllString(path, "{}")
+}
+
+var routeParameter = regexp.MustCompile(`(:[^/]+|\{[^}]+\}[^/]*)`)
+
+func specResponse(spec map[string]interface{}, path, method string, status int) (map[string]interface{}, error) {
+	operation, ok := lookup(spec, "paths", path, method).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not in the OpenAPI spec", method, path)
+	}
+
+	response, ok := lookup(operation, "responses", strconv.Itoa(status)).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("response %d of %s %s is not in the OpenAPI spec", status, method, path)
+	}
+	return response, nil
+}
+
+// validateHeaders checks that the required headers of the response are sent
+func validateHeaders(response map[string]interface{}, header http.Header) error {
+	headers, _ := response["headers"].(map[string]interface{})
+	for name, definition := range headers {
+		if lookup(definition, "required") == true && header.Get(name) == "" {
+			return fmt.Errorf("missing required header %s", name)
+		}
+	}
+	return nil
+}
+
+func lookup(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// validateSchema checks the value against the subset of JSON schema the OpenAPI spec uses
+func validateSchema(spec, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := lookup(spec, "components", "schemas", name).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, ref)
+		}
+		return validateSchema(spec, resolved, value, path)
+	}
+
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: must not be null", path)
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, option := range oneOf {
+			if validateSchema(spec, option.(map[string]interface{}), value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: matches %d instead of exactly one of the schemas", path, matches)
+		}
+		return nil
+	}
+
+	switch schema["type"] {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", path, value)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", path, text)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", path, value)
+		}
+	case "number", "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %T", path, schema["type"], value)
+		}
+		if _, err := number.Int64(); schema["type"] == "integer" && err != nil {
+			return fmt.Errorf("%s: expected integer, got %s", path, number)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", path, value)
+		}
+		for i, item := range items {
+			if err := validateSchema(spec, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", path, value)
+		}
+		return validateObject(spec, schema, object, path)
+	}
+
+	return nil
+}
+
+func validateObject(spec, schema map[string]interface{}, object map[string]interface{}, path string) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+	}
+
+	// Sorted, so that the reported error is deterministic
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertyPath := path + "." + key
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			if err := validateSchema(spec, property, object[key], propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: property is not in the spec", propertyPath)
+			}
+		case map[string]interface{}:
+			if err := validateSchema(spec, additional, object[key], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+func TestWriteOpenDataFiles(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	stations := map[string]structs.StationListEntry{
+		"SU-A": {Name: "Alexanderplatz", Coordinates: structs.CoordinatesEntry{Latitude: 52.5217905, Longitude: 13.4136147}},
+	}
+	counts := []structs.HourlyCount{
+		{Hour: day.Add(8 * time.Hour), StationID: "SU-A", Line: "U8", Count: 3},
+		{Hour: day.Add(9 * time.Hour), StationID: "", Line: "S41", Count: 1},
+	}
+
+	rows := api.OpenDataRows(counts, stations)
+	if rows[0].StationName != "Alexanderplatz" || *rows[0].StationLatitude != 52.5217905 || rows[1].StationLatitude != nil {
+		t.Fatalf("Unexpected rows: %+v", rows)
+	}
+
+	dir := t.TempDir()
+	manifest, err := api.WriteOpenDataFiles(dir, day, rows, time.Now())
+	if err != nil {
+		t.Fatalf("WriteOpenDataFiles failed: %v", err)
+	}
+	if manifest.Date != "2024-05-01" || manifest.Rows != 2 || manifest.Reports != 4 || len(manifest.Files) != 2 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	snapshot := filepath.Join(dir, "2024-05-01")
+	for _, file := range manifest.Files {
+		data, err := os.ReadFile(filepath.Join(snapshot, file.Name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 || int64(len(data)) != file.Size {
+			t.Errorf("The checksum or size of %s doesn't match the manifest", file.Name)
+		}
+	}
+
+	records, err := csv.NewReader(strings.NewReader(readFile(t, filepath.Join(snapshot, "counts.csv")))).ReadAll()
+	if err != nil || len(records) != 3 || records[1][2] != "Alexanderplatz" || records[2][5] != "S41" {
+		t.Errorf("Unexpected CSV: %v (%v)", records, err)
+	}
+
+	var written structs.OpenDataManifest
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(snapshot, "manifest.json"))), &written); err != nil || written.Reports != 4 {
+		t.Errorf("Unexpected manifest.json: %+v (%v)", written, err)
+	}
+	if sums := readFile(t, filepath.Join(snapshot, "SHA256SUMS")); !strings.Contains(sums, manifest.Files[0].SHA256+"  counts.csv") {
+		t.Errorf("Unexpected SHA256SUMS: %s", sums)
+	}
+
+	// Writing the day again replaces the snapshot without leaving temporary directories behind
+	if _, err := api.WriteOpenDataFiles(dir, day, rows[:1], time.Now()); err != nil {
+		t.Fatalf("Rewriting the snapshot failed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot directory, got %d entries", len(entries))
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
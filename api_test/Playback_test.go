@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPlaybackValidation(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/recent", api.GetRecentTicketInspectorInfo)
+	e.GET("/history", api.GetHistory)
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"Invalid replay time", "/recent?at=yesterday"},
+		{"Replay time in the future", "/recent?at=" + future},
+		{"Invalid history start", "/history?from=2024-05-01"},
+		{"History start after end", "/history?from=2024-05-02T00:00:00Z&to=2024-05-01T00:00:00Z"},
+		{"Invalid history limit", "/history?limit=-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("GET %s returned %d; expected %d: %s", tt.path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReplayRecent(t *testing.T) {
+	chdirToRepoRoot(t)
+	store := useMemoryStore(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/recent", api.GetRecentTicketInspectorInfo)
+
+	at := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	insertReport(t, store, at.Add(-5*time.Minute), "U8", "SU-A", false)
+	// Too old, too new and quarantined reports are not part of the replay
+	insertReport(t, store, at.Add(-30*time.Minute), "U8", "SU-WIU", false)
+	insertReport(t, store, at.Add(5*time.Minute), "U8", "U-Hpu", false)
+	insertReport(t, store, at.Add(-10*time.Minute), "U7", "U-Hpu", true)
+	// The sighting of a week before at the same hour fills up the map
+	insertReport(t, store, at.AddDate(0, 0, -7), "S7", "SU-WIU", false)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recent?at="+at.UTC().Format(time.RFC3339), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /recent?at= returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if lastModified := rec.Header().Get(echo.HeaderLastModified); lastModified != "" {
+		t.Errorf("Expected no Last-Modified for a replay, got %s", lastModified)
+	}
+
+	var sightings []structs.TicketInspector
+	if err := json.Unmarshal(rec.Body.Bytes(), &sightings); err != nil {
+		t.Fatalf("Failed to decode the sightings: %v", err)
+	}
+	if len(sightings) != 2 {
+		t.Fatalf("Expected the sighting at Alexanderplatz and a historic one, got %+v", sightings)
+	}
+	if sightings[0].Station.ID != "SU-A" || sightings[0].Line != "U8" || sightings[0].IsHistoric || !sightings[0].Timestamp.Equal(at.Add(-5*time.Minute)) {
+		t.Errorf("Expected the sighting at Alexanderplatz 5 minutes before, got %+v", sightings[0])
+	}
+	if sightings[1].Station.ID != "SU-WIU" || !sightings[1].IsHistoric {
+		t.Errorf("Expected a historic sighting at Wittenau, got %+v", sightings[1])
+	}
+}
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
@@ -109,12 +111,12 @@ func TestGetLatestStationCoordinatesConcurrency(t *testing.T) {
 			t.Logf("Running test %d", i)
 
 			// Call the function with the pool (on the real database)
-			_, err := database.GetLatestStationCoordinates()
+			_, err := database.GetLatestStationCoordinates(context.Background())
 			if err != nil {
 				errs <- err
 			}
 
-			_, err = database.GetHistoricStations(time.Now())
+			_, err = database.GetHistoricStations(context.Background(), time.Now())
 			if err != nil {
 				errs <- err
 			}
@@ -149,3 +151,85 @@ func TestGetLatestStationCoordinatesConcurrency(t *testing.T) {
 		t.Fatalf("Failed to get latest station coordinates: %v", err)
 	}
 }
+
+func TestPoolExhausted(t *testing.T) {
+	setup()
+	defer teardown()
+
+	now := time.Now()
+	line, stationName, stationId := "U6", "Platz der Luftbrücke", "U-PL"
+	if err := database.InsertTicketInfo(context.Background(), &now, nil, nil, &line, &stationName, &stationId, nil, nil, nil, false); err != nil {
+		t.Fatalf("Failed to insert ticket info: %v", err)
+	}
+
+	// The queries hold their connections while they wait for the lock of the table
+	tx, err := testPool.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin the transaction: %v", err)
+	}
+	if _, err := tx.Exec(context.Background(), "LOCK TABLE ticket_info IN ACCESS EXCLUSIVE MODE"); err != nil {
+		t.Fatalf("Failed to lock the table: %v", err)
+	}
+
+	var queries sync.WaitGroup
+	for range database.PoolStats().MaxConns() {
+		queries.Add(1)
+		go func() {
+			defer queries.Done()
+			database.GetLatestUpdateTime(context.Background())
+		}()
+	}
+	for database.PoolStats().AcquiredConns() < database.PoolStats().MaxConns() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = database.GetLatestUpdateTime(context.Background())
+	tx.Rollback(context.Background())
+	queries.Wait()
+
+	if !errors.Is(err, database.ErrPoolExhausted) {
+		t.Fatalf("Expected ErrPoolExhausted while all connections are in use, got %v", err)
+	}
+
+	// Once the connections are back, the queries succeed again
+	if _, err := database.GetLatestUpdateTime(context.Background()); err != nil {
+		t.Fatalf("Failed to get the latest update time after the pool was released: %v", err)
+	}
+}
+
+func TestExportRunsOneAtATime(t *testing.T) {
+	setup()
+	defer teardown()
+
+	now := time.Now()
+	line, stationName, stationId := "U6", "Platz der Luftbrücke", "U-PL"
+	if err := database.InsertTicketInfo(context.Background(), &now, nil, nil, &line, &stationName, &stationId, nil, nil, nil, false); err != nil {
+		t.Fatalf("Failed to insert ticket info: %v", err)
+	}
+
+	// The first export runs until its first row is handled
+	held := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- database.StreamReports(context.Background(), structs.AggregationFilter{}, func(structs.ExportRow) error {
+			held <- struct{}{}
+			<-release
+			return errors.New("stop")
+		})
+	}()
+	<-held
+
+	err := database.StreamReports(context.Background(), structs.AggregationFilter{}, func(structs.ExportRow) error { return nil })
+	close(release)
+	<-done
+
+	if !errors.Is(err, database.ErrExportRunning) {
+		t.Fatalf("Expected ErrExportRunning while another export is running, got %v", err)
+	}
+
+	// Once the first export is done, the next one runs
+	if err := database.StreamReports(context.Background(), structs.AggregationFilter{}, func(structs.ExportRow) error { return nil }); err != nil {
+		t.Fatalf("Failed to export after the first export finished: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+)
+
+func TestQuotaTracker(t *testing.T) {
+	quotas := api.NewQuotaTracker()
+	day := time.Date(2024, 3, 19, 23, 0, 0, 0, time.UTC)
+
+	for i := 2; i >= 0; i-- {
+		remaining, ok := quotas.Use("key-a", 3, day)
+		if !ok || remaining != i {
+			t.Fatalf("Use(key-a) = %d, %t; expected %d, true", remaining, ok, i)
+		}
+	}
+
+	if _, ok := quotas.Use("key-a", 3, day); ok {
+		t.Errorf("Use(key-a) should be rejected once the quota is used up")
+	}
+
+	if _, ok := quotas.Use("key-b", 3, day); !ok {
+		t.Errorf("Use(key-b) should not be affected by the quota of key-a")
+	}
+
+	if remaining, ok := quotas.Use("key-a", 3, day.Add(2*time.Hour)); !ok || remaining != 2 {
+		t.Errorf("Use(key-a) on the next day = %d, %t; expected 2, true", remaining, ok)
+	}
+}
@@ -0,0 +1,218 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+func newCachedEcho(cache *api.ResponseCache, handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/recent", handler, cache.Middleware)
+	return e
+}
+
+func cachedRequest(e *echo.Echo, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	cache := api.NewResponseCache(time.Minute, "line")
+	e := newCachedEcho(cache, func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]string{"line": c.QueryParam("line"), "body": strings.Repeat("U8 ", 100)})
+	})
+
+	first := cachedRequest(e, "/recent?line=U8&format=json", nil)
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("Expected a cache miss, got %d %s", first.Code, first.Header().Get("X-Cache"))
+	}
+	etag := first.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/`) {
+		t.Errorf("Expected a strong ETag, got %s", etag)
+	}
+	if first.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Unexpected Cache-Control %s", first.Header().Get("Cache-Control"))
+	}
+
+	// The order of the query parameters doesn't matter
+	second := cachedRequest(e, "/recent?format=json&line=U8", nil)
+	if calls != 1 || second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() {
+		t.Fatalf("Expected the cached response, the handler ran %d times", calls)
+	}
+
+	cachedRequest(e, "/recent?line=U7", nil)
+	if calls != 2 {
+		t.Error("Different query parameters should be cached separately")
+	}
+
+	notModified := cachedRequest(e, "/recent?line=U8&format=json", map[string]string{"If-None-Match": etag})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching ETag, got %d", notModified.Code)
+	}
+
+	cache.Invalidate()
+	cachedRequest(e, "/recent?line=U8&format=json", nil)
+	if calls != 3 {
+		t.Error("The handler should run again after the cache was invalidated")
+	}
+}
+
+func TestResponseCacheEncodings(t *testing.T) {
+	body := strings.Repeat(`{"station":"Alexanderplatz"}`, 50)
+	e := newCachedEcho(api.NewResponseCache(time.Minute), func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(body))
+	})
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"", "", func(r io.Reader) (io.Reader, error) { return r, nil }},
+		{"gzip, deflate", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, deflate, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"br;q=0, gzip;q=0.5", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	}
+
+	etags := map[string]bool{}
+	for _, tt := range tests {
+		rec := cachedRequest(e, "/recent", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if rec.Header().Get("Content-Encoding") != tt.expected {
+			t.Errorf("Accept-Encoding %q: expected encoding %q, got %q", tt.acceptEncoding, tt.expected, rec.Header().Get("Content-Encoding"))
+			continue
+		}
+		if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: missing Vary header", tt.acceptEncoding)
+		}
+
+		reader, err := tt.decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("Accept-Encoding %q: %v", tt.acceptEncoding, err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || string(decoded) != body {
+			t.Errorf("Accept-Encoding %q: the body doesn't match after decoding (%v)", tt.acceptEncoding, err)
+		}
+		etags[rec.Header().Get("ETag")] = true
+	}
+
+	if len(etags) != 3 {
+		t.Errorf("Every encoding should have its own ETag, got %v", etags)
+	}
+}
+
+func TestResponseCacheSkipsErrors(t *testing.T) {
+	calls := 0
+	e := newCachedEcho(api.NewResponseCache(time.Minute), func(c echo.Context) error {
+		calls++
+		return api.Unavailable("Failed to access the database", nil)
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := cachedRequest(e, "/recent", nil)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Cache-Control") != "" {
+			t.Errorf("Expected an uncached 503, got %d with Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Errors must not be cached, the handler ran %d times", calls)
+	}
+}
+
+func TestListResponseCache(t *testing.T) {
+	chdirToRepoRoot(t)
+	e := echo.New()
+	e.GET("/list", api.GetAllStationsAndLines, api.NewResponseCache(time.Hour, "lines", "stations").Middleware)
+
+	json := cachedRequest(e, "/list?lines=true", nil)
+	geoJSON := cachedRequest(e, "/list?lines=true", map[string]string{"Accept": api.MIMEApplicationGeoJSON})
+	if json.Code != http.StatusOK || geoJSON.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d and %d", json.Code, geoJSON.Code)
+	}
+	if geoJSON.Header().Get("X-Cache") != "MISS" || json.Body.String() == geoJSON.Body.String() {
+		t.Error("JSON and GeoJSON must be cached separately")
+	}
+	if !strings.HasPrefix(geoJSON.Header().Get("Content-Type"), api.MIMEApplicationGeoJSON) {
+		t.Errorf("Unexpected content type %s", geoJSON.Header().Get("Content-Type"))
+	}
+
+	cached := cachedRequest(e, "/list?lines=true", nil)
+	if cached.Header().Get("X-Cache") != "HIT" || cached.Body.String() != json.Body.String() {
+		t.Error("Expected the cached list")
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	calls := 0
+	e := newCachedEcho(api.NewResponseCache(time.Minute, "line"), func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]string{"line": c.QueryParam("line")})
+	})
+
+	tests := []struct {
+		name          string
+		target        string
+		headers       map[string]string
+		expectedCache string
+	}{
+		{"First request", "/recent?line=U8", nil, "MISS"},
+		{"Parameter the handler doesn't read", "/recent?line=U8&utm_source=app", nil, "HIT"},
+		{"Other Accept header of JSON", "/recent?line=U8", map[string]string{"Accept": "application/json, text/plain, */*"}, "HIT"},
+		{"GeoJSON by Accept header", "/recent?line=U8", map[string]string{"Accept": api.MIMEApplicationGeoJSON}, "MISS"},
+		{"GeoJSON by format", "/recent?line=U8&format=geojson", nil, "HIT"},
+		{"Other line", "/recent?line=U7", nil, "MISS"},
+	}
+
+	for _, tt := range tests {
+		rec := cachedRequest(e, tt.target, tt.headers)
+		if rec.Header().Get("X-Cache") != tt.expectedCache {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expectedCache, rec.Header().Get("X-Cache"))
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected the handler to run for 3 different responses, it ran %d times", calls)
+	}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	e := newCachedEcho(api.NewResponseCache(time.Minute, "line"), func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"line": c.QueryParam("line")})
+	})
+
+	// The cache holds 256 responses, the first one stays because it is used again
+	cachedRequest(e, "/recent?line=0", nil)
+	cachedRequest(e, "/recent?line=1", nil)
+	for i := 2; i <= 256; i++ {
+		cachedRequest(e, fmt.Sprintf("/recent?line=%d", i), nil)
+		cachedRequest(e, "/recent?line=0", nil)
+	}
+
+	if rec := cachedRequest(e, "/recent?line=256", nil); rec.Header().Get("X-Cache") != "HIT" {
+		t.Error("Expected the newest response to be cached, the full cache refused it")
+	}
+	if rec := cachedRequest(e, "/recent?line=0", nil); rec.Header().Get("X-Cache") != "HIT" {
+		t.Error("Expected the recently used response to stay cached")
+	}
+	if rec := cachedRequest(e, "/recent?line=1", nil); rec.Header().Get("X-Cache") != "MISS" {
+		t.Error("Expected the least recently used response to be dropped")
+	}
+}
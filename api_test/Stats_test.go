@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWeekStart(t *testing.T) {
+	// The weeks start at local midnight, which is the evening before in UTC
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() { time.Local = local }()
+
+	tests := []struct {
+		time     time.Time
+		expected time.Time
+	}{
+		{time.Date(2024, 5, 1, 18, 30, 0, 0, time.Local), time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local)},
+		{time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local), time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local)},
+		{time.Date(2024, 5, 5, 23, 59, 0, 0, time.Local), time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local)},
+		{time.Date(2024, 4, 28, 22, 30, 0, 0, time.UTC), time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local)},
+		{time.Date(2024, 5, 5, 22, 30, 0, 0, time.UTC), time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		if got := api.WeekStart(tt.time); !got.Equal(tt.expected) {
+			t.Errorf("WeekStart(%v) = %v; expected %v", tt.time, got, tt.expected)
+		}
+	}
+}
+
+func TestWeeklyTrends(t *testing.T) {
+	firstWeek := time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)
+	counts := map[time.Time]int{
+		firstWeek.AddDate(0, 0, -7): 10,
+		firstWeek:                   15,
+		firstWeek.AddDate(0, 0, 14): 4,
+	}
+
+	trends := api.WeeklyTrends(counts, firstWeek, 3)
+	if len(trends) != 3 {
+		t.Fatalf("WeeklyTrends returned %d weeks; expected 3", len(trends))
+	}
+
+	if trends[0].Count != 15 || trends[0].Change == nil || *trends[0].Change != 0.5 {
+		t.Errorf("First week is %+v; expected 15 reports, 50%% more than the week before", trends[0])
+	}
+	if trends[1].Count != 0 || trends[1].Change == nil || *trends[1].Change != -1 {
+		t.Errorf("Second week is %+v; expected no reports, 100%% less than the week before", trends[1])
+	}
+	// There is no change from a week without reports
+	if trends[2].Count != 4 || trends[2].Change != nil {
+		t.Errorf("Third week is %+v; expected 4 reports without change", trends[2])
+	}
+}
+
+func TestLineStats(t *testing.T) {
+	var matrix [7][24]int
+	matrix[1][8] = 5  // Monday 8:00
+	matrix[1][17] = 7 // Monday 17:00
+	matrix[5][17] = 3 // Friday 17:00
+	matrix[0][23] = 1 // Sunday 23:00
+
+	filter := structs.AggregationFilter{From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}
+	stations := []structs.StationCount{{Station: structs.Station{ID: "SU-A"}, Count: 10}, {Station: structs.Station{ID: "U-Hpu"}, Count: 6}}
+
+	stats := api.LineStats("U8", filter, stations, matrix)
+
+	if stats.Line != "U8" || !stats.From.Equal(filter.From) || !stats.To.Equal(filter.To) || len(stats.Stations) != 2 {
+		t.Errorf("Expected the line, period and stations of the request, got %+v", stats)
+	}
+	if stats.Count != 16 {
+		t.Errorf("Expected 16 reports in total, got %d", stats.Count)
+	}
+	if len(stats.Counts) != 7 || len(stats.Counts[0]) != 24 {
+		t.Fatalf("Expected 7 weekdays with 24 hours each, got %v", stats.Counts)
+	}
+	if stats.Counts[1][17] != 7 || stats.Counts[5][17] != 3 || stats.Counts[0][23] != 1 || stats.Counts[2][8] != 0 {
+		t.Errorf("Expected the counts by weekday and hour, got %v", stats.Counts)
+	}
+}
+
+func TestStatsValidation(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.GET("/stats/stations", api.GetTopStations)
+	e.GET("/stats/lines/:line", api.GetLineStats)
+	e.GET("/stats/trends", api.GetStatsTrends)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/stats/stations?limit=0", http.StatusUnprocessableEntity},
+		{"/stats/stations?weekdays=monday", http.StatusUnprocessableEntity},
+		{"/stats/lines/U99", http.StatusNotFound},
+		{"/stats/trends?weeks=0", http.StatusUnprocessableEntity},
+		{"/stats/trends?weeks=500", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.expectedStatus {
+			t.Errorf("GET %s returned %d; expected %d: %s", tt.path, rec.Code, tt.expectedStatus, rec.Body.String())
+		}
+	}
+}
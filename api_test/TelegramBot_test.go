@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/FreiFahren/backend/telegramtest"
+)
+
+func newTestTelegramBot(t *testing.T, stub *telegramtest.Server, sightings []structs.TicketInspector) *api.TelegramBot {
+	chdirToRepoRoot(t)
+	bot, err := api.NewTelegramBot(api.TelegramBotConfig{
+		APIURL:         stub.URL,
+		Token:          "123:test",
+		ReplyToReports: true,
+		Sightings: func(ctx context.Context, at time.Time) ([]structs.TicketInspector, error) {
+			// Messages are answered with the live sightings, like /recent without 'at'
+			if !at.IsZero() {
+				t.Errorf("Expected the zero time for the live sightings, got %v", at)
+			}
+			return sightings, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTelegramBot failed: %v", err)
+	}
+	return bot
+}
+
+func TestTelegramBotReplies(t *testing.T) {
+	now := time.Now()
+	sightings := []structs.TicketInspector{
+		{Timestamp: now, Station: structs.Station{ID: "SU-J", Name: "Jannowitzbrücke"}, Direction: structs.Station{ID: "SU-WIU", Name: "Wittenau"}, Line: "U8"},
+		{Timestamp: now, Station: structs.Station{ID: "U-Hpu", Name: "Hermannplatz"}, Line: "U7", IsHistoric: true},
+	}
+
+	stub := telegramtest.NewServer("123:test")
+	defer stub.Close()
+	bot := newTestTelegramBot(t, stub, sightings)
+
+	messages := []struct {
+		text     string
+		expected string
+	}{
+		{"/recent U8", "Jannowitzbrücke, U8 towards Wittenau"},
+		{"/recent@FreiFahrenBot U7", "No inspectors reported on U7"},
+		{"/recent U99", "Unknown line U99"},
+		{"/station Hermannplatz", "Lines: U7, U8"},
+		{"/station Nowhere", "No station found with the name Nowhere"},
+		{"/risk Alexanderplatz Kottbusser Tor", "U8: high risk, inspectors reported at"},
+		{"/risk Alexanderplatz", "Usage: /risk"},
+		{"U8 Hermannplatz Richtung Wittenau", "Resolved to Hermannplatz, U8 towards Wittenau"},
+	}
+
+	ids := map[int64]string{}
+	for _, message := range messages {
+		ids[stub.Send(42, message.text)] = message.expected
+	}
+	// Chatter without a station is not answered
+	stub.Send(42, "Danke!")
+
+	if err := bot.Poll(context.Background(), 0); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+
+	replies := stub.Replies()
+	if len(replies) != len(messages) {
+		t.Fatalf("Expected %d replies, got %d: %+v", len(messages), len(replies), replies)
+	}
+	for _, reply := range replies {
+		if reply.ChatID != 42 || !strings.Contains(reply.Text, ids[reply.ReplyToMessageID]) {
+			t.Errorf("Reply to %d should contain %q, got %q", reply.ReplyToMessageID, ids[reply.ReplyToMessageID], reply.Text)
+		}
+	}
+
+	// The handled messages are confirmed with the offset of the next poll
+	if err := bot.Poll(context.Background(), 0); err != nil {
+		t.Fatalf("Second poll failed: %v", err)
+	}
+	if len(stub.Replies()) != len(messages) {
+		t.Error("Messages were answered twice")
+	}
+}
+
+func TestTelegramBotUnavailable(t *testing.T) {
+	chdirToRepoRoot(t)
+	stub := telegramtest.NewServer("123:test")
+	defer stub.Close()
+
+	bot, err := api.NewTelegramBot(api.TelegramBotConfig{
+		APIURL: stub.URL,
+		Token:  "123:test",
+		Sightings: func(ctx context.Context, at time.Time) ([]structs.TicketInspector, error) {
+			return nil, errors.New("database down")
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTelegramBot failed: %v", err)
+	}
+
+	if reply := bot.Answer(context.Background(), "/recent", time.Now()); !strings.Contains(reply, "not available") {
+		t.Errorf("Unexpected reply without database: %q", reply)
+	}
+
+	wrongToken, _ := api.NewTelegramBot(api.TelegramBotConfig{APIURL: stub.URL, Token: "456:wrong"})
+	if err := wrongToken.Poll(context.Background(), 0); err == nil {
+		t.Error("Expected an error for a token the Bot API doesn't know")
+	}
+}
+
+func TestRouteRisks(t *testing.T) {
+	lines := map[string][]string{"U8": {"SU-A", "SU-J", "U-He", "U-Mr", "U-Kbo", "U-Hpu"}}
+	historic := structs.TicketInspector{Station: structs.Station{ID: "U-Mr"}, IsHistoric: true}
+	reported := structs.TicketInspector{Station: structs.Station{ID: "SU-J"}, Line: "U8"}
+	elsewhere := structs.TicketInspector{Station: structs.Station{ID: "U-Hpu"}, Line: "U8"}
+
+	tests := []struct {
+		name      string
+		sightings []structs.TicketInspector
+		expected  string
+	}{
+		{"No sightings", nil, "low"},
+		{"Only after the destination", []structs.TicketInspector{elsewhere}, "low"},
+		{"Often checked", []structs.TicketInspector{historic}, "medium"},
+		{"Reported on the way", []structs.TicketInspector{historic, reported}, "high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The direction of the trip doesn't matter
+			risks := api.RouteRisks("U-Kbo", "SU-A", lines, tt.sightings)
+			if len(risks) != 1 || risks[0].Risk != tt.expected {
+				t.Errorf("RouteRisks() = %+v; expected %s risk", risks, tt.expected)
+			}
+		})
+	}
+
+	if risks := api.RouteRisks("SU-A", "U-S", lines, nil); len(risks) != 0 {
+		t.Errorf("Expected no route for stations without a common line, got %+v", risks)
+	}
+}
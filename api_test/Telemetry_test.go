@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/telemetry"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{" error ", slog.LevelError},
+		{"", slog.LevelInfo},
+		{"verbose", slog.LevelInfo},
+	}
+
+	for _, test := range tests {
+		if level := telemetry.ParseLevel(test.value); level != test.expected {
+			t.Errorf("ParseLevel(%q) = %v, expected %v", test.value, level, test.expected)
+		}
+	}
+}
+
+func TestLogHandlerAddsRequestAndTrace(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(telemetry.NewLogHandler(slog.NewJSONHandler(&output, nil)))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	ctx = telemetry.WithRequestID(ctx, "request-1")
+
+	logger.With("component", "test").InfoContext(ctx, "Hello")
+
+	var record map[string]any
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode the log line %q: %v", output.String(), err)
+	}
+	expected := map[string]string{
+		"request_id": "request-1",
+		"trace_id":   traceID.String(),
+		"span_id":    spanID.String(),
+		"component":  "test",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected %s to be %q, got %v", key, value, record[key])
+		}
+	}
+
+	output.Reset()
+	logger.Info("Outside of a request")
+	if bytes.Contains(output.Bytes(), []byte("request_id")) {
+		t.Errorf("Expected no request id outside of a request, got %s", output.String())
+	}
+}
+
+func TestTracePropagatesRequestID(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.RequestID(), api.Trace)
+
+	var requestID string
+	e.GET("/recent", func(c echo.Context) error {
+		requestID = telemetry.RequestID(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recent", nil))
+
+	if requestID == "" {
+		t.Fatal("Expected the request id in the context of the handler")
+	}
+	if header := rec.Header().Get(echo.HeaderXRequestID); header != requestID {
+		t.Errorf("Expected the request id %q of the response, got %q", header, requestID)
+	}
+
+	// The id of the client is kept
+	req := httptest.NewRequest(http.MethodGet, "/recent", nil)
+	req.Header.Set(echo.HeaderXRequestID, "client-id")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	if requestID != "client-id" {
+		t.Errorf("Expected the request id of the client, got %q", requestID)
+	}
+}
@@ -0,0 +1,66 @@
+package api_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+)
+
+func TestVerifyChallenge(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Now()
+
+	challenge, _, err := api.NewChallenge(secret, now)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		secret      []byte
+		challenge   string
+		time        time.Time
+		expectError bool
+	}{
+		{"Valid challenge", secret, challenge, now, false},
+		{"Expired challenge", secret, challenge, now.Add(time.Hour), true},
+		{"Wrong secret", []byte("other-secret"), challenge, now, true},
+		{"Tampered challenge", secret, "00" + challenge, now, true},
+		{"Empty challenge", secret, "", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := api.VerifyChallenge(tt.secret, tt.challenge, tt.time)
+			if (err != nil) != tt.expectError {
+				t.Errorf("VerifyChallenge(%s) = %v; expected error: %t", tt.challenge, err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestSolvesProofOfWork(t *testing.T) {
+	challenge := "abc.123.def"
+	difficulty := 8
+
+	// Brute force a solution, 8 bits take 256 attempts on average
+	solution := ""
+	for i := 0; i < 1<<16; i++ {
+		if api.SolvesProofOfWork(challenge, strconv.Itoa(i), difficulty) {
+			solution = strconv.Itoa(i)
+			break
+		}
+	}
+	if solution == "" {
+		t.Fatalf("Failed to find a solution for difficulty %d", difficulty)
+	}
+
+	if api.SolvesProofOfWork(challenge, "", difficulty) {
+		t.Errorf("Empty solution should not be accepted")
+	}
+	if api.SolvesProofOfWork(challenge, solution, 256) {
+		t.Errorf("Solution %s should not satisfy difficulty 256", solution)
+	}
+}
@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"line":"U8"}`)
+	now := time.Now()
+	signature := api.SignWebhook(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      []byte
+		now       time.Time
+		valid     bool
+	}{
+		{"Valid", secret, signature, body, now, true},
+		{"Other secret", "whsec_other", signature, body, now, false},
+		{"Changed body", secret, signature, []byte(`{"line":"U7"}`), now, false},
+		{"Replayed later", secret, signature, body, now.Add(api.WebhookSignatureTolerance + time.Minute), false},
+		{"Malformed", secret, "v1=abc", body, now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := api.VerifyWebhookSignature(tt.secret, tt.signature, tt.body, tt.now)
+			if (err == nil) != tt.valid {
+				t.Errorf("VerifyWebhookSignature() returned %v; expected valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	sighting := structs.TicketInspector{Station: structs.Station{ID: "SU-A", Name: "Alexanderplatz"}, Line: "U8"}
+	body, _ := json.Marshal(sighting)
+	const secret = "whsec_test"
+
+	tests := []struct {
+		name             string
+		statuses         []int
+		expectedAttempts int
+		expectSuccess    bool
+	}{
+		{"Delivered right away", []int{http.StatusNoContent}, 1, true},
+		{"Retried after server errors", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, true},
+		{"Client errors are not retried", []int{http.StatusBadRequest}, 1, false},
+		{"Gives up after the last attempt", []int{500, 500, 500, 500}, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := io.ReadAll(r.Body)
+				if err := api.VerifyWebhookSignature(secret, r.Header.Get(api.WebhookSignatureHeader), received, time.Now()); err != nil {
+					t.Errorf("Invalid signature: %v", err)
+				}
+				if r.Header.Get(api.WebhookEventHeader) != structs.WebhookEventSighting || r.Header.Get(api.WebhookDeliveryHeader) != "delivery-1" {
+					t.Errorf("Unexpected headers: %v", r.Header)
+				}
+
+				mu.Lock()
+				status := tt.statuses[min(requests, len(tt.statuses)-1)]
+				requests++
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			dispatcher := api.NewWebhookDispatcher(http.DefaultClient, 4, time.Millisecond)
+			webhook := structs.Webhook{ID: "webhook-1", URL: server.URL, Secret: secret}
+
+			var deliveries []structs.WebhookDelivery
+			attempts, err := dispatcher.Send(webhook, "delivery-1", body, func(delivery structs.WebhookDelivery) {
+				deliveries = append(deliveries, delivery)
+			})
+
+			if (err == nil) != tt.expectSuccess {
+				t.Errorf("Send() returned %v; expected success = %v", err, tt.expectSuccess)
+			}
+			if attempts != tt.expectedAttempts || len(deliveries) != tt.expectedAttempts {
+				t.Fatalf("Expected %d attempts, got %d with %d logged deliveries", tt.expectedAttempts, attempts, len(deliveries))
+			}
+			last := deliveries[len(deliveries)-1]
+			if last.Attempt != attempts || last.StatusCode == nil || *last.StatusCode != tt.statuses[min(attempts, len(tt.statuses))-1] {
+				t.Errorf("Unexpected last delivery: %+v", last)
+			}
+			if (last.Error == nil) != tt.expectSuccess {
+				t.Errorf("Expected the error of the last delivery to be logged: %+v", last)
+			}
+		})
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	chdirToRepoRoot(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	setPartner := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("role", structs.RolePartner)
+			return next(c)
+		}
+	}
+	e.POST("/webhooks", api.CreateWebhook, setPartner)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Invalid url", `{"url":"not a url"}`},
+		{"Plain http", `{"url":"http://partner.example.com/hook"}`},
+		{"Loopback address", `{"url":"https://127.0.0.1/hook"}`},
+		{"Private address", `{"url":"https://10.0.0.1:8443/hook"}`},
+		{"Unknown city", `{"url":"https://partner.example.com/hook","city":"hamburg"}`},
+		{"Unknown station", `{"url":"https://partner.example.com/hook","stations":["U-Nowhere"]}`},
+		{"Unknown line", `{"url":"https://partner.example.com/hook","lines":["U99"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("POST /webhooks returned %d; expected %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/database"
+)
+
+// Run executes a management command instead of starting the server,
+// e.g. `go run main.go keys list`
+func Run(args []string) error {
+	switch args[0] {
+	case "keys", "export", "import":
+		// These commands work on the tables of the database, the in-memory store only keeps the reports
+		if _, inMemory := api.Reports.(*database.MemoryStore); inMemory {
+			return fmt.Errorf("the %s command needs the database, unset REPORTS_STORE=memory to run it", args[0])
+		}
+	}
+
+	switch args[0] {
+	case "keys":
+		return Keys(args[1:])
+	case "export":
+		return Export(args[1:])
+	case "import":
+		return Import(args[1:])
+	case "vapid":
+		return Vapid(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, available commands: keys, export, import, vapid", args[0])
+	}
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+const exportUsage = `usage:
+  export [-format <csv|jsonl|parquet>] [-from <RFC3339>] [-to <RFC3339>] [-anonymized=false] [-output <file>]`
+
+// Export writes the reports to a file or stdout, anonymized unless -anonymized=false is given
+func Export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", api.ExportFormatCSV, "csv, jsonl or parquet")
+	from := flags.String("from", "", "only export reports since this time")
+	to := flags.String("to", "", "only export reports until this time")
+	anonymized := flags.Bool("anonymized", true, "leave out the message and the author")
+	output := flags.String("output", "", "file to write to, stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !api.IsValidExportFormat(*format) || flags.NArg() > 0 {
+		return errors.New(exportUsage)
+	}
+
+	var filter structs.AggregationFilter
+	var err error
+	if filter.From, err = parseOptionalTime(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if filter.To, err = parseOptionalTime(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	file := os.Stdout
+	if *output != "" {
+		if file, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer file.Close()
+	}
+
+	if err := api.ExportReports(context.Background(), file, *format, filter, *anonymized); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported the reports to %s\n", *output)
+	}
+	return nil
+}
+
+// parseOptionalTime parses an RFC3339 time in local time, like the reports are stored
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.Local(), err
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+const importUsage = `usage:
+  import [-rejects <file>] <result.json|file.csv>...`
+
+// Import reads historical reports from Telegram chat exports (.json) and CSV files.
+// Messages and rows without a known station are written to the rejects file.
+func Import(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	rejectsPath := flags.String("rejects", "import_rejects.csv", "file for the messages and rows that couldn't be imported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New(importUsage)
+	}
+
+	stations, err := api.ReadFromFile("data/StationsList.json")
+	if err != nil {
+		return fmt.Errorf("failed to read the stations: %w", err)
+	}
+	lines, err := api.ReadLinesList("data/LinesList.json")
+	if err != nil {
+		return fmt.Errorf("failed to read the lines: %w", err)
+	}
+	importer := api.NewImporter(stations, lines)
+
+	var rejects []structs.ImportReject
+	for _, path := range flags.Args() {
+		records, fileRejects, err := parseImportFile(importer, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		inserted, err := database.ImportTicketInfo(context.Background(), records)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		fmt.Printf("%s: imported %d reports, %d were already imported, %d rejected\n", path, inserted, len(records)-inserted, len(fileRejects))
+		rejects = append(rejects, fileRejects...)
+	}
+
+	if len(rejects) > 0 {
+		if err := writeRejects(*rejectsPath, rejects); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d rejected messages and rows to %s\n", len(rejects), *rejectsPath)
+	}
+
+	// Include the imported reports in the statistics right away
+	return database.RefreshStatsViews(context.Background())
+}
+
+func parseImportFile(importer *api.Importer, path string) ([]structs.ImportRecord, []structs.ImportReject, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return importer.ParseTelegramExport(path, file)
+	case ".csv":
+		return importer.ParseCSV(path, file)
+	default:
+		return nil, nil, errors.New("only Telegram exports (.json) and CSV files can be imported")
+	}
+}
+
+func writeRejects(path string, rejects []structs.ImportReject) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"file", "reference", "reason", "raw"})
+	for _, reject := range rejects {
+		writer.Write([]string{reject.File, reject.Reference, reject.Reason, reject.Raw})
+	}
+	writer.Flush()
+	return writer.Error()
+}
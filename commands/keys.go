@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+)
+
+const keysUsage = `usage:
+  keys create -name <name> -role <reporter|partner|admin> [-quota <requests per day>]
+  keys list
+  keys revoke <id>
+  keys quota <id> <requests per day, 0 for unlimited>`
+
+// Keys manages the api keys of the Telegram bot, partner apps and admins
+func Keys(args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createKey(args[1:])
+	case "list":
+		return listKeys()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		if err := database.RevokeApiKey(context.Background(), args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked api key %s\n", args[1])
+		return nil
+	case "quota":
+		if len(args) != 3 {
+			return errors.New(keysUsage)
+		}
+		quota, err := strconv.Atoi(args[2])
+		if err != nil || quota < 0 {
+			return fmt.Errorf("quota must be a number >= 0")
+		}
+		if err := database.SetApiKeyQuota(context.Background(), args[1], quota); err != nil {
+			return err
+		}
+		fmt.Printf("Set quota of api key %s to %d requests per day\n", args[1], quota)
+		return nil
+	default:
+		return errors.New(keysUsage)
+	}
+}
+
+func createKey(args []string) error {
+	flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the app or person using the key")
+	role := flags.String("role", "", "role of the key")
+	quota := flags.Int("quota", 0, "requests per day, 0 for unlimited")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" || !api.IsValidRole(*role) || *role == structs.RolePublic || *quota < 0 {
+		return errors.New(keysUsage)
+	}
+
+	key, hash, err := api.GenerateApiKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	apiKey, err := database.InsertApiKey(context.Background(), *name, hash, *role, *quota)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created api key %s for %s with role %s\n", apiKey.ID, apiKey.Name, apiKey.Role)
+	fmt.Printf("Key (only shown once): %s\n", key)
+	return nil
+}
+
+func listKeys() error {
+	apiKeys, err := database.ListApiKeys(context.Background())
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tNAME\tROLE\tQUOTA\tCREATED\tREVOKED")
+	for _, apiKey := range apiKeys {
+		revoked := ""
+		if apiKey.RevokedAt != nil {
+			revoked = apiKey.RevokedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			apiKey.ID, apiKey.Name, apiKey.Role, apiKey.QuotaPerDay, apiKey.CreatedAt.Format(time.DateTime), revoked)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SherClockHolmes/webpush-go"
+)
+
+// Vapid generates the key pair identifying the server to the Web Push services
+func Vapid(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage:\n  vapid")
+	}
+
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return fmt.Errorf("failed to generate the VAPID keys: %w", err)
+	}
+
+	fmt.Println("Add the keys to the .env file, changing them invalidates all Web Push subscriptions:")
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\n", publicKey)
+	fmt.Printf("VAPID_PRIVATE_KEY=%s\n", privateKey)
+	fmt.Println("VAPID_SUBJECT=mailto:<contact of the operator>")
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	types "github.com/FreiFahren/backend/structs"
+)
+
+// Columns the reports can be grouped by
+const (
+	GroupByStation = "station_id"
+	GroupByLine    = "line"
+)
+
+// CountReports counts the visible reports matching the filter per station or line, largest counts first
+func CountReports(ctx context.Context, groupBy string, filter types.AggregationFilter) ([]types.ReportCount, error) {
+	if groupBy != GroupByStation && groupBy != GroupByLine {
+		return nil, fmt.Errorf("can't group reports by %q", groupBy)
+	}
+
+	conditions, args := filterConditions(filter, "timestamp")
+	conditions = append(conditions, "NOT quarantined", "hidden_at IS NULL", groupBy+" IS NOT NULL")
+
+	limit := "ALL"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		limit = fmt.Sprintf("$%d", len(args))
+	}
+
+	sql := fmt.Sprintf(`SELECT %[1]s, COUNT(*)
+		FROM ticket_info
+		WHERE %[2]s
+		GROUP BY %[1]s
+		ORDER BY COUNT(*) DESC, %[1]s
+		LIMIT %[3]s;`, groupBy, strings.Join(conditions, " AND "), limit)
+
+	return queryReportCounts(ctx, sql, args...)
+}
+
+// queryReportCounts runs a query selecting a key and a count
+func queryReportCounts(ctx context.Context, sql string, args ...interface{}) ([]types.ReportCount, error) {
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []types.ReportCount{}
+	for rows.Next() {
+		var count types.ReportCount
+		if err := rows.Scan(&count.Key, &count.Count); err != nil {
+			return nil, fmt.Errorf("error scanning row (report counts): %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (report counts): %w", err)
+	}
+
+	return counts, nil
+}
+
+// filterConditions turns the filter into SQL conditions on the given time column
+func filterConditions(filter types.AggregationFilter, timeColumn string) ([]string, []interface{}) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !filter.From.IsZero() {
+		addCondition(timeColumn+" >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition(timeColumn+" <= $%d", filter.To)
+	}
+	if len(filter.Hours) > 0 {
+		addCondition("EXTRACT(HOUR FROM "+timeColumn+")::int = ANY($%d)", filter.Hours)
+	}
+	if len(filter.Weekdays) > 0 {
+		addCondition("EXTRACT(DOW FROM "+timeColumn+")::int = ANY($%d)", filter.Weekdays)
+	}
+	if len(filter.Lines) > 0 {
+		addCondition("line = ANY($%d)", filter.Lines)
+	}
+	if len(filter.StationIDs) > 0 {
+		addCondition("station_id = ANY($%d)", filter.StationIDs)
+	}
+
+	return conditions, args
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrApiKeyNotFound = errors.New("api key not found")
+
+func CreateApiKeysTable() {
+	sql := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		key_hash CHAR(64) NOT NULL UNIQUE,
+		role VARCHAR(16) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		revoked_at TIMESTAMP
+	);
+
+	ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS quota_per_day INTEGER NOT NULL DEFAULT 0;
+	`
+
+	_, err := pool.Exec(context.Background(), sql)
+	if err != nil {
+		slog.Error("Failed to create api keys table", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Api keys table created or already exists")
+}
+
+// InsertApiKey stores a new key, only the hash of the key itself is saved
+func InsertApiKey(ctx context.Context, name, keyHash, role string, quotaPerDay int) (types.ApiKey, error) {
+	sql := `
+	INSERT INTO api_keys (name, key_hash, role, quota_per_day)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id::text, name, role, quota_per_day, created_at, revoked_at;
+	`
+
+	apiKey, err := scanApiKey(queryRow(ctx, sql, name, keyHash, role, quotaPerDay))
+	if err != nil {
+		return types.ApiKey{}, fmt.Errorf("failed to insert api key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// GetApiKeyByHash returns the key with the given hash, as long as it hasn't been revoked
+func GetApiKeyByHash(ctx context.Context, keyHash string) (types.ApiKey, error) {
+	sql := `
+	SELECT id::text, name, role, quota_per_day, created_at, revoked_at
+	FROM api_keys
+	WHERE key_hash = $1 AND revoked_at IS NULL;
+	`
+
+	apiKey, err := scanApiKey(queryRow(ctx, sql, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ApiKey{}, ErrApiKeyNotFound
+	}
+	if err != nil {
+		return types.ApiKey{}, fmt.Errorf("query execution error: %w", err)
+	}
+	return apiKey, nil
+}
+
+func ListApiKeys(ctx context.Context) ([]types.ApiKey, error) {
+	sql := `
+	SELECT id::text, name, role, quota_per_day, created_at, revoked_at
+	FROM api_keys
+	ORDER BY created_at;
+	`
+
+	rows, err := query(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	apiKeys := []types.ApiKey{}
+	for rows.Next() {
+		apiKey, err := scanApiKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row (api keys): %w", err)
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (api keys): %w", err)
+	}
+
+	return apiKeys, nil
+}
+
+func RevokeApiKey(ctx context.Context, id string) error {
+	sql := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1::uuid AND revoked_at IS NULL;`
+	return updateApiKey(ctx, sql, id)
+}
+
+// SetApiKeyQuota changes the number of requests per day, 0 means unlimited
+func SetApiKeyQuota(ctx context.Context, id string, quotaPerDay int) error {
+	sql := `UPDATE api_keys SET quota_per_day = $2 WHERE id = $1::uuid;`
+	return updateApiKey(ctx, sql, id, quotaPerDay)
+}
+
+func updateApiKey(ctx context.Context, sql, id string, args ...interface{}) error {
+	result, err := exec(ctx, sql, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func scanApiKey(row pgx.Row) (types.ApiKey, error) {
+	var apiKey types.ApiKey
+	err := row.Scan(&apiKey.ID, &apiKey.Name, &apiKey.Role, &apiKey.QuotaPerDay, &apiKey.CreatedAt, &apiKey.RevokedAt)
+	return apiKey, err
+}
@@ -2,18 +2,45 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	types "github.com/FreiFahren/backend/structs"
+	"github.com/FreiFahren/backend/telemetry"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var pool *pgxpool.Pool
 
+// Defaults of DB_QUERY_TIMEOUT, DB_ACQUIRE_TIMEOUT and DB_EXPORT_TIMEOUT
+const (
+	defaultQueryTimeout   = 5 * time.Second
+	defaultAcquireTimeout = 2 * time.Second
+	defaultExportTimeout  = 10 * time.Minute
+)
+
+var (
+	// queryTimeout bounds every call of the package, including waiting for a connection
+	queryTimeout = defaultQueryTimeout
+	// acquireTimeout is how long a call waits for a free connection before giving up with ErrPoolExhausted
+	acquireTimeout = defaultAcquireTimeout
+	// exportTimeout bounds an export, which holds its connection until the last report is written
+	exportTimeout = defaultExportTimeout
+)
+
+// ErrPoolExhausted is returned when all connections stayed in use for the acquire timeout,
+// retrying a little later usually succeeds
+var ErrPoolExhausted = errors.New("all database connections are in use")
+
+var errNoPool = errors.New("no database connection pool")
+
 func Config() *pgxpool.Config {
 	const defaultMaxConns = int32(4)
 	const defaultMinConns = int32(0)
@@ -31,7 +58,8 @@ func Config() *pgxpool.Config {
 
 	dbConfig, err := pgxpool.ParseConfig(dbUrl)
 	if err != nil {
-		log.Fatal("Failed to create a config, error: ", err)
+		slog.Error("Failed to create a config", "error", err)
+		os.Exit(1)
 	}
 
 	dbConfig.MaxConns = defaultMaxConns
@@ -41,6 +69,9 @@ func Config() *pgxpool.Config {
 	dbConfig.HealthCheckPeriod = defaultHealthCheckPeriod
 	dbConfig.ConnConfig.ConnectTimeout = defaultConnectTimeout
 
+	// Every query gets a span and a debug log line with the request id of its context
+	dbConfig.ConnConfig.Tracer = telemetry.QueryTracer{}
+
 	dbConfig.BeforeAcquire = func(ctx context.Context, c *pgx.Conn) bool {
 		return true
 	}
@@ -60,18 +91,162 @@ func CreatePool() {
 
 	p, err := pgxpool.NewWithConfig(context.Background(), Config())
 	if err != nil {
-		log.Fatal("Error while creating connection to the database!!")
+		slog.Error("Error while creating connection to the database", "error", err)
+		os.Exit(1)
 	}
 
 	pool = p
 
+	queryTimeout = envDuration("DB_QUERY_TIMEOUT", defaultQueryTimeout)
+	acquireTimeout = envDuration("DB_ACQUIRE_TIMEOUT", defaultAcquireTimeout)
+	exportTimeout = envDuration("DB_EXPORT_TIMEOUT", defaultExportTimeout)
 }
+
+// envDuration reads a duration like "500ms" or "5s", the fallback is used if it is missing or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("Invalid duration, using the default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return duration
+}
+
 func ClosePool() {
 	if pool != nil {
 		pool.Close()
 	}
 }
 
+// PoolStats returns the statistics of the connection pool, nil if there is no pool
+func PoolStats() *pgxpool.Stat {
+	if pool == nil {
+		return nil
+	}
+	return pool.Stat()
+}
+
+// Ping checks that a connection to the database can be acquired and used
+func Ping(ctx context.Context) error {
+	if pool == nil {
+		return errNoPool
+	}
+	return pool.Ping(ctx)
+}
+
+// acquire takes a connection from the pool, the returned context is bounded by the timeout unless it is 0.
+// release has to be called once the results have been read.
+func acquire(ctx context.Context, timeout time.Duration) (conn *pgxpool.Conn, queryCtx context.Context, release func(), err error) {
+	if pool == nil {
+		return nil, ctx, nil, errNoPool
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	acquireCtx, cancelAcquire := context.WithTimeout(ctx, acquireTimeout)
+	defer cancelAcquire()
+
+	conn, err = pool.Acquire(acquireCtx)
+	if err != nil {
+		cancel()
+		// Only the acquire timeout ran out while every connection was busy, not the caller's context or the connect
+		stat := pool.Stat()
+		if ctx.Err() == nil && errors.Is(acquireCtx.Err(), context.DeadlineExceeded) && stat.AcquiredConns() >= stat.MaxConns() {
+			return nil, ctx, nil, ErrPoolExhausted
+		}
+		return nil, ctx, nil, err
+	}
+
+	return conn, ctx, func() {
+		conn.Release()
+		cancel()
+	}, nil
+}
+
+// query runs a query bounded by the query timeout, the connection is released when the rows are closed
+func query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	conn, ctx, release, err := acquire(ctx, queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &releasingRows{Rows: rows, release: release}, nil
+}
+
+// queryRow runs a query returning a single row bounded by the query timeout, the connection is released by Scan
+func queryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	conn, ctx, release, err := acquire(ctx, queryTimeout)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return &releasingRow{Row: conn.QueryRow(ctx, sql, args...), release: release}
+}
+
+// exec runs a statement bounded by the query timeout
+func exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	conn, ctx, release, err := acquire(ctx, queryTimeout)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer release()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// inTx runs the function in a transaction bounded by the query timeout, it is committed if the function returns nil
+func inTx(ctx context.Context, f func(ctx context.Context, tx pgx.Tx) error) error {
+	conn, ctx, release, err := acquire(ctx, queryTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		return f(ctx, tx)
+	})
+}
+
+type releasingRows struct {
+	pgx.Rows
+	release func()
+	once    sync.Once
+}
+
+func (r *releasingRows) Close() {
+	r.Rows.Close()
+	r.once.Do(r.release)
+}
+
+type releasingRow struct {
+	pgx.Row
+	release func()
+}
+
+func (r *releasingRow) Scan(dest ...any) error {
+	defer r.release()
+	return r.Row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
 func CreateTicketInfoTable() {
 	sql := `
 	CREATE TABLE IF NOT EXISTS ticket_info (
@@ -85,113 +260,134 @@ func CreateTicketInfoTable() {
 		direction_name VARCHAR(255),
 		direction_id VARCHAR(10)
 	);
+
+	-- Reports flagged by the abuse protection stay out of /recent until reviewed
+	ALTER TABLE ticket_info ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT FALSE;
+
+	-- Imported reports keep the hash of their source, so an import can be repeated without duplicates
+	ALTER TABLE ticket_info ADD COLUMN IF NOT EXISTS source_hash VARCHAR(64);
+	CREATE UNIQUE INDEX IF NOT EXISTS ticket_info_source_hash ON ticket_info (source_hash);
 	`
 
 	_, err := pool.Exec(context.Background(), sql)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create table: %v\n", err)
+		slog.Error("Failed to create table", "error", err)
 		os.Exit(1)
 	}
-	fmt.Println("Table created or already exists.")
+	slog.Info("Table created or already exists")
 }
 
-func InsertTicketInfo(timestamp *time.Time, message *string, author *int64, line, stationName, stationId, directionName, directionId *string) error {
+func InsertTicketInfo(ctx context.Context, timestamp *time.Time, message *string, author *int64, line, stationName, stationId, directionName, directionId, reporterId *string, quarantined bool) error {
 
 	sql := `
-    INSERT INTO ticket_info (timestamp, message, author, line, station_name, station_id, direction_name, direction_id)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+    INSERT INTO ticket_info (timestamp, message, author, line, station_name, station_id, direction_name, direction_id, reporter_id, quarantined)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
     `
 
 	// Convert *string and *int64 directly to interface{} for pgx
-	values := []interface{}{timestamp, message, author, line, stationName, stationId, directionName, directionId}
-
-	_, err := pool.Exec(context.Background(), sql, values...)
-	log.Println("Inserting ticket info...")
+	values := []interface{}{timestamp, message, author, line, stationName, stationId, directionName, directionId, reporterId, quarantined}
 
+	_, err := exec(ctx, sql, values...)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to insert ticket info: %v\n", err)
+		slog.ErrorContext(ctx, "Failed to insert ticket info", "error", err)
 		return err
 	}
 	return nil
 }
 
-func GetHistoricStations(timestamp time.Time) ([]types.TicketInfo, error) {
+// GetHistoricStations returns the stations with the most reports at the hour and weekday of the timestamp,
+// only counting the reports up to the timestamp, so past maps can be replayed
+func GetHistoricStations(ctx context.Context, timestamp time.Time) ([]types.TicketInfo, error) {
 	// Extract hour and weekday
 	hour := timestamp.Hour()
 	weekday := timestamp.Weekday()
 
-	// get top 5 stations for the given hour and weekday
-	sql := `
-        SELECT station_id
-        FROM ticket_info
-        WHERE EXTRACT(HOUR FROM timestamp) = $1 AND EXTRACT(DOW FROM timestamp) = $2
-		AND station_name IS NOT NULL
-		AND station_id IS NOT NULL
-        GROUP BY station_id
-        ORDER BY COUNT(station_id) DESC
-        LIMIT 20;
-    `
-
 	sqlTimestamp := `
 		SELECT MAX(timestamp) 
-		FROM ticket_info;
+		FROM ticket_info
+		WHERE timestamp <= $1 AND NOT quarantined AND hidden_at IS NULL;
 	`
-	lastTimestampRow, err := pool.Query(context.Background(), sqlTimestamp)
-	if err != nil {
+	var lastReport *time.Time
+	if err := queryRow(ctx, sqlTimestamp, timestamp).Scan(&lastReport); err != nil {
 		return nil, fmt.Errorf("query execution error: %w", err)
 	}
-	defer lastTimestampRow.Close()
 
-	var lastNonHistoricTimestamp time.Time
-	for lastTimestampRow.Next() {
-		err := lastTimestampRow.Scan(&lastNonHistoricTimestamp)
-		if err != nil {
-			log.Fatalf("Failed to scan timestamp: %v", err)
-		}
+	// There are no reports before timestamps far in the past
+	if lastReport == nil {
+		return nil, nil
 	}
-
-	// Execute query
-	rows, err := pool.Query(context.Background(), sql, hour, weekday)
+	lastNonHistoricTimestamp := *lastReport
+
+	// get the top 20 stations for the given hour and weekday
+	counts, err := CountReports(ctx, GroupByStation, types.AggregationFilter{
+		Hours:    []int{hour},
+		Weekdays: []int{int(weekday)},
+		To:       timestamp,
+		Limit:    20,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("query execution error: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
 	var ticketInfoList []types.TicketInfo
-
-	for rows.Next() {
-		var ticketInfo types.TicketInfo
-
-		if err := rows.Scan(&ticketInfo.Station_ID); err != nil {
-			return nil, fmt.Errorf("error scanning row (historic data): %w", err)
-		}
-
-		ticketInfo.Timestamp = lastNonHistoricTimestamp
-		ticketInfo.IsHistoric = true
-		ticketInfoList = append(ticketInfoList, ticketInfo)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows (historic data): %w", err)
+	for _, count := range counts {
+		ticketInfoList = append(ticketInfoList, types.TicketInfo{
+			Station_ID: count.Key,
+			Timestamp:  lastNonHistoricTimestamp,
+			IsHistoric: true,
+		})
 	}
 
 	if len(ticketInfoList) == 0 {
-		fmt.Println("No historic data found")
+		slog.DebugContext(ctx, "No historic data found", "hour", hour, "weekday", weekday)
 	}
 
 	return ticketInfoList, nil
 }
 
-func GetLatestStationCoordinates() ([]types.TicketInfo, error) {
+func GetLatestStationCoordinates(ctx context.Context) ([]types.TicketInfo, error) {
+	// The clock of the database decides, like for the timestamps of new reports
 	sql := `SELECT timestamp, station_id, direction_id, line
             FROM ticket_info
             WHERE timestamp >= NOW() - INTERVAL '15 minutes'
             AND station_name IS NOT NULL
-			AND station_id IS NOT NULL;`
+			AND station_id IS NOT NULL
+			AND NOT quarantined
+			AND hidden_at IS NULL;`
 
-	rows, err := pool.Query(context.Background(), sql)
-	log.Println("Getting recent station coordinates...")
+	return queryStationCoordinates(ctx, sql)
+}
 
+// GetStationCoordinatesAt returns the reports of the 15 minutes before the given time, to replay the past
+func GetStationCoordinatesAt(ctx context.Context, at time.Time) ([]types.TicketInfo, error) {
+	sql := `SELECT timestamp, station_id, direction_id, line
+            FROM ticket_info
+            WHERE timestamp >= $1::timestamp - INTERVAL '15 minutes'
+            AND timestamp <= $1
+            AND station_name IS NOT NULL
+			AND station_id IS NOT NULL
+			AND NOT quarantined
+			AND hidden_at IS NULL;`
+
+	return queryStationCoordinates(ctx, sql, at)
+}
+
+// GetLatestSightings returns the latest visible reports with a station, newest first
+func GetLatestSightings(ctx context.Context, limit int) ([]types.TicketInfo, error) {
+	sql := `SELECT timestamp, station_id, direction_id, line
+            FROM ticket_info
+            WHERE station_name IS NOT NULL
+			AND station_id IS NOT NULL
+			AND NOT quarantined
+			AND hidden_at IS NULL
+			ORDER BY timestamp DESC, id DESC
+			LIMIT $1;`
+
+	return queryStationCoordinates(ctx, sql, limit)
+}
+
+func queryStationCoordinates(ctx context.Context, sql string, args ...interface{}) ([]types.TicketInfo, error) {
+	rows, err := query(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query execution error: %w", err)
 	}
@@ -216,16 +412,63 @@ func GetLatestStationCoordinates() ([]types.TicketInfo, error) {
 	return ticketInfoList, nil
 }
 
-func GetLatestUpdateTime() (time.Time, error) {
-	var lastUpdateTime time.Time
+// GetLatestUpdateTime returns when the visible reports of the last 15 minutes last changed,
+// by a new report, by moderation or by a report leaving the 15 minutes. It is zero if there are no reports.
+func GetLatestUpdateTime(ctx context.Context) (time.Time, error) {
+	var lastUpdateTime *time.Time
 
-	sql := `SELECT MAX(timestamp) FROM ticket_info;`
+	// Hiding, restoring and approving a report is logged with the time of the action
+	sql := `SELECT GREATEST(
+		(SELECT MAX(timestamp) FROM ticket_info WHERE NOT quarantined AND hidden_at IS NULL),
+		(SELECT MAX(timestamp) + INTERVAL '15 minutes' FROM ticket_info
+			WHERE NOT quarantined AND hidden_at IS NULL AND timestamp < NOW() - INTERVAL '15 minutes'),
+		(SELECT MAX(timestamp) FROM moderation_log WHERE report_id IS NOT NULL)
+	);`
 
-	err := pool.QueryRow(context.Background(), sql).Scan(&lastUpdateTime)
+	err := queryRow(ctx, sql).Scan(&lastUpdateTime)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get latest update time: %v\n", err)
+		slog.ErrorContext(ctx, "Failed to get latest update time", "error", err)
 		return time.Time{}, err
 	}
+	if lastUpdateTime == nil {
+		return time.Time{}, nil
+	}
+
+	// The reports are stored in local time without a zone
+	t := *lastUpdateTime
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local), nil
+}
+
+// ListSightings returns the visible reports with a station matching the filter, oldest first
+func ListSightings(ctx context.Context, filter types.AggregationFilter, offset int) ([]types.TicketInfo, error) {
+	conditions, args := filterConditions(filter, "timestamp")
+	conditions = append(conditions, "NOT quarantined", "hidden_at IS NULL", "station_id IS NOT NULL")
 
-	return lastUpdateTime, nil
+	args = append(args, filter.Limit, offset)
+	sql := fmt.Sprintf(`SELECT timestamp, station_id, direction_id, line
+		FROM ticket_info
+		WHERE %s
+		ORDER BY timestamp, id
+		LIMIT $%d OFFSET $%d;`, strings.Join(conditions, " AND "), len(args)-1, len(args))
+
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	ticketInfoList := []types.TicketInfo{}
+	for rows.Next() {
+		var ticketInfo types.TicketInfo
+		if err := rows.Scan(&ticketInfo.Timestamp, &ticketInfo.Station_ID, &ticketInfo.Direction_ID, &ticketInfo.Line); err != nil {
+			return nil, fmt.Errorf("error scanning row (sightings): %w", err)
+		}
+		ticketInfoList = append(ticketInfoList, ticketInfo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (sightings): %w", err)
+	}
+
+	return ticketInfoList, nil
 }
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrExportRunning is returned while another export is running, so exports never hold more than one connection
+var ErrExportRunning = errors.New("another export is running")
+
+// exportSlot is taken by the running export
+var exportSlot = make(chan struct{}, 1)
+
+// StreamReports calls handle for every visible report matching the filter, oldest first,
+// without loading all of them into memory
+func StreamReports(ctx context.Context, filter types.AggregationFilter, handle func(types.ExportRow) error) error {
+	conditions, args := filterConditions(filter, "timestamp")
+	conditions = append(conditions, "NOT quarantined", "hidden_at IS NULL")
+
+	sql := fmt.Sprintf(`SELECT id::text, timestamp, message, author, line, station_id, station_name, direction_id, direction_name
+		FROM ticket_info
+		WHERE %s
+		ORDER BY timestamp, id;`, strings.Join(conditions, " AND "))
+
+	select {
+	case exportSlot <- struct{}{}:
+		defer func() { <-exportSlot }()
+	default:
+		return ErrExportRunning
+	}
+
+	// An export can take much longer than the query timeout, so it has its own timeout
+	conn, ctx, release, err := acquire(ctx, exportTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	var row types.ExportRow
+	_, err = pgx.ForEachRow(rows, []any{
+		&row.ID, &row.Timestamp, &row.Message, &row.Author, &row.Line,
+		&row.StationID, &row.StationName, &row.DirectionID, &row.DirectionName,
+	}, func() error {
+		err := handle(row)
+		// Reset the pointers, so the next row doesn't overwrite the values of this one
+		row = types.ExportRow{}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting reports: %w", err)
+	}
+
+	return nil
+}
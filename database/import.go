@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/jackc/pgx/v5"
+)
+
+// Number of reports inserted per transaction
+const importBatchSize = 1000
+
+// ImportTicketInfo inserts historical reports and returns how many were new,
+// reports with a source hash that was already imported are skipped
+func ImportTicketInfo(ctx context.Context, records []types.ImportRecord) (int, error) {
+	sql := `
+	INSERT INTO ticket_info (timestamp, message, author, line, station_name, station_id, direction_name, direction_id, source_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (source_hash) DO NOTHING;
+	`
+
+	inserted := 0
+	for start := 0; start < len(records); start += importBatchSize {
+		batch := &pgx.Batch{}
+		for _, record := range records[start:min(start+importBatchSize, len(records))] {
+			batch.Queue(sql, record.Timestamp, record.Message, record.Author, record.Line, record.StationName,
+				record.StationID, record.DirectionName, record.DirectionID, record.SourceHash)
+		}
+
+		batchInserted := 0
+		err := inTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+			results := tx.SendBatch(ctx, batch)
+			defer results.Close()
+
+			for range batch.Len() {
+				tag, err := results.Exec()
+				if err != nil {
+					return err
+				}
+				batchInserted += int(tag.RowsAffected())
+			}
+			return nil
+		})
+		if err != nil {
+			return inserted, fmt.Errorf("failed to import ticket info: %w", err)
+		}
+		inserted += batchInserted
+	}
+
+	return inserted, nil
+}
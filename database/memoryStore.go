@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	types "github.com/FreiFahren/backend/structs"
+)
+
+// MemoryStore is a TicketInfoStore keeping the reports in memory, it knows no bans or moderation.
+// It answers like PostgresStore, including the times without a zone, so handlers can be tested without a database.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	reports []memoryReport
+}
+
+type memoryReport struct {
+	timestamp   time.Time
+	line        *string
+	stationName *string
+	stationID   *string
+	directionID *string
+	quarantined bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) InsertTicketInfo(ctx context.Context, timestamp *time.Time, message *string, author *int64, line, stationName, stationId, directionName, directionId, reporterId *string, quarantined bool) error {
+	report := memoryReport{
+		timestamp:   wallClock(time.Now()),
+		line:        line,
+		stationName: stationName,
+		stationID:   stationId,
+		directionID: directionId,
+		quarantined: quarantined,
+	}
+	if timestamp != nil {
+		report.timestamp = wallClock(*timestamp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, report)
+	return nil
+}
+
+// GetLatestStationCoordinates has no upper bound like the query, so reports with a time ahead of the clock are included
+func (s *MemoryStore) GetLatestStationCoordinates(ctx context.Context) ([]types.TicketInfo, error) {
+	return s.stationCoordinates(wallClock(time.Now()).Add(-15*time.Minute), time.Time{}), nil
+}
+
+func (s *MemoryStore) GetStationCoordinatesAt(ctx context.Context, at time.Time) ([]types.TicketInfo, error) {
+	to := wallClock(at)
+	return s.stationCoordinates(to.Add(-15*time.Minute), to), nil
+}
+
+func (s *MemoryStore) GetLatestSightings(ctx context.Context, limit int) ([]types.TicketInfo, error) {
+	ticketInfoList := s.stationCoordinates(time.Time{}, time.Time{})
+	// Newest first, the later report first if both have the same time
+	slices.Reverse(ticketInfoList)
+	sort.SliceStable(ticketInfoList, func(i, j int) bool {
+		return ticketInfoList[i].Timestamp.After(ticketInfoList[j].Timestamp)
+	})
+	return ticketInfoList[:min(len(ticketInfoList), limit)], nil
+}
+
+// stationCoordinates returns the visible reports with a station from the given time on, until to if it isn't zero
+func (s *MemoryStore) stationCoordinates(from, to time.Time) []types.TicketInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ticketInfoList []types.TicketInfo
+	for _, report := range s.reports {
+		if report.timestamp.Before(from) || (!to.IsZero() && report.timestamp.After(to)) || report.stationName == nil || !report.visible() {
+			continue
+		}
+		ticketInfoList = append(ticketInfoList, report.ticketInfo())
+	}
+	return ticketInfoList
+}
+
+func (s *MemoryStore) GetHistoricStations(ctx context.Context, timestamp time.Time) ([]types.TicketInfo, error) {
+	to := wallClock(timestamp)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var lastReport time.Time
+	counts := map[string]int{}
+	for _, report := range s.reports {
+		if report.timestamp.After(to) || !report.visible() {
+			continue
+		}
+		if report.timestamp.After(lastReport) {
+			lastReport = report.timestamp
+		}
+		if report.timestamp.Hour() == to.Hour() && report.timestamp.Weekday() == to.Weekday() {
+			counts[*report.stationID]++
+		}
+	}
+	if lastReport.IsZero() {
+		return nil, nil
+	}
+
+	stationIDs := make([]string, 0, len(counts))
+	for stationID := range counts {
+		stationIDs = append(stationIDs, stationID)
+	}
+	sort.Slice(stationIDs, func(i, j int) bool {
+		if counts[stationIDs[i]] != counts[stationIDs[j]] {
+			return counts[stationIDs[i]] > counts[stationIDs[j]]
+		}
+		return stationIDs[i] < stationIDs[j]
+	})
+
+	var ticketInfoList []types.TicketInfo
+	for _, stationID := range stationIDs[:min(len(stationIDs), 20)] {
+		ticketInfoList = append(ticketInfoList, types.TicketInfo{
+			Station_ID: stationID,
+			Timestamp:  lastReport,
+			IsHistoric: true,
+		})
+	}
+	return ticketInfoList, nil
+}
+
+func (s *MemoryStore) GetLatestUpdateTime(ctx context.Context) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The latest report that left the 15 minutes changed them when it did
+	expired := wallClock(time.Now()).Add(-15 * time.Minute)
+	var latest time.Time
+	for _, report := range s.reports {
+		if report.quarantined {
+			continue
+		}
+		if report.timestamp.After(latest) {
+			latest = report.timestamp
+		}
+		if report.timestamp.Before(expired) && report.timestamp.Add(15*time.Minute).After(latest) {
+			latest = report.timestamp.Add(15 * time.Minute)
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, nil
+	}
+	return time.Date(latest.Year(), latest.Month(), latest.Day(), latest.Hour(), latest.Minute(), latest.Second(), latest.Nanosecond(), time.Local), nil
+}
+
+func (s *MemoryStore) IsReporterBanned(ctx context.Context, reporterIds []string) (bool, error) {
+	return false, nil
+}
+
+// visible reports are shown on /recent and counted for the historic data
+func (r memoryReport) visible() bool {
+	return !r.quarantined && r.stationID != nil
+}
+
+func (r memoryReport) ticketInfo() types.TicketInfo {
+	ticketInfo := types.TicketInfo{Timestamp: r.timestamp, Station_ID: *r.stationID}
+	if r.line != nil {
+		ticketInfo.Line.String, ticketInfo.Line.Valid = *r.line, true
+	}
+	if r.directionID != nil {
+		ticketInfo.Direction_ID.String, ticketInfo.Direction_ID.Valid = *r.directionID, true
+	}
+	return ticketInfo
+}
+
+// wallClock drops the zone of the time like a TIMESTAMP column does, pgx reads those times back in UTC
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).Truncate(time.Microsecond)
+}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Returned when a moderation action targets a report or ban that doesn't exist
+var (
+	ErrReportNotFound    = errors.New("report not found")
+	ErrReporterNotBanned = errors.New("reporter is not banned")
+)
+
+func CreateModerationTables() {
+	sql := `
+	ALTER TABLE ticket_info ADD COLUMN IF NOT EXISTS reporter_id VARCHAR(64);
+	ALTER TABLE ticket_info ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP;
+
+	CREATE TABLE IF NOT EXISTS banned_reporters (
+		reporter_id VARCHAR(64) PRIMARY KEY,
+		reason TEXT,
+		banned_by VARCHAR(255) NOT NULL,
+		banned_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS moderation_log (
+		id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+		timestamp TIMESTAMP NOT NULL DEFAULT NOW(),
+		moderator VARCHAR(255) NOT NULL,
+		action VARCHAR(32) NOT NULL,
+		report_id UUID,
+		reporter_id VARCHAR(64),
+		details TEXT
+	);
+	`
+
+	_, err := pool.Exec(context.Background(), sql)
+	if err != nil {
+		slog.Error("Failed to create moderation tables", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Moderation tables created or already exist")
+}
+
+const reportColumns = `id::text, timestamp, message, author, line, station_name, station_id,
+	direction_name, direction_id, reporter_id, quarantined, hidden_at`
+
+func scanReport(row pgx.Row) (types.Report, error) {
+	var report types.Report
+	err := row.Scan(
+		&report.ID,
+		&report.Timestamp,
+		&report.Message,
+		&report.Author,
+		&report.Line,
+		&report.StationName,
+		&report.StationID,
+		&report.DirectionName,
+		&report.DirectionID,
+		&report.ReporterID,
+		&report.Quarantined,
+		&report.HiddenAt,
+	)
+	return report, err
+}
+
+// ListReports returns the reports matching the filter, newest first
+func ListReports(ctx context.Context, filter types.ReportFilter) ([]types.Report, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Query != "" {
+		addCondition("(message ILIKE $%[1]d OR station_name ILIKE $%[1]d OR direction_name ILIKE $%[1]d)", "%"+filter.Query+"%")
+	}
+	if filter.Line != "" {
+		addCondition("line = $%d", filter.Line)
+	}
+	if filter.StationID != "" {
+		addCondition("station_id = $%d", filter.StationID)
+	}
+	if filter.ReporterID != "" {
+		addCondition("reporter_id = $%d", filter.ReporterID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp <= $%d", filter.To)
+	}
+
+	switch filter.Status {
+	case types.ReportStatusVisible:
+		conditions = append(conditions, "hidden_at IS NULL AND NOT quarantined")
+	case types.ReportStatusHidden:
+		conditions = append(conditions, "hidden_at IS NOT NULL")
+	case types.ReportStatusQuarantined:
+		conditions = append(conditions, "hidden_at IS NULL AND quarantined")
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	sql := fmt.Sprintf(`SELECT %s
+		FROM ticket_info
+		WHERE %s
+		ORDER BY timestamp DESC
+		LIMIT $%d OFFSET $%d;`, reportColumns, strings.Join(conditions, " AND "), len(args)-1, len(args))
+
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []types.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row (reports): %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (reports): %w", err)
+	}
+
+	return reports, nil
+}
+
+func GetReport(ctx context.Context, id string) (types.Report, error) {
+	if uuid.Validate(id) != nil {
+		return types.Report{}, ErrReportNotFound
+	}
+
+	sql := fmt.Sprintf(`SELECT %s FROM ticket_info WHERE id = $1::uuid;`, reportColumns)
+
+	report, err := scanReport(queryRow(ctx, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Report{}, ErrReportNotFound
+	}
+	if err != nil {
+		return types.Report{}, fmt.Errorf("query execution error: %w", err)
+	}
+
+	return report, nil
+}
+
+// UpdateReport overwrites the line, station and direction of a report
+func UpdateReport(ctx context.Context, moderator, id string, line, stationName, stationId, directionName, directionId *string) error {
+	sql := `
+	UPDATE ticket_info
+	SET line = $2, station_name = $3, station_id = $4, direction_name = $5, direction_id = $6
+	WHERE id = $1::uuid;
+	`
+
+	details := fmt.Sprintf("line=%s station=%s direction=%s", valueOrEmpty(line), valueOrEmpty(stationId), valueOrEmpty(directionId))
+	return moderateReport(ctx, moderator, types.ModerationActionEdit, id, details, sql, line, stationName, stationId, directionName, directionId)
+}
+
+// HideReport soft deletes a report, so it is no longer used for /recent
+func HideReport(ctx context.Context, moderator, id, reason string) error {
+	sql := `UPDATE ticket_info SET hidden_at = NOW() WHERE id = $1::uuid;`
+	return moderateReport(ctx, moderator, types.ModerationActionHide, id, reason, sql)
+}
+
+func RestoreReport(ctx context.Context, moderator, id string) error {
+	sql := `UPDATE ticket_info SET hidden_at = NULL WHERE id = $1::uuid;`
+	return moderateReport(ctx, moderator, types.ModerationActionRestore, id, "", sql)
+}
+
+// ApproveReport releases a quarantined report, so it is shown on /recent again
+func ApproveReport(ctx context.Context, moderator, id string) error {
+	sql := `UPDATE ticket_info SET quarantined = FALSE WHERE id = $1::uuid;`
+	return moderateReport(ctx, moderator, types.ModerationActionApprove, id, "", sql)
+}
+
+// moderateReport runs the update on the report and records it in the moderation log in one transaction
+func moderateReport(ctx context.Context, moderator, action, id, details, sql string, args ...interface{}) error {
+	// Ids that aren't UUIDs would fail the cast in the query instead of matching no report
+	if uuid.Validate(id) != nil {
+		return ErrReportNotFound
+	}
+
+	return inTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, sql, append([]interface{}{id}, args...)...)
+		if err != nil {
+			return fmt.Errorf("failed to %s report: %w", action, err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrReportNotFound
+		}
+
+		return insertModerationLog(ctx, tx, moderator, action, &id, nil, details)
+	})
+}
+
+func BanReporter(ctx context.Context, moderator, reporterId, reason string) error {
+	sql := `
+	INSERT INTO banned_reporters (reporter_id, reason, banned_by)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (reporter_id) DO UPDATE SET reason = $2, banned_by = $3, banned_at = NOW();
+	`
+
+	return inTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql, reporterId, reason, moderator); err != nil {
+			return fmt.Errorf("failed to ban reporter: %w", err)
+		}
+
+		return insertModerationLog(ctx, tx, moderator, types.ModerationActionBan, nil, &reporterId, reason)
+	})
+}
+
+func UnbanReporter(ctx context.Context, moderator, reporterId string) error {
+	return inTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `DELETE FROM banned_reporters WHERE reporter_id = $1;`, reporterId)
+		if err != nil {
+			return fmt.Errorf("failed to unban reporter: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrReporterNotBanned
+		}
+
+		return insertModerationLog(ctx, tx, moderator, types.ModerationActionUnban, nil, &reporterId, "")
+	})
+}
+
+func ListBannedReporters(ctx context.Context) ([]types.BannedReporter, error) {
+	sql := `SELECT reporter_id, reason, banned_by, banned_at FROM banned_reporters ORDER BY banned_at DESC;`
+
+	rows, err := query(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	bannedReporters := []types.BannedReporter{}
+	for rows.Next() {
+		var bannedReporter types.BannedReporter
+		if err := rows.Scan(&bannedReporter.ReporterID, &bannedReporter.Reason, &bannedReporter.BannedBy, &bannedReporter.BannedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row (banned reporters): %w", err)
+		}
+		bannedReporters = append(bannedReporters, bannedReporter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (banned reporters): %w", err)
+	}
+
+	return bannedReporters, nil
+}
+
+// IsReporterBanned returns true if any of the given reporter ids is banned
+func IsReporterBanned(ctx context.Context, reporterIds []string) (bool, error) {
+	var banned bool
+
+	sql := `SELECT EXISTS (SELECT 1 FROM banned_reporters WHERE reporter_id = ANY($1));`
+
+	err := queryRow(ctx, sql, reporterIds).Scan(&banned)
+	if err != nil {
+		return false, fmt.Errorf("query execution error: %w", err)
+	}
+
+	return banned, nil
+}
+
+func insertModerationLog(ctx context.Context, tx pgx.Tx, moderator, action string, reportId, reporterId *string, details string) error {
+	sql := `
+	INSERT INTO moderation_log (moderator, action, report_id, reporter_id, details)
+	VALUES ($1, $2, $3::uuid, $4, $5);
+	`
+
+	if _, err := tx.Exec(ctx, sql, moderator, action, reportId, reporterId, details); err != nil {
+		return fmt.Errorf("failed to write moderation log: %w", err)
+	}
+	return nil
+}
+
+func ListModerationLog(ctx context.Context, limit, offset int) ([]types.ModerationLogEntry, error) {
+	sql := `
+	SELECT id::text, timestamp, moderator, action, report_id::text, reporter_id, details
+	FROM moderation_log
+	ORDER BY timestamp DESC
+	LIMIT $1 OFFSET $2;
+	`
+
+	rows, err := query(ctx, sql, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []types.ModerationLogEntry{}
+	for rows.Next() {
+		var entry types.ModerationLogEntry
+		var details *string
+		if err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.Moderator, &entry.Action, &entry.ReportID, &entry.ReporterID, &details); err != nil {
+			return nil, fmt.Errorf("error scanning row (moderation log): %w", err)
+		}
+		entry.Details = valueOrEmpty(details)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (moderation log): %w", err)
+	}
+
+	return entries, nil
+}
+
+func valueOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
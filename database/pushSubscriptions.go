@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrPushSubscriptionNotFound = errors.New("push subscription not found")
+
+func CreatePushSubscriptionsTable() {
+	sql := `
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+		channel VARCHAR(16) NOT NULL,
+		endpoint TEXT NOT NULL,
+		p256dh TEXT NOT NULL DEFAULT '',
+		auth TEXT NOT NULL DEFAULT '',
+		station_ids TEXT[] NOT NULL DEFAULT '{}',
+		lines TEXT[] NOT NULL DEFAULT '{}',
+		window_from VARCHAR(5) NOT NULL DEFAULT '',
+		window_to VARCHAR(5) NOT NULL DEFAULT '',
+		weekdays INT[] NOT NULL DEFAULT '{}',
+		token_hash VARCHAR(64) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	`
+
+	_, err := pool.Exec(context.Background(), sql)
+	if err != nil {
+		slog.Error("Failed to create push subscriptions table", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Push subscriptions table created or already exists")
+}
+
+const pushSubscriptionColumns = `id::text, channel, endpoint, p256dh, auth, station_ids, lines, window_from, window_to, weekdays, created_at`
+
+func scanPushSubscription(row pgx.Row) (types.PushSubscription, error) {
+	var subscription types.PushSubscription
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.Channel,
+		&subscription.Endpoint,
+		&subscription.Keys.P256dh,
+		&subscription.Keys.Auth,
+		&subscription.Stations,
+		&subscription.Lines,
+		&subscription.From,
+		&subscription.To,
+		&subscription.Weekdays,
+		&subscription.CreatedAt,
+	)
+	return subscription, err
+}
+
+// InsertPushSubscription stores the subscription with the hash of the token needed to delete it
+func InsertPushSubscription(ctx context.Context, subscription types.PushSubscription, tokenHash string) (types.PushSubscription, error) {
+	sql := fmt.Sprintf(`
+	INSERT INTO push_subscriptions (channel, endpoint, p256dh, auth, station_ids, lines, window_from, window_to, weekdays, token_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING %s;
+	`, pushSubscriptionColumns)
+
+	inserted, err := scanPushSubscription(queryRow(ctx, sql,
+		subscription.Channel, subscription.Endpoint, subscription.Keys.P256dh, subscription.Keys.Auth,
+		subscription.Stations, subscription.Lines, subscription.From, subscription.To, subscription.Weekdays, tokenHash))
+	if err != nil {
+		return types.PushSubscription{}, fmt.Errorf("failed to insert push subscription: %w", err)
+	}
+	return inserted, nil
+}
+
+// ListPushSubscriptionsFor returns the subscriptions watching the station or the line
+func ListPushSubscriptionsFor(ctx context.Context, stationID, line string) ([]types.PushSubscription, error) {
+	sql := fmt.Sprintf(`
+	SELECT %s FROM push_subscriptions
+	WHERE $1 = ANY(station_ids) OR $2 = ANY(lines);
+	`, pushSubscriptionColumns)
+
+	rows, err := query(ctx, sql, stationID, line)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []types.PushSubscription{}
+	for rows.Next() {
+		subscription, err := scanPushSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row (push subscriptions): %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (push subscriptions): %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeletePushSubscription deletes the subscription if the token hash matches
+func DeletePushSubscription(ctx context.Context, id, tokenHash string) error {
+	result, err := exec(ctx, `DELETE FROM push_subscriptions WHERE id::text = $1 AND token_hash = $2;`, id, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPushSubscriptionNotFound
+	}
+	return nil
+}
+
+// RemoveExpiredPushSubscription deletes a subscription the push service no longer accepts
+func RemoveExpiredPushSubscription(ctx context.Context, id string) error {
+	_, err := exec(ctx, `DELETE FROM push_subscriptions WHERE id::text = $1;`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove push subscription: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	types "github.com/FreiFahren/backend/structs"
+)
+
+// CreateStatsViews creates the materialized view the statistics are computed from.
+// It counts the visible reports per hour, station and line, missing stations and lines are stored as empty strings.
+func CreateStatsViews() {
+	sql := `
+	CREATE MATERIALIZED VIEW IF NOT EXISTS report_stats_hourly AS
+	SELECT date_trunc('hour', timestamp) AS hour,
+		COALESCE(station_id, '') AS station_id,
+		COALESCE(line, '') AS line,
+		COUNT(*) AS count
+	FROM ticket_info
+	WHERE NOT quarantined AND hidden_at IS NULL
+	GROUP BY 1, 2, 3;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS report_stats_hourly_key ON report_stats_hourly (hour, station_id, line);
+	`
+
+	_, err := pool.Exec(context.Background(), sql)
+	if err != nil {
+		slog.Error("Failed to create stats views", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Stats views created or already exist")
+}
+
+// RefreshStatsViews recomputes the statistics, reads are not blocked while it runs
+func RefreshStatsViews(ctx context.Context) error {
+	// Recomputing the view takes longer than the query timeout on a large history
+	conn, ctx, release, err := acquire(ctx, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = conn.Exec(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY report_stats_hourly;`)
+	if err != nil {
+		return fmt.Errorf("failed to refresh stats views: %w", err)
+	}
+	return nil
+}
+
+// StatsCounts returns the number of reports per station or line, largest counts first
+func StatsCounts(ctx context.Context, groupBy string, filter types.AggregationFilter) ([]types.ReportCount, error) {
+	if groupBy != GroupByStation && groupBy != GroupByLine {
+		return nil, fmt.Errorf("can't group reports by %q", groupBy)
+	}
+
+	conditions, args := filterConditions(filter, "hour")
+	conditions = append(conditions, groupBy+" <> ''")
+
+	limit := "ALL"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		limit = fmt.Sprintf("$%d", len(args))
+	}
+
+	sql := fmt.Sprintf(`SELECT %[1]s, SUM(count)::bigint
+		FROM report_stats_hourly
+		WHERE %[2]s
+		GROUP BY %[1]s
+		ORDER BY SUM(count) DESC, %[1]s
+		LIMIT %[3]s;`, groupBy, strings.Join(conditions, " AND "), limit)
+
+	return queryReportCounts(ctx, sql, args...)
+}
+
+// StatsMatrix returns the number of reports per weekday (0 is Sunday) and hour of the day
+func StatsMatrix(ctx context.Context, filter types.AggregationFilter) ([7][24]int, error) {
+	var matrix [7][24]int
+
+	conditions, args := filterConditions(filter, "hour")
+	sql := fmt.Sprintf(`SELECT EXTRACT(DOW FROM hour)::int, EXTRACT(HOUR FROM hour)::int, SUM(count)::bigint
+		FROM report_stats_hourly
+		WHERE %s
+		GROUP BY 1, 2;`, strings.Join(conditions, " AND "))
+
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return matrix, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var weekday, hour, count int
+		if err := rows.Scan(&weekday, &hour, &count); err != nil {
+			return matrix, fmt.Errorf("error scanning row (stats matrix): %w", err)
+		}
+		matrix[weekday][hour] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return matrix, fmt.Errorf("error iterating rows (stats matrix): %w", err)
+	}
+
+	return matrix, nil
+}
+
+// StatsWeeklyCounts returns the number of reports per week, keyed by the monday the week starts with
+func StatsWeeklyCounts(ctx context.Context, filter types.AggregationFilter) (map[time.Time]int, error) {
+	conditions, args := filterConditions(filter, "hour")
+	sql := fmt.Sprintf(`SELECT date_trunc('week', hour), SUM(count)::bigint
+		FROM report_stats_hourly
+		WHERE %s
+		GROUP BY 1;`, strings.Join(conditions, " AND "))
+
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[time.Time]int{}
+	for rows.Next() {
+		var week time.Time
+		var count int
+		if err := rows.Scan(&week, &count); err != nil {
+			return nil, fmt.Errorf("error scanning row (weekly stats): %w", err)
+		}
+		// Like the hours, the weeks are read in local time
+		counts[time.Date(week.Year(), week.Month(), week.Day(), 0, 0, 0, 0, time.Local)] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (weekly stats): %w", err)
+	}
+
+	return counts, nil
+}
+
+// StatsHourlyCounts returns the number of reports per hour, station and line, oldest first
+func StatsHourlyCounts(ctx context.Context, filter types.AggregationFilter) ([]types.HourlyCount, error) {
+	conditions, args := filterConditions(filter, "hour")
+	sql := fmt.Sprintf(`SELECT hour, station_id, line, count
+		FROM report_stats_hourly
+		WHERE %s
+		ORDER BY hour, station_id, line;`, strings.Join(conditions, " AND "))
+
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []types.HourlyCount{}
+	for rows.Next() {
+		var count types.HourlyCount
+		if err := rows.Scan(&count.Hour, &count.StationID, &count.Line, &count.Count); err != nil {
+			return nil, fmt.Errorf("error scanning row (hourly stats): %w", err)
+		}
+		// The reports are stored in local time without a zone
+		count.Hour = time.Date(count.Hour.Year(), count.Hour.Month(), count.Hour.Day(), count.Hour.Hour(), 0, 0, 0, time.Local)
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (hourly stats): %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	types "github.com/FreiFahren/backend/structs"
+)
+
+// TicketInfoStore holds the reports behind /newInspector and /recent.
+// PostgresStore is used in production, MemoryStore for tests and local development without a database.
+type TicketInfoStore interface {
+	InsertTicketInfo(ctx context.Context, timestamp *time.Time, message *string, author *int64, line, stationName, stationId, directionName, directionId, reporterId *string, quarantined bool) error
+	// GetLatestStationCoordinates returns the visible reports with a station of the last 15 minutes
+	GetLatestStationCoordinates(ctx context.Context) ([]types.TicketInfo, error)
+	// GetStationCoordinatesAt returns the visible reports with a station of the 15 minutes before the given time
+	GetStationCoordinatesAt(ctx context.Context, at time.Time) ([]types.TicketInfo, error)
+	// GetLatestSightings returns the latest visible reports with a station, newest first
+	GetLatestSightings(ctx context.Context, limit int) ([]types.TicketInfo, error)
+	// GetHistoricStations returns the stations with the most reports at the hour and weekday of the timestamp
+	GetHistoricStations(ctx context.Context, timestamp time.Time) ([]types.TicketInfo, error)
+	// GetLatestUpdateTime returns when the visible reports of the last 15 minutes last changed,
+	// including reports leaving the 15 minutes, zero if there are none
+	GetLatestUpdateTime(ctx context.Context) (time.Time, error)
+	// IsReporterBanned returns true if any of the given reporter ids is banned
+	IsReporterBanned(ctx context.Context, reporterIds []string) (bool, error)
+}
+
+// PostgresStore is the TicketInfoStore of the connection pool created by CreatePool
+type PostgresStore struct{}
+
+func (PostgresStore) InsertTicketInfo(ctx context.Context, timestamp *time.Time, message *string, author *int64, line, stationName, stationId, directionName, directionId, reporterId *string, quarantined bool) error {
+	return InsertTicketInfo(ctx, timestamp, message, author, line, stationName, stationId, directionName, directionId, reporterId, quarantined)
+}
+
+func (PostgresStore) GetLatestStationCoordinates(ctx context.Context) ([]types.TicketInfo, error) {
+	return GetLatestStationCoordinates(ctx)
+}
+
+func (PostgresStore) GetStationCoordinatesAt(ctx context.Context, at time.Time) ([]types.TicketInfo, error) {
+	return GetStationCoordinatesAt(ctx, at)
+}
+
+func (PostgresStore) GetLatestSightings(ctx context.Context, limit int) ([]types.TicketInfo, error) {
+	return GetLatestSightings(ctx, limit)
+}
+
+func (PostgresStore) GetHistoricStations(ctx context.Context, timestamp time.Time) ([]types.TicketInfo, error) {
+	return GetHistoricStations(ctx, timestamp)
+}
+
+func (PostgresStore) GetLatestUpdateTime(ctx context.Context) (time.Time, error) {
+	return GetLatestUpdateTime(ctx)
+}
+
+func (PostgresStore) IsReporterBanned(ctx context.Context, reporterIds []string) (bool, error) {
+	return IsReporterBanned(ctx, reporterIds)
+}
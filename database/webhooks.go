@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	types "github.com/FreiFahren/backend/structs"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+func CreateWebhookTables() {
+	sql := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+		api_key_id UUID NOT NULL REFERENCES api_keys (id),
+		url TEXT NOT NULL,
+		secret VARCHAR(128) NOT NULL,
+		city VARCHAR(32) NOT NULL DEFAULT '',
+		lines TEXT[] NOT NULL DEFAULT '{}',
+		station_ids TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		delivery_id UUID NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER,
+		error TEXT,
+		duration_ms BIGINT NOT NULL,
+		timestamp TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook_id, timestamp);
+
+	-- Events that couldn't be delivered after all retries, kept for manual redelivery
+	CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+		delivery_id UUID PRIMARY KEY,
+		webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event VARCHAR(32) NOT NULL,
+		payload JSONB NOT NULL,
+		attempts INTEGER NOT NULL,
+		last_error TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	`
+
+	_, err := pool.Exec(context.Background(), sql)
+	if err != nil {
+		slog.Error("Failed to create webhook tables", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Webhook tables created or already exist")
+}
+
+const webhookColumns = `id::text, url, city, lines, station_ids, secret, created_at`
+
+func scanWebhook(row pgx.Row) (types.Webhook, error) {
+	var webhook types.Webhook
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.City, &webhook.Lines, &webhook.Stations, &webhook.Secret, &webhook.CreatedAt)
+	return webhook, err
+}
+
+func InsertWebhook(ctx context.Context, apiKeyID string, webhook types.Webhook) (types.Webhook, error) {
+	sql := fmt.Sprintf(`
+	INSERT INTO webhooks (api_key_id, url, secret, city, lines, station_ids)
+	VALUES ($1::uuid, $2, $3, $4, $5, $6)
+	RETURNING %s;
+	`, webhookColumns)
+
+	inserted, err := scanWebhook(queryRow(ctx, sql, apiKeyID, webhook.URL, webhook.Secret, webhook.City, webhook.Lines, webhook.Stations))
+	if err != nil {
+		return types.Webhook{}, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return inserted, nil
+}
+
+// ListWebhooks returns the webhooks registered with the api key, including their secrets
+func ListWebhooks(ctx context.Context, apiKeyID string) ([]types.Webhook, error) {
+	sql := fmt.Sprintf(`SELECT %s FROM webhooks WHERE api_key_id = $1::uuid ORDER BY created_at;`, webhookColumns)
+	return queryWebhooks(ctx, sql, apiKeyID)
+}
+
+// ListWebhooksFor returns the webhooks of keys that haven't been revoked, whose filters match the station and line
+func ListWebhooksFor(ctx context.Context, stationID, line string) ([]types.Webhook, error) {
+	sql := fmt.Sprintf(`
+	SELECT %s FROM webhooks
+	WHERE (cardinality(station_ids) = 0 OR $1 = ANY(station_ids))
+		AND (cardinality(lines) = 0 OR $2 = ANY(lines))
+		AND api_key_id IN (SELECT id FROM api_keys WHERE revoked_at IS NULL);
+	`, webhookColumns)
+	return queryWebhooks(ctx, sql, stationID, line)
+}
+
+func queryWebhooks(ctx context.Context, sql string, args ...interface{}) ([]types.Webhook, error) {
+	rows, err := query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []types.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row (webhooks): %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (webhooks): %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook with its delivery log, if it was registered with the api key
+func DeleteWebhook(ctx context.Context, apiKeyID, id string) error {
+	result, err := exec(ctx, `DELETE FROM webhooks WHERE id::text = $1 AND api_key_id = $2::uuid;`, id, apiKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func InsertWebhookDelivery(ctx context.Context, delivery types.WebhookDelivery) error {
+	sql := `
+	INSERT INTO webhook_deliveries (webhook_id, delivery_id, attempt, status_code, error, duration_ms, timestamp)
+	VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7);
+	`
+
+	_, err := exec(ctx, sql, delivery.WebhookID, delivery.DeliveryID, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.DurationMs, delivery.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// InsertWebhookDeadLetter keeps an event that couldn't be delivered
+func InsertWebhookDeadLetter(ctx context.Context, webhookID, deliveryID, event string, payload []byte, attempts int, lastError string) error {
+	sql := `
+	INSERT INTO webhook_dead_letters (delivery_id, webhook_id, event, payload, attempts, last_error)
+	VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6);
+	`
+
+	_, err := exec(ctx, sql, deliveryID, webhookID, event, string(payload), attempts, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook dead letter: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook registered with the api key, newest first
+func ListWebhookDeliveries(ctx context.Context, apiKeyID, id string, limit, offset int) ([]types.WebhookDelivery, error) {
+	var exists bool
+	err := queryRow(ctx, `SELECT EXISTS (SELECT 1 FROM webhooks WHERE id::text = $1 AND api_key_id = $2::uuid);`, id, apiKeyID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	sql := `
+	SELECT webhook_id::text, delivery_id::text, attempt, status_code, error, duration_ms, timestamp
+	FROM webhook_deliveries
+	WHERE webhook_id = $1::uuid
+	ORDER BY timestamp DESC, id DESC
+	LIMIT $2 OFFSET $3;
+	`
+
+	rows, err := query(ctx, sql, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query execution error: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []types.WebhookDelivery{}
+	for rows.Next() {
+		var delivery types.WebhookDelivery
+		if err := rows.Scan(&delivery.WebhookID, &delivery.DeliveryID, &delivery.Attempt, &delivery.StatusCode,
+			&delivery.Error, &delivery.DurationMs, &delivery.Timestamp); err != nil {
+			return nil, fmt.Errorf("error scanning row (webhook deliveries): %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows (webhook deliveries): %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 
 	"github.com/FreiFahren/backend/api"
+	"github.com/FreiFahren/backend/commands"
 	"github.com/FreiFahren/backend/database"
+	structs "github.com/FreiFahren/backend/structs"
+	"github.com/FreiFahren/backend/telemetry"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -24,18 +31,63 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	// Create a new connection pool, for concurrency
-	database.CreatePool()
-
+	// Structured logging with LOG_LEVEL and LOG_FORMAT, traces are exported if OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTelemetry, err := telemetry.Init(context.Background())
 	if err != nil {
-		log.Fatal("Error while creating a pool :(")
+		log.Fatalf("Error setting up the tracing: %v", err)
+	}
+	defer shutdownTelemetry(context.Background())
+
+	// With REPORTS_STORE=memory the reports are kept in memory for local development without a database,
+	// the routes needing the other tables are unavailable then
+	inMemory := os.Getenv("REPORTS_STORE") == "memory"
+	if inMemory {
+		slog.Warn("Keeping the reports in memory, they are lost on restart")
+		api.Reports = database.NewMemoryStore()
+	} else {
+		// Create a new connection pool, for concurrency
+		database.CreatePool()
+
+		// Close the database connection when the main function returns
+		defer database.ClosePool()
+
+		// Ensure the required tables exist
+		database.CreateTicketInfoTable()
+		database.CreateModerationTables()
+		database.CreateApiKeysTable()
+		database.CreateStatsViews()
+		database.CreatePushSubscriptionsTable()
+		database.CreateWebhookTables()
+	}
+
+	// Run a management command instead of the server, e.g. `go run main.go keys list`
+	if len(os.Args) > 1 {
+		if err := commands.Run(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+
 	// Hosts
 	hosts := map[string]*Host{}
 
 	apiHOST := echo.New()
-	apiHOST.Use(middleware.Logger())
+	apiHOST.HideBanner = true
+
+	// The client IP is used for the rate limits and reporter ids, X-Forwarded-For is only trusted from TRUSTED_PROXIES
+	apiHOST.IPExtractor, err = api.IPExtractor()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Every response carries a request id, which is also part of the error envelope and of the logs and spans of the request
+	apiHOST.Use(middleware.RequestID())
+	apiHOST.Use(api.Trace)
+	apiHOST.Use(api.LogRequests)
+	// Before Recover, so panics are counted as 500
+	apiHOST.Use(api.RecordMetrics)
 	apiHOST.Use(middleware.Recover())
+	apiHOST.HTTPErrorHandler = api.HTTPErrorHandler
 
 	hosts["api.localhost:8080"] = &Host{apiHOST}
 
@@ -43,28 +95,52 @@ func main() {
 		return c.String(http.StatusOK, "API")
 	})
 
+	// Monitoring, not versioned like the api. The metrics reveal the traffic and the load, so they need an admin api key.
+	apiHOST.GET("/metrics", api.GetMetrics, api.RequireRole(structs.RoleAdmin))
+	apiHOST.GET("/healthz", api.GetHealth)
+	apiHOST.GET("/readyz", api.GetReadiness)
+
 	apiHOST.Use(middleware.CORS())
 
-	// Close the database connection when the main function returns
-	defer database.ClosePool()
+	// Resolve the api key of the request to its role, reads stay public
+	apiHOST.Use(api.Authenticate)
 
-	// Ensure the required table exists
-	database.CreateTicketInfoTable()
+	// Set up rate limits, burst detection and challenges for new reports
+	api.InitAbuseProtection()
 
-	// Return the id for given name
-	apiHOST.GET("/id", api.GetStationId)
+	// Read the VAPID keys for Web Push notifications, the retry settings of the webhooks and the broadcast channels
+	api.InitNotifications()
+	api.InitWebhooks()
+	api.InitBroadcasts()
 
-	// Return the last known inspectors 15 mins ago
-	apiHOST.GET("/recent", api.GetRecentTicketInspectorInfo)
+	// Answer commands in Telegram chats if TELEGRAM_BOT_TOKEN is set
+	api.StartTelegramBot()
 
-	// Return the name for given id
-	apiHOST.GET("/station", api.GetStationName)
+	if !inMemory {
+		// Keep the statistics up to date
+		api.StartStatsRefresh()
+
+		// Publish the anonymized counts of every day to OPEN_DATA_DIR
+		api.StartOpenDataSnapshots()
+	}
 
-	// Return all stations with their id (used for suggestions on the frontend)
-	apiHOST.GET("/list", api.GetAllStationsAndLines)
+	api.RegisterRoutes(apiHOST.Group("/v1"))
 
-	// Post a new ticket inspector
-	apiHOST.POST("/newInspector", api.PostInspector)
+	// The routes without version are kept as deprecated aliases of the /v1 routes
+	api.RegisterRoutes(apiHOST.Group(""), api.Deprecated)
+
+	// Internal consumers like the Telegram bot use the gRPC service on a separate port
+	grpcServer := api.NewGRPCServer()
+	grpcListener, err := net.Listen("tcp", ":"+api.GRPCPort())
+	if err != nil {
+		log.Fatalf("Error listening on the gRPC port: %v", err)
+	}
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			slog.Error("gRPC server stopped", "error", err)
+		}
+	}()
+	defer grpcServer.GracefulStop()
 
 	apiHOST.Start(":8080")
 
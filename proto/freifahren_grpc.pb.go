@@ -0,0 +1,306 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             v4.25.3
+// source: freifahren.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	FreiFahren_ReportInspector_FullMethodName     = "/freifahren.v1.FreiFahren/ReportInspector"
+	FreiFahren_GetStation_FullMethodName          = "/freifahren.v1.FreiFahren/GetStation"
+	FreiFahren_ListStations_FullMethodName        = "/freifahren.v1.FreiFahren/ListStations"
+	FreiFahren_ListRecentSightings_FullMethodName = "/freifahren.v1.FreiFahren/ListRecentSightings"
+	FreiFahren_StreamSightings_FullMethodName     = "/freifahren.v1.FreiFahren/StreamSightings"
+)
+
+// FreiFahrenClient is the client API for FreiFahren service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FreiFahren is used by internal consumers like the Telegram bot and the analytics jobs.
+// Calls are authenticated with the api key in the x-api-key or authorization metadata.
+type FreiFahrenClient interface {
+	// ReportInspector saves a new sighting, it requires an api key with the reporter role
+	ReportInspector(ctx context.Context, in *InspectorRequest, opts ...grpc.CallOption) (*ReportInspectorResponse, error)
+	// GetStation looks a station up by its id or its name
+	GetStation(ctx context.Context, in *GetStationRequest, opts ...grpc.CallOption) (*Station, error)
+	// ListStations returns all stations, or only those of a line
+	ListStations(ctx context.Context, in *ListStationsRequest, opts ...grpc.CallOption) (*ListStationsResponse, error)
+	// ListRecentSightings returns the same sightings as /recent
+	ListRecentSightings(ctx context.Context, in *ListRecentSightingsRequest, opts ...grpc.CallOption) (*ListRecentSightingsResponse, error)
+	// StreamSightings sends every new sighting until the client cancels the call
+	StreamSightings(ctx context.Context, in *StreamSightingsRequest, opts ...grpc.CallOption) (FreiFahren_StreamSightingsClient, error)
+}
+
+type freiFahrenClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFreiFahrenClient(cc grpc.ClientConnInterface) FreiFahrenClient {
+	return &freiFahrenClient{cc}
+}
+
+func (c *freiFahrenClient) ReportInspector(ctx context.Context, in *InspectorRequest, opts ...grpc.CallOption) (*ReportInspectorResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportInspectorResponse)
+	err := c.cc.Invoke(ctx, FreiFahren_ReportInspector_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *freiFahrenClient) GetStation(ctx context.Context, in *GetStationRequest, opts ...grpc.CallOption) (*Station, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Station)
+	err := c.cc.Invoke(ctx, FreiFahren_GetStation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *freiFahrenClient) ListStations(ctx context.Context, in *ListStationsRequest, opts ...grpc.CallOption) (*ListStationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListStationsResponse)
+	err := c.cc.Invoke(ctx, FreiFahren_ListStations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *freiFahrenClient) ListRecentSightings(ctx context.Context, in *ListRecentSightingsRequest, opts ...grpc.CallOption) (*ListRecentSightingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecentSightingsResponse)
+	err := c.cc.Invoke(ctx, FreiFahren_ListRecentSightings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *freiFahrenClient) StreamSightings(ctx context.Context, in *StreamSightingsRequest, opts ...grpc.CallOption) (FreiFahren_StreamSightingsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FreiFahren_ServiceDesc.Streams[0], FreiFahren_StreamSightings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &freiFahrenStreamSightingsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FreiFahren_StreamSightingsClient interface {
+	Recv() (*TicketInspector, error)
+	grpc.ClientStream
+}
+
+type freiFahrenStreamSightingsClient struct {
+	grpc.ClientStream
+}
+
+func (x *freiFahrenStreamSightingsClient) Recv() (*TicketInspector, error) {
+	m := new(TicketInspector)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FreiFahrenServer is the server API for FreiFahren service.
+// All implementations must embed UnimplementedFreiFahrenServer
+// for forward compatibility
+//
+// FreiFahren is used by internal consumers like the Telegram bot and the analytics jobs.
+// Calls are authenticated with the api key in the x-api-key or authorization metadata.
+type FreiFahrenServer interface {
+	// ReportInspector saves a new sighting, it requires an api key with the reporter role
+	ReportInspector(context.Context, *InspectorRequest) (*ReportInspectorResponse, error)
+	// GetStation looks a station up by its id or its name
+	GetStation(context.Context, *GetStationRequest) (*Station, error)
+	// ListStations returns all stations, or only those of a line
+	ListStations(context.Context, *ListStationsRequest) (*ListStationsResponse, error)
+	// ListRecentSightings returns the same sightings as /recent
+	ListRecentSightings(context.Context, *ListRecentSightingsRequest) (*ListRecentSightingsResponse, error)
+	// StreamSightings sends every new sighting until the client cancels the call
+	StreamSightings(*StreamSightingsRequest, FreiFahren_StreamSightingsServer) error
+	mustEmbedUnimplementedFreiFahrenServer()
+}
+
+// UnimplementedFreiFahrenServer must be embedded to have forward compatible implementations.
+type UnimplementedFreiFahrenServer struct {
+}
+
+func (UnimplementedFreiFahrenServer) ReportInspector(context.Context, *InspectorRequest) (*ReportInspectorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportInspector not implemented")
+}
+func (UnimplementedFreiFahrenServer) GetStation(context.Context, *GetStationRequest) (*Station, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStation not implemented")
+}
+func (UnimplementedFreiFahrenServer) ListStations(context.Context, *ListStationsRequest) (*ListStationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStations not implemented")
+}
+func (UnimplementedFreiFahrenServer) ListRecentSightings(context.Context, *ListRecentSightingsRequest) (*ListRecentSightingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecentSightings not implemented")
+}
+func (UnimplementedFreiFahrenServer) StreamSightings(*StreamSightingsRequest, FreiFahren_StreamSightingsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSightings not implemented")
+}
+func (UnimplementedFreiFahrenServer) mustEmbedUnimplementedFreiFahrenServer() {}
+
+// UnsafeFreiFahrenServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FreiFahrenServer will
+// result in compilation errors.
+type UnsafeFreiFahrenServer interface {
+	mustEmbedUnimplementedFreiFahrenServer()
+}
+
+func RegisterFreiFahrenServer(s grpc.ServiceRegistrar, srv FreiFahrenServer) {
+	s.RegisterService(&FreiFahren_ServiceDesc, srv)
+}
+
+func _FreiFahren_ReportInspector_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreiFahrenServer).ReportInspector(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FreiFahren_ReportInspector_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreiFahrenServer).ReportInspector(ctx, req.(*InspectorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FreiFahren_GetStation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreiFahrenServer).GetStation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FreiFahren_GetStation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreiFahrenServer).GetStation(ctx, req.(*GetStationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FreiFahren_ListStations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreiFahrenServer).ListStations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FreiFahren_ListStations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreiFahrenServer).ListStations(ctx, req.(*ListStationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FreiFahren_ListRecentSightings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecentSightingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FreiFahrenServer).ListRecentSightings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FreiFahren_ListRecentSightings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FreiFahrenServer).ListRecentSightings(ctx, req.(*ListRecentSightingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FreiFahren_StreamSightings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamSightingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FreiFahrenServer).StreamSightings(m, &freiFahrenStreamSightingsServer{ServerStream: stream})
+}
+
+type FreiFahren_StreamSightingsServer interface {
+	Send(*TicketInspector) error
+	grpc.ServerStream
+}
+
+type freiFahrenStreamSightingsServer struct {
+	grpc.ServerStream
+}
+
+func (x *freiFahrenStreamSightingsServer) Send(m *TicketInspector) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// FreiFahren_ServiceDesc is the grpc.ServiceDesc for FreiFahren service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FreiFahren_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "freifahren.v1.FreiFahren",
+	HandlerType: (*FreiFahrenServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReportInspector",
+			Handler:    _FreiFahren_ReportInspector_Handler,
+		},
+		{
+			MethodName: "GetStation",
+			Handler:    _FreiFahren_GetStation_Handler,
+		},
+		{
+			MethodName: "ListStations",
+			Handler:    _FreiFahren_ListStations_Handler,
+		},
+		{
+			MethodName: "ListRecentSightings",
+			Handler:    _FreiFahren_ListRecentSightings_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSightings",
+			Handler:       _FreiFahren_StreamSightings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "freifahren.proto",
+}
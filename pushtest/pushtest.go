@@ -0,0 +1,214 @@
+// Package pushtest provides a local fake Web Push service, like httptest does for http servers.
+// It hands out subscriptions with real keys and decrypts the notifications sent to them.
+package pushtest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	structs "github.com/FreiFahren/backend/structs"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Message is a notification received by the fake push service
+type Message struct {
+	SubscriptionID string
+	Payload        []byte
+	// The VAPID Authorization header and the TTL and Urgency headers of the request
+	Authorization string
+	TTL           string
+	Urgency       string
+}
+
+type Server struct {
+	URL string
+
+	server *httptest.Server
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+	messages      []Message
+}
+
+type subscription struct {
+	privateKey *ecdh.PrivateKey
+	authSecret []byte
+	expired    bool
+}
+
+func NewServer() *Server {
+	s := &Server{subscriptions: map[string]*subscription{}}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Subscribe creates a subscription like a browser would, with an endpoint on the fake push service
+func (s *Server) Subscribe() (structs.PushSubscription, error) {
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return structs.PushSubscription{}, err
+	}
+	authSecret := make([]byte, 16)
+	if _, err := rand.Read(authSecret); err != nil {
+		return structs.PushSubscription{}, err
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return structs.PushSubscription{}, err
+	}
+	id := fmt.Sprintf("%x", idBytes)
+
+	s.mu.Lock()
+	s.subscriptions[id] = &subscription{privateKey: privateKey, authSecret: authSecret}
+	s.mu.Unlock()
+
+	return structs.PushSubscription{
+		Channel:  structs.PushChannelWebPush,
+		Endpoint: s.URL + "/push/" + id,
+		Keys: structs.PushKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(privateKey.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(authSecret),
+		},
+	}, nil
+}
+
+// Expire makes the push service answer 410 Gone, like for a browser that unsubscribed
+func (s *Server) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if subscription, ok := s.subscriptions[strings.TrimPrefix(endpoint, s.URL+"/push/")]; ok {
+		subscription.expired = true
+	}
+}
+
+// Messages returns the decrypted notifications received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutPrefix(r.URL.Path, "/push/")
+	s.mu.Lock()
+	subscription, found := s.subscriptions[id]
+	s.mu.Unlock()
+
+	switch {
+	case !ok || !found || r.Method != http.MethodPost:
+		http.NotFound(w, r)
+		return
+	case subscription.expired:
+		w.WriteHeader(http.StatusGone)
+		return
+	case r.Header.Get("Content-Encoding") != "aes128gcm" || !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t="):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	payload, err := decrypt(body, subscription)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, Message{
+		SubscriptionID: id,
+		Payload:        payload,
+		Authorization:  r.Header.Get("Authorization"),
+		TTL:            r.Header.Get("TTL"),
+		Urgency:        r.Header.Get("Urgency"),
+	})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// decrypt reverses the aes128gcm content encoding of RFC 8188 with the keys of RFC 8291
+func decrypt(body []byte, subscription *subscription) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("the body is too short")
+	}
+	salt := body[:16]
+	recordSize := binary.BigEndian.Uint32(body[16:20])
+	keyLength := int(body[20])
+	if len(body) < 21+keyLength || recordSize < 18 {
+		return nil, errors.New("invalid header")
+	}
+	serverKey := body[21 : 21+keyLength]
+	ciphertext := body[21+keyLength:]
+
+	serverPublicKey, err := ecdh.P256().NewPublicKey(serverKey)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := subscription.privateKey.ECDH(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := append([]byte("WebPush: info\x00"), subscription.privateKey.PublicKey().Bytes()...)
+	info = append(info, serverKey...)
+	ikm, err := readKey(hkdf.New(sha256.New, sharedSecret, subscription.authSecret, info), 32)
+	if err != nil {
+		return nil, err
+	}
+	contentKey, err := readKey(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := readKey(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last record ends with the delimiter 0x02 followed by the padding
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		return nil, errors.New("missing padding delimiter")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+func readKey(reader io.Reader, length int) ([]byte, error) {
+	key := make([]byte, length)
+	_, err := io.ReadFull(reader, key)
+	return key, err
+}
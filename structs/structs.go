@@ -2,6 +2,7 @@ package structs
 
 import (
 	"database/sql"
+	"encoding/xml"
 	"time"
 )
 
@@ -74,3 +75,431 @@ type AllStationsAndLinesList struct {
 	Lines    []map[string][]string       `json:"lines"`
 	Stations map[string]StationListEntry `json:"stations"`
 }
+
+// challenge.go
+
+type ChallengeResponse struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// moderation.go
+
+type Report struct {
+	ID            string     `json:"id"`
+	Timestamp     time.Time  `json:"timestamp"`
+	Message       *string    `json:"message"`
+	Author        *int64     `json:"author"`
+	Line          *string    `json:"line"`
+	StationName   *string    `json:"stationName"`
+	StationID     *string    `json:"stationId"`
+	DirectionName *string    `json:"directionName"`
+	DirectionID   *string    `json:"directionId"`
+	ReporterID    *string    `json:"reporterId"`
+	Quarantined   bool       `json:"quarantined"`
+	HiddenAt      *time.Time `json:"hiddenAt"`
+}
+
+const (
+	ReportStatusVisible     = "visible"
+	ReportStatusHidden      = "hidden"
+	ReportStatusQuarantined = "quarantined"
+)
+
+type ReportFilter struct {
+	Query      string
+	Line       string
+	StationID  string
+	ReporterID string
+	Status     string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+type HideReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+type BanReporterRequest struct {
+	ReporterID string `json:"reporterId"`
+	ReportID   string `json:"reportId"`
+	Reason     string `json:"reason"`
+}
+
+type BannedReporter struct {
+	ReporterID string    `json:"reporterId"`
+	Reason     string    `json:"reason"`
+	BannedBy   string    `json:"bannedBy"`
+	BannedAt   time.Time `json:"bannedAt"`
+}
+
+const (
+	ModerationActionEdit    = "edit"
+	ModerationActionHide    = "hide"
+	ModerationActionRestore = "restore"
+	ModerationActionApprove = "approve"
+	ModerationActionBan     = "ban"
+	ModerationActionUnban   = "unban"
+)
+
+type ModerationLogEntry struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Moderator  string    `json:"moderator"`
+	Action     string    `json:"action"`
+	ReportID   *string   `json:"reportId"`
+	ReporterID *string   `json:"reporterId"`
+	Details    string    `json:"details"`
+}
+
+// auth.go
+
+const (
+	RolePublic   = "public"
+	RoleReporter = "reporter"
+	RolePartner  = "partner"
+	RoleAdmin    = "admin"
+)
+
+type ApiKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	QuotaPerDay int        `json:"quotaPerDay"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+}
+
+// errors.go
+
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId"`
+}
+
+// geoJSON.go
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Coordinates are [longitude, latitude] for points and a list of those for line strings
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// aggregation.go
+
+// AggregationFilter selects the reports that are counted, empty fields don't filter
+type AggregationFilter struct {
+	From       time.Time
+	To         time.Time
+	Hours      []int
+	Weekdays   []int
+	Lines      []string
+	StationIDs []string
+	Limit      int
+}
+
+type ReportCount struct {
+	Key   string
+	Count int
+}
+
+// getHeatmap.go
+
+type HeatmapResponse struct {
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Stations []HeatmapStation `json:"stations"`
+	Lines    []HeatmapLine    `json:"lines"`
+}
+
+// Weight is the count relative to the largest count, between 0 and 1
+type HeatmapStation struct {
+	Station Station `json:"station"`
+	Count   int     `json:"count"`
+	Weight  float64 `json:"weight"`
+}
+
+type HeatmapLine struct {
+	Line   string  `json:"line"`
+	Count  int     `json:"count"`
+	Weight float64 `json:"weight"`
+}
+
+// stats.go
+
+type StationCount struct {
+	Station Station `json:"station"`
+	Count   int     `json:"count"`
+}
+
+type LineCount struct {
+	Line  string `json:"line"`
+	Count int    `json:"count"`
+}
+
+type TopStationsResponse struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Stations []StationCount `json:"stations"`
+}
+
+type TopLinesResponse struct {
+	From  time.Time   `json:"from"`
+	To    time.Time   `json:"to"`
+	Lines []LineCount `json:"lines"`
+}
+
+// Counts are indexed by weekday (0 is Sunday) and hour of the day
+type StatsMatrixResponse struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Counts [][]int   `json:"counts"`
+}
+
+// Change is relative to the previous week, it is null if there were no reports in the previous week
+type WeeklyTrend struct {
+	WeekStart time.Time `json:"weekStart"`
+	Count     int       `json:"count"`
+	Change    *float64  `json:"change"`
+}
+
+type StatsTrendsResponse struct {
+	Weeks []WeeklyTrend `json:"weeks"`
+}
+
+type LineStatsResponse struct {
+	Line     string         `json:"line"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Count    int            `json:"count"`
+	Stations []StationCount `json:"stations"`
+	Counts   [][]int        `json:"counts"`
+}
+
+// getHistory.go
+
+// NextOffset is null on the last page
+type HistoryResponse struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Sightings  []TicketInspector `json:"sightings"`
+	NextOffset *int              `json:"nextOffset"`
+}
+
+// export.go
+
+// ExportRow is a report with the resolved station, message and author are empty in anonymized exports
+type ExportRow struct {
+	ID               string    `json:"id" parquet:"id"`
+	Timestamp        time.Time `json:"timestamp" parquet:"timestamp"`
+	Message          *string   `json:"message" parquet:"message,optional"`
+	Author           *int64    `json:"author" parquet:"author,optional"`
+	Line             *string   `json:"line" parquet:"line,optional"`
+	StationID        *string   `json:"stationId" parquet:"station_id,optional"`
+	StationName      *string   `json:"stationName" parquet:"station_name,optional"`
+	StationLatitude  *float64  `json:"stationLatitude" parquet:"station_latitude,optional"`
+	StationLongitude *float64  `json:"stationLongitude" parquet:"station_longitude,optional"`
+	StationLines     []string  `json:"stationLines" parquet:"station_lines,list"`
+	DirectionID      *string   `json:"directionId" parquet:"direction_id,optional"`
+	DirectionName    *string   `json:"directionName" parquet:"direction_name,optional"`
+}
+
+// import.go
+
+// ImportRecord is a historical report of a Telegram export or CSV file.
+// The SourceHash identifies the message or row, so importing a file twice doesn't duplicate it.
+type ImportRecord struct {
+	SourceHash    string
+	Timestamp     time.Time
+	Message       *string
+	Author        *int64
+	Line          *string
+	StationName   *string
+	StationID     *string
+	DirectionName *string
+	DirectionID   *string
+}
+
+// ImportReject is a message or row that couldn't be imported, Reference is the message id or line number
+type ImportReject struct {
+	File      string
+	Reference string
+	Reason    string
+	Raw       string
+}
+
+// openData.go
+
+// HourlyCount is the number of reports of an hour at a station and line, both are empty if unknown
+type HourlyCount struct {
+	Hour      time.Time
+	StationID string
+	Line      string
+	Count     int
+}
+
+// OpenDataRow is a row of the published dataset, it doesn't contain any messages or reporters
+type OpenDataRow struct {
+	Hour             time.Time `json:"hour"`
+	StationID        string    `json:"stationId"`
+	StationName      string    `json:"stationName"`
+	StationLatitude  *float64  `json:"stationLatitude"`
+	StationLongitude *float64  `json:"stationLongitude"`
+	Line             string    `json:"line"`
+	Count            int       `json:"count"`
+}
+
+type OpenDataFile struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// OpenDataManifest describes the files of a daily snapshot
+type OpenDataManifest struct {
+	Date        string         `json:"date"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Rows        int            `json:"rows"`
+	Reports     int            `json:"reports"`
+	Files       []OpenDataFile `json:"files"`
+}
+
+// notifications.go
+
+const (
+	PushChannelWebPush = "webpush"
+	PushChannelWebhook = "webhook"
+)
+
+// PushKeys are the keys of a Web Push subscription, as returned by PushSubscription.toJSON() in the browser
+type PushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// PushSubscription gets a notification for new sightings at the watched stations or lines.
+// From and To limit it to a time of the day like 07:30, Weekdays start with 0 on Sunday.
+type PushSubscription struct {
+	ID        string    `json:"id"`
+	Channel   string    `json:"channel"`
+	Endpoint  string    `json:"endpoint"`
+	Keys      PushKeys  `json:"keys"`
+	Stations  []string  `json:"stations"`
+	Lines     []string  `json:"lines"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Weekdays  []int     `json:"weekdays"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PushSubscriptionResponse contains the token to delete the subscription, it is only returned once
+type PushSubscriptionResponse struct {
+	PushSubscription
+	Token string `json:"token"`
+}
+
+type VAPIDKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+}
+
+// PushNotification is the payload of Web Push and webhook notifications
+type PushNotification struct {
+	Title    string          `json:"title"`
+	Body     string          `json:"body"`
+	Sighting TicketInspector `json:"sighting"`
+}
+
+// webhooks.go
+
+// Event of the webhooks, sent in the X-FreiFahren-Event header
+const WebhookEventSighting = "sighting.created"
+
+// Webhook receives the new sightings matching its filters, empty filters match every sighting.
+// The secret signing the payloads is only returned when the webhook is created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	City      string    `json:"city,omitempty"`
+	Lines     []string  `json:"lines"`
+	Stations  []string  `json:"stations"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is an attempt to deliver an event, all attempts of the same event share the DeliveryID
+type WebhookDelivery struct {
+	WebhookID  string    `json:"webhookId"`
+	DeliveryID string    `json:"deliveryId"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"statusCode"`
+	Error      *string   `json:"error"`
+	DurationMs int64     `json:"durationMs"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// broadcast.go
+
+// BroadcastBatch is passed to the templates of the broadcasters, it contains the sightings collected during the batch window
+type BroadcastBatch struct {
+	Sightings []TicketInspector
+}
+
+// feed.go
+
+// AtomFeed is the Atom document of /feed.xml
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type AtomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  AtomAuthor  `xml:"author"`
+	Content AtomContent `xml:"content"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// health.go
+
+// HealthResponse lists the checks of /healthz and /readyz with "ok" or the error
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
@@ -0,0 +1,153 @@
+// Package telegramtest provides a local stub of the Telegram Bot API, like httptest does for http servers.
+// Messages are queued with Send and handed out by getUpdates, the replies of sendMessage are recorded.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reply is a message the bot sent with sendMessage
+type Reply struct {
+	ChatID           int64  `json:"chat_id"`
+	Text             string `json:"text"`
+	ReplyToMessageID int64  `json:"reply_to_message_id"`
+}
+
+type update struct {
+	UpdateID int64   `json:"update_id"`
+	Message  message `json:"message"`
+}
+
+type message struct {
+	MessageID int64 `json:"message_id"`
+	Date      int64 `json:"date"`
+	Chat      struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+type Server struct {
+	URL string
+
+	server *httptest.Server
+	token  string
+
+	mu      sync.Mutex
+	updates []update
+	nextID  int64
+	replies []Reply
+	// Closed and replaced whenever a message is queued, to wake up long polling
+	queued chan struct{}
+}
+
+// NewServer starts the stub, only requests with the token are accepted
+func NewServer(token string) *Server {
+	s := &Server{token: token, nextID: 1, queued: make(chan struct{})}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Send queues a message in the chat and returns its message id
+func (s *Server) Send(chatID int64, text string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+
+	var m message
+	m.MessageID, m.Date, m.Text = id, time.Now().Unix(), text
+	m.Chat.ID, m.Chat.Type = chatID, "group"
+	s.updates = append(s.updates, update{UpdateID: id, Message: m})
+
+	close(s.queued)
+	s.queued = make(chan struct{})
+	return id
+}
+
+// Replies returns the messages the bot sent so far
+func (s *Server) Replies() []Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Reply(nil), s.replies...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+s.token+"/")
+	if !ok {
+		respond(w, http.StatusUnauthorized, false, nil, "Unauthorized")
+		return
+	}
+
+	var params struct {
+		Reply
+		Offset  int64 `json:"offset"`
+		Timeout int   `json:"timeout"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respond(w, http.StatusBadRequest, false, nil, "Bad Request: "+err.Error())
+		return
+	}
+
+	switch method {
+	case "getUpdates":
+		respond(w, http.StatusOK, true, s.waitForUpdates(r, params.Offset, time.Duration(params.Timeout)*time.Second), "")
+	case "sendMessage":
+		if params.ChatID == 0 || params.Text == "" {
+			respond(w, http.StatusBadRequest, false, nil, "Bad Request: chat_id and text are required")
+			return
+		}
+		s.mu.Lock()
+		s.replies = append(s.replies, params.Reply)
+		s.mu.Unlock()
+		respond(w, http.StatusOK, true, map[string]interface{}{"message_id": 0, "text": params.Text}, "")
+	default:
+		respond(w, http.StatusNotFound, false, nil, "Not Found: method not found")
+	}
+}
+
+// waitForUpdates returns the updates from the offset on, waiting up to timeout if there are none yet
+func (s *Server) waitForUpdates(r *http.Request, offset int64, timeout time.Duration) []update {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		pending := []update{}
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		queued := s.queued
+		s.mu.Unlock()
+
+		if len(pending) > 0 || timeout == 0 {
+			return pending
+		}
+
+		select {
+		case <-queued:
+		case <-deadline:
+			return pending
+		case <-r.Context().Done():
+			return pending
+		}
+	}
+}
+
+func respond(w http.ResponseWriter, status int, ok bool, result interface{}, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": ok, "result": result, "description": description})
+}
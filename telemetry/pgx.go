@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer creates a span for every query of the pool and logs them at debug level with the request id
+type QueryTracer struct{}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, queryName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, attribute.String("db.statement", data.SQL)),
+	)
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	query, _ := ctx.Value(queryStartKey{}).(queryStart)
+	duration := time.Since(query.start)
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		// Cancelled queries are the client's doing and logged by the handler
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Query failed", "query", queryName(query.sql), "duration", duration, "error", data.Err)
+		}
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	slog.DebugContext(ctx, "Query", "query", queryName(query.sql), "duration", duration, "rows", data.CommandTag.RowsAffected())
+}
+
+// queryName is the first words of the statement, e.g. "SELECT timestamp, station_id", short enough for span names
+func queryName(sql string) string {
+	words := strings.Fields(sql)
+	if len(words) > 4 {
+		words = words[:4]
+	}
+	return strings.Join(words, " ")
+}